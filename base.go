@@ -3,18 +3,21 @@ package viamboatbase
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math"
 	"sync"
 	"time"
 
 	"github.com/edaniels/golog"
 	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
 	"go.uber.org/multierr"
 	"go.viam.com/utils"
 
 	"go.viam.com/rdk/components/base"
 	"go.viam.com/rdk/components/motor"
 	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/components/sensor"
 	"go.viam.com/rdk/operation"
 	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/spatialmath"
@@ -23,8 +26,35 @@ import (
 
 var Model = resource.ModelNamespace("erh").WithFamily("base").WithModel("boat")
 
+// default control loop period
 const pidLoopTime = time.Millisecond * 500
 
+// the control loop gives its sensor reads this many periods before giving up on them
+const sensorReadPeriods = 2
+
+// how often MoveStraight checks how far we've gone
+const moveStraightPollTime = time.Millisecond * 100
+
+// MoveStraight gives up after this many times as long as it should take, plus the stall time,
+// and fails if it goes less than moveStraightMinProgress of what it should in a stall time
+const (
+	moveStraightTimeoutFactor = 2
+	moveStraightMinProgress   = .1
+	defaultMoveStraightStall  = 5 * time.Second
+)
+
+// how often Spin checks the compass to see if it's done, unless configured
+const defaultSpinPollTime = time.Millisecond * 100
+
+// how many heading reads in a row Spin lets fail, unless configured
+const defaultSpinHeadingRetries = 3
+
+// how often the power is changed during a ramped stop or a slew limited SetPower
+const powerRampStep = time.Millisecond * 50
+
+// how fast SetVelocity with hold_heading turns to correct if no angular velocity is given
+const defaultHoldHeadingDegsPerSec = 10
+
 func init() {
 	boatComp := resource.Registration[base.Base, *Config]{
 		Constructor: func(
@@ -36,36 +66,80 @@ func init() {
 	resource.RegisterComponent(base.API, Model, boatComp)
 }
 
+// createBoat resolves everything the boat needs before building it, so a failure leaves nothing
+// behind. no motors are commanded during construction, they're left however they were until the
+// first command, or until startup_mode takes over once the boat is built.
 func createBoat(deps resource.Dependencies, conf resource.Config, logger golog.Logger) (base.LocalBase, error) {
 	newConf, err := resource.NativeConfig[*Config](conf)
 	if err != nil {
 		return nil, err
 	}
 
-	theBoat := &boat{
-		Named:  conf.ResourceName().AsNamed(),
-		cfg:    newConf,
-		logger: logger,
+	if err := newConf.applyLayout(); err != nil {
+		return nil, err
 	}
 
-	theBoat.state.angularPID.setDefaults()
-	theBoat.state.linearPID.setDefaults()
-
+	motors := map[string]motor.Motor{}
 	for _, mc := range newConf.Motors {
 		m, err := motor.FromDependencies(deps, mc.Name)
 		if err != nil {
 			return nil, err
 		}
-		theBoat.motors = append(theBoat.motors, m)
+		motors[mc.Name] = m
+	}
+
+	var movementSensor, headingSensor, angularVelocitySensor, linearVelocitySensor movementsensor.MovementSensor
+	for _, ms := range []struct {
+		name string
+		dest *movementsensor.MovementSensor
+	}{
+		{newConf.MovementSensor, &movementSensor},
+		{newConf.HeadingSensor, &headingSensor},
+		{newConf.AngularVelocitySensor, &angularVelocitySensor},
+		{newConf.LinearVelocitySensor, &linearVelocitySensor},
+	} {
+		if ms.name == "" {
+			continue
+		}
+		var err error
+		*ms.dest, err = movementsensor.FromDependencies(deps, ms.name)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if newConf.MovementSensor != "" {
+	var powerSensor sensor.Sensor
+	if newConf.PowerSensor != "" {
 		var err error
-		theBoat.movementSensor, err = movementsensor.FromDependencies(deps, newConf.MovementSensor)
+		powerSensor, err = resource.FromDependencies[sensor.Sensor](deps, sensor.Named(newConf.PowerSensor))
 		if err != nil {
 			return nil, err
 		}
 	}
+
+	theBoat := &boat{
+		Named:                 conf.ResourceName().AsNamed(),
+		cfg:                   newConf,
+		logger:                logger,
+		motors:                motors,
+		movementSensor:        movementSensor,
+		headingSensor:         headingSensor,
+		angularVelocitySensor: angularVelocitySensor,
+		linearVelocitySensor:  linearVelocitySensor,
+		powerSensor:           powerSensor,
+		solver:                newConf.configuredSolver(),
+	}
+
+	theBoat.state.configure(newConf)
+	theBoat.loadGainsAtStartup()
+
+	if err := theBoat.applyStartupMode(context.Background()); err != nil {
+		// the motors were never told anything, so leave them alone
+		theBoat.release()
+		return nil, fmt.Errorf("startup_mode %q: %w", newConf.StartupMode, err)
+	}
+
+	theBoat.startKeepAlive()
 	return theBoat, nil
 }
 
@@ -75,17 +149,204 @@ const (
 	controlNone     controlMode = 0
 	controlVelocity             = 1
 	controlHeading              = 2
+	controlPosition             = 3
 )
 
+func (s *boatState) configure(cfg *Config) {
+	s.angularPID.configure(cfg.AngularPID)
+	s.linearPID.configure(cfg.LinearPID)
+	s.lateralPID.configure(cfg.lateralPID())
+	s.lateral = cfg.lateralEnabled()
+	configurePositionPID(&s.northPID, cfg)
+	configurePositionPID(&s.eastPID, cfg)
+	s.maxLinearAccel = cfg.MaxLinearAccelMMPerSec2
+	s.maxAngularAccel = cfg.MaxAngularAccelDegPerSec2
+	s.maxLinearJerk = cfg.MaxLinearJerkMMPerSec3
+	s.maxAngularVelocity = cfg.MaxAngularVelocityDegPerSec
+	s.loopTime = cfg.controlLoopTime()
+	s.biasLearnRate = cfg.BiasLearnRate
+	s.headingDeadband = cfg.headingDeadband()
+	s.headingRamp = cfg.headingRamp()
+	s.headingPIDControl = cfg.HeadingControl != headingControlRamp
+	configureHeadingPID(&s.headingPID, cfg)
+}
+
+// period is how often the control loop is supposed to run
+func (s *boatState) period() time.Duration {
+	if s.loopTime <= 0 {
+		return pidLoopTime
+	}
+	return s.loopTime
+}
+
+// dt is the time step the pids use, which is how long it really was since the last loop if we know
+func (s *boatState) dt() time.Duration {
+	if s.elapsed > 0 {
+		return s.elapsed
+	}
+	return s.period()
+}
+
+// markLoop records that the control loop ran now, updating elapsed
+func (s *boatState) markLoop(now time.Time) {
+	if !s.lastLoopTime.IsZero() {
+		s.elapsed = now.Sub(s.lastLoopTime)
+	}
+	s.lastLoopTime = now
+}
+
+// rampGoals moves the ramped goals toward the velocity goals, changing by no more than the
+// acceleration limits allow in dt
+func (s *boatState) rampGoals(dt time.Duration) {
+	if s.maxLinearJerk > 0 {
+		s.rampedLinearGoal, s.rampedLinearAccel = rampVectorJerk(
+			s.rampedLinearGoal, s.velocityLinearGoal, s.rampedLinearAccel, s.maxLinearAccel, s.maxLinearJerk, dt.Seconds())
+	} else {
+		s.rampedLinearGoal = rampVector(s.rampedLinearGoal, s.velocityLinearGoal, s.maxLinearAccel*dt.Seconds())
+	}
+	s.rampedAngularGoal = rampVector(s.rampedAngularGoal, s.velocityAngularGoal, s.maxAngularAccel*dt.Seconds())
+}
+
+func rampVector(current, goal r3.Vector, maxStep float64) r3.Vector {
+	delta := goal.Sub(current)
+	if maxStep <= 0 || delta.Norm() <= maxStep {
+		return goal
+	}
+	return current.Add(delta.Mul(maxStep / delta.Norm()))
+}
+
+// rampVectorJerk is rampVector where the acceleration itself can only change by maxJerk per
+// second, returning the new value and acceleration. maxAccel of 0 means no acceleration limit.
+func rampVectorJerk(current, goal, accel r3.Vector, maxAccel, maxJerk, dt float64) (r3.Vector, r3.Vector) {
+	delta := goal.Sub(current)
+	if dt <= 0 || delta.Norm() == 0 {
+		return goal, r3.Vector{}
+	}
+
+	want := delta.Mul(1 / dt)
+	if maxAccel > 0 && want.Norm() > maxAccel {
+		want = want.Mul(maxAccel / want.Norm())
+	}
+
+	change := want.Sub(accel)
+	if maxStep := maxJerk * dt; change.Norm() > maxStep {
+		change = change.Mul(maxStep / change.Norm())
+	}
+	accel = accel.Add(change)
+
+	// don't go past the goal, and once there there's nothing left to accelerate for
+	step := accel.Mul(dt)
+	if step.Dot(delta) >= delta.Dot(delta) {
+		return goal, r3.Vector{}
+	}
+	return current.Add(step), accel
+}
+
+// saturated is whether the linear and angular pids are at their output limits, which means the
+// boat is doing all it can on that axis and still not keeping up
+func (s *boatState) saturated() (linear, angular bool) {
+	return s.linearPID.Saturated() || s.lateralPID.Saturated(), s.angularPID.Saturated()
+}
+
+func (c controlMode) String() string {
+	switch c {
+	case controlNone:
+		return "none"
+	case controlVelocity:
+		return "velocity"
+	case controlHeading:
+		return "heading"
+	case controlPosition:
+		return "position"
+	default:
+		return "unknown"
+	}
+}
+
 type boatState struct {
 	threadStarted bool
 	controlState  controlMode
 
+	// latched by an emergency stop, nothing moves until it's cleared
+	estopped bool
+
 	angularPID, linearPID                   pidState
 	velocityLinearGoal, velocityAngularGoal r3.Vector
 
-	compassGoal  float64
-	spinVelocity float64
+	// runs linear x, only on boats that can move sideways
+	lateralPID pidState
+	lateral    bool
+
+	// turning toward compassGoal is no faster than spinVelocity, or maxAngularVelocity if that's
+	// lower or spinVelocity isn't set
+	compassGoal, spinVelocity float64
+	maxAngularVelocity        float64
+
+	// how far a running Spin has left to turn, and about how long that'll take at the rate it's
+	// turning. both are 0 when no Spin is running, or the time when it can't be guessed.
+	spinHeadingError, spinETASec float64
+
+	// how close to the compass goal to stop turning, and to start slowing down
+	headingDeadband, headingRamp float64
+
+	// if set, the heading error goes through headingPID instead of the ramp
+	headingPIDControl bool
+	headingPID        pidState
+
+	// where we're trying to stay when holding position
+	holdPoint         *geo.Point
+	northPID, eastPID pidState
+
+	// what the pids are actually trying to reach, which moves toward the velocity goals
+	// no faster than the acceleration limits. 0 limits mean no ramping.
+	rampedLinearGoal, rampedAngularGoal r3.Vector
+	maxLinearAccel, maxAngularAccel     float64
+	maxLinearJerk                       float64
+	rampedLinearAccel                   r3.Vector
+
+	// motors taken out of the allocation after failing, only with FaultTolerant
+	faultedMotors map[string]bool
+
+	// learned steady state output needed to hold against current or wind, added to the pid outputs.
+	// it's in the boat's frame, so it only holds for the heading it was learned at, see resetBias.
+	linearBias, angularBias float64
+	biasLearnRate           float64
+
+	// last thing we sent to the motors, and the sensor readings from the last loop
+	lastPower           []float64
+	lastLinearVelocity  r3.Vector
+	lastAngularVelocity spatialmath.AngularVelocity
+	lastHeading         float64
+
+	// how often the control loop runs, when it last ran, and how long it was since the run before that
+	loopTime     time.Duration
+	lastLoopTime time.Time
+	elapsed      time.Duration
+
+	// when we last got all the readings we needed from the movement sensor
+	lastSensorRead time.Time
+
+	// last battery voltage from the power sensor, 0 if we don't have one
+	lastVoltage float64
+
+	// how far the last power solution was from the goal, see Config.ComputePowerWithResidual
+	lastResidual float64
+}
+
+// snapshotState is a copy of the state, for anything outside the control thread and commands
+// that wants to look at it
+func (b *boat) snapshotState() boatState {
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+
+	s := b.state
+	s.lastPower = make([]float64, len(b.state.lastPower))
+	copy(s.lastPower, b.state.lastPower)
+	s.faultedMotors = map[string]bool{}
+	for name := range b.state.faultedMotors {
+		s.faultedMotors[name] = true
+	}
+	return s
 }
 
 type boat struct {
@@ -93,8 +354,18 @@ type boat struct {
 	resource.AlwaysRebuild
 
 	cfg            *Config
-	motors         []motor.Motor
+	motors         map[string]motor.Motor // by the motor's name in the config
 	movementSensor movementsensor.MovementSensor
+	powerSensor    sensor.Sensor
+
+	// where each reading comes from, if not movementSensor
+	headingSensor, angularVelocitySensor, linearVelocitySensor movementsensor.MovementSensor
+
+	optimizer powerOptimizer
+	solver    PowerSolver // if nil, optimizer is used
+
+	// where ControlSamples go, if anyone is watching. guarded by stateMutex
+	observer chan ControlSample
 
 	opMgr operation.SingleOperationManager
 
@@ -104,6 +375,17 @@ type boat struct {
 	cancel    context.CancelFunc
 	waitGroup sync.WaitGroup
 
+	// held while power is sent to the motors, so the keep alive doesn't send 0 in the middle and
+	// a Stop doesn't stop them in the middle of a ramp down step
+	powerMutex       sync.Mutex
+	stopRampCancel   context.CancelFunc // cancels the ramp down of the Stop in progress, if any. guarded by stateMutex
+	stopRamps        int                // how many Stops are ramping down right now. guarded by stateMutex
+	keepAliveCancel  context.CancelFunc
+	keepAliveWorkers sync.WaitGroup
+
+	// each motor's encoder at the last status, for rpm. guarded by stateMutex
+	motorPositions map[string]motorPosition
+
 	logger golog.Logger
 }
 
@@ -112,35 +394,261 @@ func (b *boat) MoveStraight(ctx context.Context, distanceMm int, mmPerSec float6
 		mmPerSec *= -1
 		distanceMm *= -1
 	}
-	err := b.SetVelocity(ctx, r3.Vector{Y: mmPerSec}, r3.Vector{}, extra)
+
+	if distanceMm == 0 || mmPerSec == 0 {
+		return b.Stop(ctx, nil)
+	}
+
+	var start *geo.Point
+	if b.positionSupported(ctx) {
+		var err error
+		start, _, err = b.movementSensor.Position(ctx, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the whole move is one operation, so a newer command cancels the wait and isn't stopped by it
+	opCtx, done := b.opMgr.New(ctx)
+	defer done()
+
+	velocity := moveStraightVelocity(mmPerSec, extra)
+	err := b.SetVelocity(opCtx, velocity, r3.Vector{}, extra)
 	if err != nil {
 		return err
 	}
-	s := time.Duration(float64(time.Millisecond) * math.Abs(float64(distanceMm)))
-	utils.SelectContextOrWait(ctx, s)
-	return b.Stop(ctx, nil)
+
+	// how long it should take at mmPerSec
+	expected := time.Duration(float64(distanceMm) / math.Abs(mmPerSec) * float64(time.Second))
+
+	odometer := b.moveStraightOdometer(start, velocity)
+	if odometer == nil {
+		b.logger.Debugf("MoveStraight no position or velocity available, using time")
+		utils.SelectContextOrWait(opCtx, expected)
+		if superseded(ctx, opCtx) {
+			return opCtx.Err()
+		}
+		return b.Stop(ctx, nil)
+	}
+
+	b.logger.Debugf("MoveStraight start: %v expected to take: %v", start, expected)
+
+	stall := b.cfg.moveStraightStallTime()
+	if sec, ok := floatFromExtra(extra, "stall_sec"); ok && sec > 0 {
+		stall = time.Duration(sec * float64(time.Second))
+	}
+
+	timeoutSec := moveStraightTimeoutFactor*expected.Seconds() + stall.Seconds()
+	if t, ok := floatFromExtra(extra, "timeout_sec"); ok && t > 0 {
+		timeoutSec = t
+	}
+	waitCtx, cancel := context.WithTimeout(opCtx, time.Duration(timeoutSec*float64(time.Second)))
+	defer cancel()
+
+	pollTime := moveStraightPollTime
+	if ms, ok := floatFromExtra(extra, "poll_ms"); ok && ms > 0 {
+		pollTime = time.Duration(ms * float64(time.Millisecond))
+	}
+
+	// every stall period, it has to have gone at least moveStraightMinProgress of what it should have
+	var checkpoint float64
+	checkpointTime := time.Now()
+	minProgress := moveStraightMinProgress * math.Abs(mmPerSec) * stall.Seconds()
+
+	var traveled float64
+	err = b.opMgr.WaitForSuccess(waitCtx, pollTime, func(ctx context.Context) (bool, error) {
+		traveled, err = odometer(ctx)
+		if err != nil {
+			return false, err
+		}
+		if traveled >= float64(distanceMm) {
+			return true, nil
+		}
+		if time.Since(checkpointTime) < stall {
+			return false, nil
+		}
+		if traveled-checkpoint < minProgress {
+			return false, fmt.Errorf("%w: went %.0f mm in %v, %.0f of %v mm so far",
+				ErrNoProgress, traveled-checkpoint, time.Since(checkpointTime), traveled, distanceMm)
+		}
+		checkpoint, checkpointTime = traveled, time.Now()
+		return false, nil
+	})
+	if superseded(ctx, opCtx) {
+		return opCtx.Err()
+	}
+	if ctx.Err() != nil {
+		// the caller giving up isn't the move failing, it's stopped the same as if it got there
+		err = nil
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: only went %.0f of %v mm in %v seconds", ErrMoveStraightTimeout, traveled, distanceMm, timeoutSec)
+	}
+
+	return multierr.Combine(err, b.Stop(ctx, nil))
 }
 
-func (b *boat) Spin(ctx context.Context, angleDeg, degsPerSec float64, extra map[string]interface{}) error {
+// moveStraightOdometer measures how far MoveStraight has gone in mm, from start if there's a
+// position, or by adding up the velocity along the way it's going if there isn't. it's nil if
+// there's neither.
+func (b *boat) moveStraightOdometer(start *geo.Point, velocity r3.Vector) func(ctx context.Context) (float64, error) {
+	if start != nil {
+		return func(ctx context.Context) (float64, error) {
+			p, _, err := b.movementSensor.Position(ctx, nil)
+			if err != nil {
+				return 0, err
+			}
+			return kmToMM(start.GreatCircleDistance(p)), nil
+		}
+	}
+
+	if b.linearVelocitySource() == nil {
+		return nil
+	}
+
+	dir := velocity.Normalize()
+	var traveled float64
+	last := time.Now()
+	return func(ctx context.Context) (float64, error) {
+		v, err := b.linearVelocitySource().LinearVelocity(ctx, nil)
+		if err != nil {
+			return 0, err
+		}
+		now := time.Now()
+		traveled += v.Dot(dir) * now.Sub(last).Seconds()
+		last = now
+		return traveled, nil
+	}
+}
+
+// superseded is true if the operation opCtx is for was cancelled by a newer one, rather than by the
+// caller giving up. the newer one owns the motors then, so the old one shouldn't stop them.
+func superseded(ctx, opCtx context.Context) bool {
+	return opCtx.Err() != nil && ctx.Err() == nil
+}
+
+// moveStraightVelocity is the linear velocity for MoveStraight. extra["direction"] is the
+// angle to move in, 0 being forward and 90 being starboard, or positive x, like a motor's angle_degs.
+func moveStraightVelocity(mmPerSec float64, extra map[string]interface{}) r3.Vector {
+	dir, ok := floatFromExtra(extra, "direction")
+	if !ok {
+		return r3.Vector{Y: mmPerSec}
+	}
+	rad := rdkutils.DegToRad(dir)
+	return r3.Vector{X: mmPerSec * math.Sin(rad), Y: mmPerSec * math.Cos(rad)}
+}
+
+func kmToMM(km float64) float64 {
+	return km * 1000 * 1000
+}
+
+// positionSupported is true if we have a movement sensor that can tell us where we are
+func (b *boat) positionSupported(ctx context.Context) bool {
+	if err := b.checkPosition(ctx); err != nil {
+		b.logger.Debugf("no position: %v", err)
+		return false
+	}
+	return true
+}
+
+// checkPosition is ErrPositionNotSupported if there's no movement sensor or it says it can't do
+// position, and the error if it can't be asked, which might go away
+func (b *boat) checkPosition(ctx context.Context) error {
 	if b.movementSensor == nil {
-		return errors.New("no movementSensor")
+		return ErrPositionNotSupported
 	}
 
-	compass, err := b.movementSensor.CompassHeading(ctx, nil)
+	props, err := b.movementSensor.Properties(ctx, nil)
 	if err != nil {
+		return fmt.Errorf("movement sensor properties: %w", err)
+	}
+	if !props.PositionSupported {
+		return ErrPositionNotSupported
+	}
+	return nil
+}
+
+// CurrentHeading is the compass heading from whichever sensor is configured for it, increasing
+// clockwise whichever way the sensor counts
+func (b *boat) CurrentHeading(ctx context.Context) (float64, error) {
+	if b.headingSource() == nil {
+		return 0, ErrNoMovementSensor
+	}
+	heading, err := b.headingSource().CompassHeading(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	if b.cfg.HeadingCounterClockwise {
+		heading = rdkutils.ModAngDeg(360 - heading)
+	}
+	return heading, nil
+}
+
+// readAngularVelocity is the angular velocity from whichever sensor is configured for it, positive
+// z counterclockwise whichever way the sensor counts
+func (b *boat) readAngularVelocity(ctx context.Context, extra map[string]interface{}) (spatialmath.AngularVelocity, error) {
+	av, err := b.angularVelocitySource().AngularVelocity(ctx, extra)
+	if err != nil {
+		return spatialmath.AngularVelocity{}, err
+	}
+	if b.cfg.AngularVelocityClockwise {
+		av.Z *= -1
+	}
+	return av, nil
+}
+
+// CurrentPosition is where the boat is, if the movement sensor supports position
+func (b *boat) CurrentPosition(ctx context.Context) (*geo.Point, error) {
+	if !b.positionSupported(ctx) {
+		return nil, ErrPositionNotSupported
+	}
+	p, _, err := b.movementSensor.Position(ctx, nil)
+	return p, err
+}
+
+func (b *boat) Spin(ctx context.Context, angleDeg, degsPerSec float64, extra map[string]interface{}) error {
+	if b.headingSource() == nil && !b.openLoop() {
+		return ErrNoMovementSensor
+	}
+
+	if err := b.checkEStop(); err != nil {
+		return err
+	}
+
+	if _, err := b.checkBattery(ctx); err != nil {
 		return err
 	}
 
-	goal := compass + angleDeg
+	degsPerSec, clamped := b.cfg.clampAngularVelocity(degsPerSec)
+	if clamped {
+		b.logger.Warnf("Spin degsPerSec clamped to %v", degsPerSec)
+	}
+
+	if b.openLoop() {
+		return b.spinOpenLoop(ctx, angleDeg, degsPerSec)
+	}
+
+	compass, err := b.CurrentHeading(ctx)
+	if err != nil {
+		return err
+	}
+
+	goal := rdkutils.ModAngDeg(compass + angleDeg)
 
 	b.logger.Infof("Spin angleDeg: %v degsPerSec: %v compass: %v goal: %v", angleDeg, degsPerSec, compass, goal)
-	_, done := b.opMgr.New(ctx)
+	opCtx, done := b.opMgr.New(ctx)
 	defer done()
 
 	b.stateMutex.Lock()
 
-	b.state.controlState = controlHeading
-	b.state.compassGoal = goal
+	// something newer already started, and may have set its own goals
+	if opCtx.Err() != nil {
+		b.stateMutex.Unlock()
+		return opCtx.Err()
+	}
+
+	b.setControlStateInLock(controlHeading)
+	b.setRampLimitsInLock(nil)
+	b.setCompassGoalInLock(goal)
 	b.state.velocityLinearGoal = r3.Vector{}
 	b.state.spinVelocity = degsPerSec
 	b.state.velocityAngularGoal = r3.Vector{0, 0, 0}
@@ -153,14 +661,207 @@ func (b *boat) Spin(ctx context.Context, angleDeg, degsPerSec float64, extra map
 		return err
 	}
 
-	return b.opMgr.WaitForSuccess(ctx, time.Second, func(ctx context.Context) (bool, error) {
-		compass, err := b.movementSensor.CompassHeading(ctx, nil)
+	tolerance := b.cfg.spinTolerance()
+	if t, ok := floatFromExtra(extra, "tolerance_deg"); ok {
+		tolerance = t
+	}
+
+	timeoutSec := b.cfg.SpinTimeoutSec
+	if t, ok := floatFromExtra(extra, "timeout_sec"); ok {
+		timeoutSec = t
+	}
+
+	pollTime := b.cfg.spinPollTime()
+	if ms, ok := floatFromExtra(extra, "poll_ms"); ok && ms > 0 {
+		pollTime = time.Duration(ms * float64(time.Millisecond))
+	}
+
+	waitCtx := opCtx
+	if timeoutSec > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(opCtx, time.Duration(timeoutSec*float64(time.Second)))
+		defer cancel()
+	}
+
+	// a compass that drops out for a moment doesn't fail the spin, the control loop keeps going on
+	// the last heading, or dead reckoning, until it's back
+	retries := b.cfg.spinHeadingRetries()
+	failures := 0
+
+	defer b.setSpinProgress(0)
+	err = b.opMgr.WaitForSuccess(waitCtx, pollTime, func(ctx context.Context) (bool, error) {
+		compass, err := b.CurrentHeading(ctx)
 		if err != nil {
-			return false, err
+			failures++
+			if failures > retries {
+				return false, fmt.Errorf("heading failed %v times in a row: %w", failures, err)
+			}
+			backoff := pollTime << (failures - 1)
+			b.logger.Debugf("Spin can't read heading, trying again in %v: %v", pollTime+backoff, err)
+			utils.SelectContextOrWait(ctx, backoff)
+			return false, nil
 		}
+		failures = 0
 
-		return rdkutils.AngleDiffDeg(goal, compass) < 1, nil
+		diff := rdkutils.AngleDiffDeg(goal, compass)
+		b.setSpinProgress(diff)
+		return diff < tolerance, nil
 	})
+
+	if superseded(ctx, opCtx) {
+		return opCtx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return multierr.Combine(
+			fmt.Errorf("%w, didn't get within %v degrees of %v in %v seconds", ErrSpinTimeout, tolerance, goal, timeoutSec),
+			b.Stop(ctx, nil),
+		)
+	}
+	return err
+}
+
+// setSpinProgress records how many degrees Spin has left to turn for status, and guesses how long
+// that'll take from the last measured turn rate, or the turn limit if it isn't turning yet
+func (b *boat) setSpinProgress(headingError float64) {
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+
+	rate := math.Abs(b.state.lastAngularVelocity.Z)
+	if rate == 0 {
+		rate = b.state.turnLimit()
+	}
+
+	b.state.spinHeadingError = headingError
+	b.state.spinETASec = 0
+	if rate > 0 {
+		b.state.spinETASec = headingError / rate
+	}
+}
+
+// floatFromExtra gets a number out of extra, the bool is false if it's missing or not a number
+func floatFromExtra(extra map[string]interface{}, key string) (float64, bool) {
+	v, ok := extra[key]
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// setRampLimitsInLock sets the linear acceleration and jerk limits for the current command from
+// extra["max_accel"] (mm/sec^2) and extra["max_jerk"] (mm/sec^3), using the config for anything
+// missing. values that aren't positive numbers are ignored.
+func (b *boat) setRampLimitsInLock(extra map[string]interface{}) {
+	b.state.maxLinearAccel = b.cfg.MaxLinearAccelMMPerSec2
+	b.state.maxLinearJerk = b.cfg.MaxLinearJerkMMPerSec3
+
+	limit := func(key string, def float64) float64 {
+		if _, ok := extra[key]; !ok {
+			return def
+		}
+		v, ok := floatFromExtra(extra, key)
+		if !ok || math.IsNaN(v) || math.IsInf(v, 0) || v <= 0 {
+			b.logger.Warnf("ignoring %s %v, it has to be a positive number", key, extra[key])
+			return def
+		}
+		return v
+	}
+
+	b.state.maxLinearAccel = limit("max_accel", b.state.maxLinearAccel)
+	b.state.maxLinearJerk = limit("max_jerk", b.state.maxLinearJerk)
+}
+
+// setControlStateInLock changes the control mode, resetting the pids if the mode changed
+// so we don't carry integral or derivative state over from the old goal. going between velocity
+// and heading the velocity pids keep running, so they pick up from the power they were at
+// instead of starting over from nothing.
+func (b *boat) setControlStateInLock(mode controlMode) {
+	if b.state.controlState == mode {
+		return
+	}
+	running := func(m controlMode) bool { return m == controlVelocity || m == controlHeading }
+	bumpless := running(b.state.controlState) && running(mode)
+
+	b.state.controlState = mode
+	if bumpless {
+		b.state.foldBias()
+		b.state.angularPID.Transfer()
+		b.state.linearPID.Transfer()
+		b.state.lateralPID.Transfer()
+	} else {
+		b.state.resetBias()
+		b.state.angularPID.Reset()
+		b.state.linearPID.Reset()
+		b.state.lateralPID.Reset()
+	}
+	b.state.northPID.Reset()
+	b.state.eastPID.Reset()
+	b.state.headingPID.Reset()
+}
+
+// setCompassGoalInLock sets the heading to hold. the learned bias is for the heading it was
+// learned at, so a new heading starts over.
+func (b *boat) setCompassGoalInLock(goal float64) {
+	if goal != b.state.compassGoal {
+		b.state.resetBias()
+	}
+	b.state.compassGoal = goal
+}
+
+// stopVelocityThread stops the control loop if it's running and waits for it to exit.
+// the next motion command starts it again.
+func (b *boat) stopVelocityThread() {
+	b.stateMutex.Lock()
+	b.stopVelocityThreadInLock()
+	b.stateMutex.Unlock()
+
+	b.waitGroup.Wait()
+}
+
+// stopVelocityThreadInLock tells the control loop to exit without waiting for it.
+// it's cancelled under the lock so a loop that's about to check doesn't miss it.
+func (b *boat) stopVelocityThreadInLock() {
+	if b.cancel != nil {
+		b.cancel()
+		b.cancel = nil
+	}
+	b.state.threadStarted = false
+}
+
+// stopIfIdle stops the control loop once it's had nothing to do for IdleStopSec, so an idle
+// boat doesn't keep polling the sensors. idleSince is when it last saw nothing to do.
+// returns true if the loop should exit.
+func (b *boat) stopIfIdle(ctx context.Context, idleSince *time.Time, now time.Time) bool {
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+
+	if ctx.Err() != nil {
+		return true
+	}
+
+	if b.cfg.IdleStopSec <= 0 || b.state.controlState != controlNone {
+		*idleSince = time.Time{}
+		return false
+	}
+
+	if idleSince.IsZero() {
+		*idleSince = now
+		return false
+	}
+
+	if now.Sub(*idleSince).Seconds() < b.cfg.IdleStopSec {
+		return false
+	}
+
+	b.logger.Debugf("control loop idle since %v, stopping it", *idleSince)
+	b.stopVelocityThreadInLock()
+	return true
 }
 
 func (b *boat) startVelocityThreadInLock() error {
@@ -168,53 +869,263 @@ func (b *boat) startVelocityThreadInLock() error {
 		return nil
 	}
 
-	if b.movementSensor == nil {
-		return errors.New("no movementSensor")
+	if b.headingSource() == nil || b.angularVelocitySource() == nil || b.linearVelocitySource() == nil {
+		return ErrNoMovementSensor
 	}
 
 	var ctx context.Context
 	ctx, b.cancel = context.WithCancel(context.Background())
+	loopTime := b.state.period()
 
 	b.waitGroup.Add(1)
 	go func() {
 		defer b.waitGroup.Done()
 
+		var idleSince time.Time
 		for {
-			utils.SelectContextOrWait(ctx, pidLoopTime)
+			if !utils.SelectContextOrWait(ctx, loopTime) {
+				return
+			}
+			if b.stopIfIdle(ctx, &idleSince, time.Now()) {
+				return
+			}
 			err := b.velocityThreadLoop(ctx)
 			if err != nil {
 				if errors.Is(err, context.Canceled) {
 					return
 				}
 				b.logger.Warn(err)
+				b.checkSensorTimeout(ctx)
 			}
 		}
 	}()
 	b.state.threadStarted = true
+	b.state.lastSensorRead = time.Now()
+
+	// if the loop was stopped for a while, the first dt shouldn't include the time it was off
+	b.state.lastLoopTime = time.Time{}
+	b.state.elapsed = 0
 	return nil
 }
 
-func (b *boat) velocityThreadLoop(ctx context.Context) error {
-	// TODO(erh) optimize how we get all sensor stuff
+// checkSensorTimeout stops the boat if we're controlling the motors, but haven't heard from the sensor in too long
+func (b *boat) checkSensorTimeout(ctx context.Context) {
+	if b.cfg.SensorTimeoutSec <= 0 {
+		return
+	}
+
+	b.stateMutex.Lock()
+	active := b.state.controlState != controlNone
+	since := time.Since(b.state.lastSensorRead)
+	b.stateMutex.Unlock()
 
-	av, err := b.movementSensor.AngularVelocity(ctx, make(map[string]interface{}))
+	if !active || since.Seconds() < b.cfg.SensorTimeoutSec {
+		return
+	}
+
+	b.logger.Errorf("no movement sensor readings in %v, stopping", since)
+	err := b.Stop(ctx, map[string]interface{}{"emergency": true})
 	if err != nil {
-		return err
+		b.logger.Warn(err)
+	}
+}
+
+// sensorReadings is everything the control loop needs from the movement sensor
+type sensorReadings struct {
+	linearVelocity  r3.Vector
+	angularVelocity spatialmath.AngularVelocity
+	heading         float64
+	position        *geo.Point
+}
+
+func (r *sensorReadings) valid() bool {
+	av := r.angularVelocity
+	return validVector(r.linearVelocity) && validVector(r3.Vector{X: av.X, Y: av.Y, Z: av.Z}) && validFloat(r.heading)
+}
+
+// deadReckon guesses the readings from the last good ones, for when the sensor drops out.
+// velocities are assumed to stay the same, and heading keeps turning at the last rate.
+// it gives up DeadReckoningSec after the last good reading.
+func (b *boat) deadReckon(now time.Time) (sensorReadings, bool) {
+	if b.cfg.DeadReckoningSec <= 0 {
+		return sensorReadings{}, false
+	}
+
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+
+	if b.state.lastSensorRead.IsZero() || now.Sub(b.state.lastSensorRead).Seconds() > b.cfg.DeadReckoningSec {
+		return sensorReadings{}, false
+	}
+
+	var dt time.Duration
+	if !b.state.lastLoopTime.IsZero() {
+		dt = now.Sub(b.state.lastLoopTime)
+	}
+
+	// positive angular z turns counterclockwise, which is a falling compass heading
+	return sensorReadings{
+		linearVelocity:  b.state.lastLinearVelocity,
+		angularVelocity: b.state.lastAngularVelocity,
+		heading:         rdkutils.ModAngDeg(b.state.lastHeading - b.state.lastAngularVelocity.Z*dt.Seconds()),
+	}, true
+}
+
+func (b *boat) headingSource() movementsensor.MovementSensor {
+	if b.headingSensor != nil {
+		return b.headingSensor
+	}
+	return b.movementSensor
+}
+
+func (b *boat) angularVelocitySource() movementsensor.MovementSensor {
+	if b.angularVelocitySensor != nil {
+		return b.angularVelocitySensor
 	}
+	return b.movementSensor
+}
+
+func (b *boat) linearVelocitySource() movementsensor.MovementSensor {
+	if b.linearVelocitySensor != nil {
+		return b.linearVelocitySensor
+	}
+	return b.movementSensor
+}
 
-	lv, err := b.movementSensor.LinearVelocity(ctx, make(map[string]interface{}))
+// readVelocities reads just the linear and angular velocity, for outside the control loop
+func (b *boat) readVelocities(ctx context.Context) (r3.Vector, float64, error) {
+	linear, err := b.linearVelocitySource().LinearVelocity(ctx, nil)
 	if err != nil {
+		return r3.Vector{}, 0, err
+	}
+	angular, err := b.readAngularVelocity(ctx, nil)
+	if err != nil {
+		return r3.Vector{}, 0, err
+	}
+	return linear, angular.Z, nil
+}
+
+// readSensors gets all the readings at once, so a slow one only costs its own time.
+// if any fail, the rest are cancelled. if ctx is done first it returns without waiting for them,
+// in case one doesn't pay attention to it.
+func (b *boat) readSensors(ctx context.Context, withPosition bool) (sensorReadings, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var r sensorReadings
+	var errLock sync.Mutex
+	var err error
+	var wg sync.WaitGroup
+
+	read := func(f func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if e := f(); e != nil {
+				errLock.Lock()
+				err = multierr.Combine(err, e)
+				errLock.Unlock()
+				cancel()
+			}
+		}()
+	}
+
+	read(func() (err error) {
+		r.angularVelocity, err = b.readAngularVelocity(ctx, make(map[string]interface{}))
+		return err
+	})
+	read(func() (err error) {
+		r.linearVelocity, err = b.linearVelocitySource().LinearVelocity(ctx, make(map[string]interface{}))
 		return err
+	})
+	read(func() (err error) {
+		r.heading, err = b.CurrentHeading(ctx)
+		return err
+	})
+	if withPosition {
+		read(func() (err error) {
+			if err := b.checkPosition(ctx); err != nil {
+				return err
+			}
+			r.position, _, err = b.movementSensor.Position(ctx, nil)
+			return err
+		})
 	}
 
-	heading, err := b.movementSensor.CompassHeading(ctx, nil)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return r, err
+	case <-parent.Done():
+		// anything still reading may write to r later, so none of it is used
+		errLock.Lock()
+		defer errLock.Unlock()
+		return sensorReadings{}, multierr.Combine(err, fmt.Errorf("movement sensor reading: %w", parent.Err()))
+	}
+}
+
+func (b *boat) velocityThreadLoop(ctx context.Context) error {
+	b.stateMutex.Lock()
+	mode := b.state.controlState
+	period := b.state.period()
+	b.stateMutex.Unlock()
+
+	fenced := len(b.cfg.Geofence) > 0 && mode != controlNone
+	withPosition := mode == controlPosition || fenced
+
+	readCtx, cancel := context.WithTimeout(ctx, sensorReadPeriods*period)
+	r, err := b.readSensors(readCtx, withPosition)
+	cancel()
+	if errors.Is(err, ErrPositionNotSupported) {
+		// without a position neither can be done, so don't go anywhere. anything else just
+		// means this reading failed.
+		return multierr.Combine(
+			fmt.Errorf("%w: holding position and the geofence need it", err),
+			b.Stop(ctx, map[string]interface{}{"emergency": true}),
+		)
+	}
+	if err == nil && !r.valid() {
+		err = fmt.Errorf("invalid movement sensor reading linear: %v angular: %v heading: %v", r.linearVelocity, r.angularVelocity, r.heading)
+	}
+
+	estimated := false
 	if err != nil {
-		return err
+		var ok bool
+		r, ok = b.deadReckon(time.Now())
+		if !ok {
+			// keep whatever we were doing until we get a good reading
+			return err
+		}
+		b.logger.Debugf("dead reckoning, heading: %v because: %v", r.heading, err)
+		estimated = true
+	}
+	lv, av, heading, position := r.linearVelocity, r.angularVelocity, r.heading, r.position
+
+	// there's no position while dead reckoning, so the fence can't be checked until the sensor is back
+	if fenced && !estimated && !insideGeofence(position, b.cfg.Geofence) {
+		return multierr.Combine(
+			fmt.Errorf("%w: at %v", ErrOutsideGeofence, position),
+			b.Stop(ctx, map[string]interface{}{"emergency": true}),
+		)
 	}
 
 	// ------
 
 	b.stateMutex.Lock()
+	b.state.markLoop(time.Now())
+	if !estimated {
+		b.state.lastSensorRead = time.Now()
+	}
+	b.state.lastLinearVelocity = lv
+	b.state.lastAngularVelocity = av
+	b.state.lastHeading = heading
+
 	if b.state.controlState == controlNone {
 		b.stateMutex.Unlock()
 		return nil
@@ -228,108 +1139,572 @@ func (b *boat) velocityThreadLoop(ctx context.Context) error {
 		updateVelocityGoalForHeading(&b.state, heading)
 		b.logger.Infof("heading control compass: %v goal: %v angular z: %v", heading, b.state.compassGoal, b.state.velocityAngularGoal.Z)
 		linear, angular = computeNextPower(&b.state, lv, av, b.logger)
+	} else if b.state.controlState == controlPosition && position != nil {
+		updateVelocityGoalForPosition(&b.state, position, heading)
+		b.logger.Debugf("position control at: %v goal: %v linear goal: %v", position, b.state.holdPoint, b.state.velocityLinearGoal)
+		linear, angular = computeNextPower(&b.state, lv, av, b.logger)
 	}
 
+	sample := b.newControlSampleInLock(time.Now(), estimated)
 	b.stateMutex.Unlock()
 
-	return b.setPowerInternal(ctx, linear, angular)
+	err = b.setPowerInternal(ctx, linear, angular, b.cfg.SlewControlLoop)
+
+	sample.LinearPower, sample.AngularPower, sample.Err = linear, angular, err
+	b.observe(sample)
+
+	return err
+}
+
+func validFloat(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+func validVector(v r3.Vector) bool {
+	return validFloat(v.X) && validFloat(v.Y) && validFloat(v.Z)
+}
+
+// angleDiffDeg is how many degrees it is from from to to, going the short way around, in [-180, 180]
+func angleDiffDeg(to, from float64) float64 {
+	diff := rdkutils.ModAngDeg(to - from)
+	if diff > 180 {
+		diff -= 360
+	}
+	return diff
 }
 
+// updateVelocityGoalForHeading turns toward the compass goal no faster than turnLimit, stopping
+// within headingDeadband. without the heading pid, it turns at that limit and slows down
+// proportionally within headingRamp degrees. diff is always the short way around, in [-180, 180],
+// so it's the same on either side of 0/360.
 func updateVelocityGoalForHeading(state *boatState, heading float64) {
-	diff := heading - state.compassGoal
-	if diff < -5 {
-		state.velocityAngularGoal.Z = -1 * state.spinVelocity
-	} else if diff > 5 {
-		state.velocityAngularGoal.Z = state.spinVelocity
-	} else if diff < -1 {
-		state.velocityAngularGoal.Z = (diff * -1 / 5) * state.spinVelocity
-	} else if diff > 1 {
-		state.velocityAngularGoal.Z = (diff / 5) * state.spinVelocity
+	diff := angleDiffDeg(heading, state.compassGoal)
+	if state.headingPIDControl {
+		updateVelocityGoalForHeadingPID(state, diff)
+		return
+	}
+
+	limit := state.turnLimit()
+	if math.Abs(diff) > state.headingRamp {
+		state.velocityAngularGoal.Z = math.Copysign(limit, diff)
+	} else if math.Abs(diff) > state.headingDeadband {
+		state.velocityAngularGoal.Z = (diff / state.headingRamp) * limit
 	} else {
 		state.velocityAngularGoal.Z = 0
 	}
 }
 
+// turnLimit is the fastest to turn toward the compass goal, 0 meaning no limit
+func (s *boatState) turnLimit() float64 {
+	limit := math.Abs(s.spinVelocity)
+	if s.maxAngularVelocity > 0 && (limit == 0 || limit > s.maxAngularVelocity) {
+		limit = s.maxAngularVelocity
+	}
+	return limit
+}
+
 func computeNextPower(
 	state *boatState,
 	linearVelocity r3.Vector,
 	angularVelocity spatialmath.AngularVelocity,
 	logger golog.Logger) (r3.Vector, r3.Vector) {
 
-	return r3.Vector{0, state.linearPID.Control(state.velocityLinearGoal.Y, linearVelocity.Y, pidLoopTime), 0},
-		r3.Vector{0, 0, state.angularPID.Control(state.velocityAngularGoal.Z, angularVelocity.Z, pidLoopTime)}
+	dt := state.dt()
+	state.rampGoals(dt)
+
+	linear, lp, li, ld := state.linearPID.ControlDebug(state.rampedLinearGoal.Y, linearVelocity.Y, dt)
+	angular, ap, ai, ad := state.angularPID.ControlDebug(state.rampedAngularGoal.Z, angularVelocity.Z, dt)
+
+	var lateral float64
+	if state.lateral {
+		var xp, xi, xd float64
+		lateral, xp, xi, xd = state.lateralPID.ControlDebug(state.rampedLinearGoal.X, linearVelocity.X, dt)
+		if logger != nil {
+			logger.Debugf("lateral pid out: %v p: %v i: %v d: %v", lateral, xp, xi, xd)
+		}
+	}
+
+	if logger != nil {
+		logger.Debugf("linear pid out: %v p: %v i: %v d: %v", linear, lp, li, ld)
+		logger.Debugf("angular pid out: %v p: %v i: %v d: %v", angular, ap, ai, ad)
+	}
+
+	linear, angular = state.applyBias(linearVelocity, angularVelocity, linear, angular, dt)
+
+	return r3.Vector{lateral, linear, 0}, r3.Vector{0, 0, angular}
 }
 
+// SetVelocity sets the goal the control loop drives toward. with extra["block"] = true it waits
+// until the boat is going that fast before returning, see waitForVelocity.
 func (b *boat) SetVelocity(ctx context.Context, linear, angular r3.Vector, extra map[string]interface{}) error {
 	b.logger.Debugf("SetVelocity %v %v", linear, angular)
-	_, done := b.opMgr.New(ctx)
+
+	linear = b.dropDisabledAxes("SetVelocity", linear)
+	linear, clamped := b.cfg.clampLinearVelocity(linear)
+	if clamped {
+		b.logger.Warnf("SetVelocity linear clamped to %v", linear)
+	}
+
+	angular.Z, clamped = b.cfg.clampAngularVelocity(angular.Z)
+	if clamped {
+		b.logger.Warnf("SetVelocity angular clamped to %v", angular)
+	}
+
+	if err := b.checkEStop(); err != nil {
+		return err
+	}
+
+	if _, err := b.checkBattery(ctx); err != nil {
+		return err
+	}
+
+	if extra["block"] == true && (b.linearVelocitySource() == nil || b.angularVelocitySource() == nil) {
+		return fmt.Errorf("%w: waiting for a velocity needs one", ErrNoMovementSensor)
+	}
+
+	if b.openLoop() {
+		if _, ok := extra["hold_heading"]; ok {
+			return fmt.Errorf("%w: hold_heading needs one", ErrNoMovementSensor)
+		}
+		return b.setVelocityOpenLoop(ctx, linear, angular)
+	}
+
+	opCtx, done := b.opMgr.New(ctx)
 	defer done()
 
 	b.stateMutex.Lock()
-	defer b.stateMutex.Unlock()
+	err := b.setVelocityGoalInLock(opCtx, linear, angular, extra)
+	b.stateMutex.Unlock()
+
+	if err != nil || extra["block"] != true {
+		return err
+	}
+	return b.waitForVelocity(ctx, opCtx, linear, angular, extra)
+}
+
+// setVelocityGoalInLock is the closed loop part of SetVelocity, opCtx is the SetVelocity operation
+func (b *boat) setVelocityGoalInLock(opCtx context.Context, linear, angular r3.Vector, extra map[string]interface{}) error {
+	// a newer command got in between New and here
+	if opCtx.Err() != nil {
+		return opCtx.Err()
+	}
 
 	err := b.startVelocityThreadInLock()
 	if err != nil {
 		return err
 	}
 
-	b.state.controlState = controlVelocity
+	if heading, ok := floatFromExtra(extra, "hold_heading"); ok {
+		// holding a heading takes precedence over an angular velocity goal, the angular
+		// velocity only sets how fast we're allowed to turn to correct
+		turnSpeed := math.Abs(angular.Z)
+		if turnSpeed == 0 {
+			turnSpeed = defaultHoldHeadingDegsPerSec
+			if b.cfg.MaxAngularVelocityDegPerSec > 0 {
+				turnSpeed = math.Min(turnSpeed, b.cfg.MaxAngularVelocityDegPerSec)
+			}
+		}
+
+		b.setControlStateInLock(controlHeading)
+		b.setRampLimitsInLock(extra)
+		b.setCompassGoalInLock(rdkutils.ModAngDeg(heading))
+		b.state.spinVelocity = turnSpeed
+		b.state.velocityLinearGoal = linear
+		b.state.velocityAngularGoal = r3.Vector{}
+		return nil
+	}
+
+	b.setControlStateInLock(controlVelocity)
+	b.setRampLimitsInLock(extra)
 	b.state.velocityLinearGoal = linear
 	b.state.velocityAngularGoal = angular
 
 	return nil
 }
 
+// dropDisabledAxes zeroes any sideways goal on a boat that doesn't move sideways, warning that from
+// is being ignored
+func (b *boat) dropDisabledAxes(from string, linear r3.Vector) r3.Vector {
+	if linear.X != 0 && !b.cfg.lateralEnabled() {
+		b.logger.Warnf("%s ignoring linear x %v, the boat doesn't move sideways", from, linear.X)
+		linear.X = 0
+	}
+	return linear
+}
+
+// SetPower drives the motors directly, with no control loop. linear x and y and angular z are each
+// -1 to 1, a fraction of the most all the motors together can push along that axis, so 1 is
+// everything forward, or starboard, or turning counterclockwise. anything past that is clamped,
+// and so is anything that would go faster than max_linear_velocity_mm_per_sec or
+// max_angular_velocity_degs_per_sec at the open loop full power speeds.
 func (b *boat) SetPower(ctx context.Context, linear, angular r3.Vector, extra map[string]interface{}) error {
 	b.logger.Debugf("SetPower %v %v", linear, angular)
+
+	linear = b.dropDisabledAxes("SetPower", linear)
+	linear, angular, clamped := b.cfg.clampPowerInput(linear, angular)
+	if clamped {
+		b.logger.Warnf("SetPower clamped to %v %v", linear, angular)
+	}
+
 	ctx, done := b.opMgr.New(ctx)
 	defer done()
 
 	b.stateMutex.Lock()
-	b.state.controlState = controlNone
+	b.setControlStateInLock(controlNone)
 	b.stateMutex.Unlock()
 
-	return b.setPowerInternal(ctx, linear, angular)
+	return b.setPowerInternal(ctx, linear, angular, true)
 }
 
-func (b *boat) setPowerInternal(ctx context.Context, linear, angular r3.Vector) error {
-	power, err := b.cfg.ComputePower(linear, angular)
+// setPowerInternal computes and sends the motor powers for linear and angular.
+// if slew is set and the config has a slew limit, the motors are walked there instead of jumping.
+func (b *boat) setPowerInternal(ctx context.Context, linear, angular r3.Vector, slew bool) error {
+	if err := b.checkEStop(); err != nil {
+		return err
+	}
+
+	power, err := b.solvePower(linear, angular)
+	if errors.Is(err, errPowerCount) {
+		// don't leave the motors doing whatever they were when we can't work out what they should
+		return multierr.Combine(err, b.Stop(ctx, map[string]interface{}{"emergency": true}))
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, p := range power {
+		if !validFloat(p) {
+			return fmt.Errorf("%w: computed invalid power %v for linear: %v angular: %v", ErrInfeasibleCommand, power, linear, angular)
+		}
+	}
+
+	residual, err := b.cfg.residual(linear, angular, power)
 	if err != nil {
 		return err
 	}
+	b.logger.Debugf("power %v for linear: %v angular: %v misses by %v", power, linear, angular, residual)
+	b.stateMutex.Lock()
+	b.state.lastResidual = residual
+	b.stateMutex.Unlock()
+
+	scale, err := b.checkBattery(ctx)
+	if err != nil {
+		return multierr.Combine(err, b.Stop(ctx, map[string]interface{}{"emergency": true}))
+	}
 
 	for idx, p := range power {
-		err := b.motors[idx].SetPower(ctx, p, nil)
+		power[idx] = b.cfg.Motors[idx].clampPower(p)
+	}
+
+	if b.cfg.SpinUpStaggerMs > 0 {
+		err = b.staggerStart(ctx, power, scale)
+	}
+	if err == nil && slew && b.cfg.PowerSlewPerSec > 0 {
+		err = b.slewTo(ctx, power, scale)
+	}
+	if err == nil {
+		err = b.sendPower(ctx, power, scale)
+	}
+	if errors.Is(err, errMotorFaulted) {
+		b.logger.Warnf("%v, solving again with the rest", err)
+		return b.setPowerInternal(ctx, linear, angular, slew)
+	}
+	return err
+}
+
+// sendPower sets each motor to power and remembers it as the last power sent. power is in
+// config order, and each motor is looked up by name. the motors are set at the same time so
+// slow ones don't hold up the rest.
+func (b *boat) sendPower(ctx context.Context, power []float64, scale float64) error {
+	out := map[string]float64{}
+	b.stateMutex.Lock()
+	for name, p := range b.cfg.powerByName(power) {
+		if b.motors[name] == nil {
+			b.stateMutex.Unlock()
+			return fmt.Errorf("no motor named %q", name)
+		}
+		if b.state.faultedMotors[name] {
+			continue
+		}
+		mc := b.cfg.motorConfig(name)
+		out[name] = mc.motorPower(mc.clampPower(p * scale))
+	}
+	b.stateMutex.Unlock()
+	b.cfg.limitTotalOutput(out)
+
+	if b.cfg.DryRun {
+		b.logger.Infof("dry run, not setting power %v", out)
+		b.stateMutex.Lock()
+		b.state.lastPower = power
+		b.stateMutex.Unlock()
+		return nil
+	}
+
+	// not held past sending, since handling a failure can Stop, which takes it too
+	b.powerMutex.Lock()
+	if err := b.checkEStop(); err != nil {
+		b.powerMutex.Unlock()
+		return err
+	}
+
+	var errLock sync.Mutex
+	var errs error
+	var failed []string
+	var wg sync.WaitGroup
+
+	for name, p := range out {
+		name, m, p := name, b.motors[name], p
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.SetPower(ctx, p, nil); err != nil {
+				errLock.Lock()
+				errs = multierr.Combine(errs, err)
+				failed = append(failed, name)
+				errLock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if errs == nil && ctx.Err() == nil {
+		b.stateMutex.Lock()
+		b.state.lastPower = power
+		b.stateMutex.Unlock()
+	}
+	b.powerMutex.Unlock()
+
+	if errs != nil && b.cfg.FaultTolerant && ctx.Err() == nil && b.faultMotors(failed) {
+		// make sure the failed motors aren't left running at their old power, if they'll listen
+		for _, name := range failed {
+			errs = multierr.Combine(errs, b.motors[name].Stop(ctx, nil))
+		}
+		return fmt.Errorf("%w: %v: %v", errMotorFaulted, failed, errs)
+	}
+	if errs != nil {
+		return multierr.Combine(b.Stop(ctx, map[string]interface{}{"emergency": true}), fmt.Errorf("%w: %v", ErrMotorFault, errs))
+	}
+	return ctx.Err()
+}
+
+// slewTo walks the motors from the last power sent towards target, moving each one at most
+// PowerSlewPerSec per second. it returns once the next step would reach target, which the
+// caller still has to send.
+func (b *boat) slewTo(ctx context.Context, target []float64, scale float64) error {
+	b.stateMutex.Lock()
+	current := append([]float64{}, b.state.lastPower...)
+	b.stateMutex.Unlock()
+
+	if len(current) != len(target) {
+		current = make([]float64, len(target))
+	}
+
+	maxStep := b.cfg.PowerSlewPerSec * powerRampStep.Seconds()
+
+	for {
+		next := make([]float64, len(target))
+		done := true
+		for idx := range target {
+			delta := target[idx] - current[idx]
+			if math.Abs(delta) > maxStep {
+				delta = math.Copysign(maxStep, delta)
+				done = false
+			}
+			next[idx] = current[idx] + delta
+		}
+
+		if done {
+			return nil
+		}
+
+		err := b.sendPower(ctx, next, scale)
 		if err != nil {
-			return multierr.Combine(b.Stop(ctx, nil), err)
+			return err
 		}
-		if ctx.Err() != nil {
+
+		if !utils.SelectContextOrWait(ctx, powerRampStep) {
 			return ctx.Err()
 		}
+		current = next
 	}
+}
+
+// staggerStart turns the motors on one at a time in config order, SpinUpStaggerMs apart, if
+// they're all stopped now. the last one is left for the caller to send.
+func (b *boat) staggerStart(ctx context.Context, target []float64, scale float64) error {
+	b.stateMutex.Lock()
+	current := append([]float64{}, b.state.lastPower...)
+	b.stateMutex.Unlock()
+
+	for _, p := range current {
+		if p != 0 {
+			return nil
+		}
+	}
+
+	starting := []int{}
+	for idx, p := range target {
+		if p != 0 {
+			starting = append(starting, idx)
+		}
+	}
+
+	next := make([]float64, len(target))
+	for i, idx := range starting {
+		if i == len(starting)-1 {
+			return nil
+		}
+		next[idx] = target[idx]
 
+		err := b.sendPower(ctx, append([]float64{}, next...), scale)
+		if err != nil {
+			return err
+		}
+
+		if !utils.SelectContextOrWait(ctx, time.Duration(b.cfg.SpinUpStaggerMs*float64(time.Millisecond))) {
+			return ctx.Err()
+		}
+	}
 	return nil
 }
 
+// Stop is safe to call from several places at once. each call cuts short any ramp down another
+// is doing, so power is never raised again after a Stop has stopped the motors.
 func (b *boat) Stop(ctx context.Context, extra map[string]interface{}) error {
+	// in a dry run the motors never had power, so there's nothing to ramp down
+	ramp := b.cfg.StopRampMs > 0 && extra["emergency"] != true && !b.cfg.DryRun
+
 	b.stateMutex.Lock()
+	b.setControlStateInLock(controlNone)
 	b.state.velocityLinearGoal = r3.Vector{}
 	b.state.velocityAngularGoal = r3.Vector{}
+	b.state.rampedLinearGoal = r3.Vector{}
+	b.state.rampedAngularGoal = r3.Vector{}
+	b.state.rampedLinearAccel = r3.Vector{}
+	lastPower := b.state.lastPower
+	b.state.lastPower = make([]float64, len(b.cfg.Motors))
+
+	if b.stopRampCancel != nil {
+		b.stopRampCancel()
+		b.stopRampCancel = nil
+	}
+	rampCtx := ctx
+	if ramp {
+		var cancel context.CancelFunc
+		rampCtx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		b.stopRampCancel = cancel
+		b.stopRamps++
+	}
 	b.stateMutex.Unlock()
 
 	b.opMgr.CancelRunning(ctx)
+
 	var err error
+	if ramp {
+		err = b.rampDown(rampCtx, lastPower, time.Duration(b.cfg.StopRampMs*float64(time.Millisecond)))
+		b.stateMutex.Lock()
+		b.stopRamps--
+		b.stateMutex.Unlock()
+	}
+
+	// after any ramp step that's being sent, so it can't come in after the stop
+	b.powerMutex.Lock()
+	defer b.powerMutex.Unlock()
 	for _, m := range b.motors {
 		err = multierr.Combine(m.Stop(ctx, nil), err)
 	}
 	return err
 }
 
+// rampDown lowers the motors from power to 0 over the ramp time, the caller still has to stop them.
+// it gives up without an error once ctx is done, which is how a newer Stop cuts it short.
+func (b *boat) rampDown(ctx context.Context, power []float64, ramp time.Duration) error {
+	steps := int(ramp / powerRampStep)
+	if steps < 1 {
+		steps = 1
+	}
+
+	step := func(scale float64) error {
+		b.powerMutex.Lock()
+		defer b.powerMutex.Unlock()
+		if ctx.Err() != nil || b.checkEStop() != nil {
+			return nil
+		}
+		for name, p := range b.cfg.powerByName(power) {
+			err := b.motors[name].SetPower(ctx, b.cfg.motorConfig(name).motorPower(p*scale), nil)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for s := 1; s < steps; s++ {
+		if err := step(1 - float64(s)/float64(steps)); err != nil {
+			return err
+		}
+		if !utils.SelectContextOrWait(ctx, ramp/time.Duration(steps)) {
+			return nil
+		}
+	}
+	return nil
+}
+
 func (b *boat) Width(ctx context.Context) (int, error) {
 	return int(b.cfg.WidthMM), nil
 }
 
+// Length is Width the other way, bow to stern. it isn't part of the base interface, so clients
+// get it from the dimensions command.
+func (b *boat) Length(ctx context.Context) (int, error) {
+	return int(b.cfg.LengthMM), nil
+}
+
+// Properties describes the boat's turning characteristics. It has the same fields as
+// base.Properties in newer versions of rdk, which the version we build against doesn't have yet.
+type Properties struct {
+	WidthMeters              float64
+	TurningRadiusMeters      float64
+	WheelCircumferenceMeters float64
+}
+
+// Properties reports a zero turning radius, since the boat can spin in place.
+func (b *boat) Properties(ctx context.Context, extra map[string]interface{}) (Properties, error) {
+	return Properties{
+		WidthMeters:              b.cfg.WidthMM / 1000,
+		TurningRadiusMeters:      0,
+		WheelCircumferenceMeters: 0,
+	}, nil
+}
+
+// Geometries returns a box the size of the hull, centered on the base.
+func (b *boat) Geometries(ctx context.Context, extra map[string]interface{}) ([]spatialmath.Geometry, error) {
+	box, err := spatialmath.NewBox(
+		spatialmath.NewZeroPose(),
+		r3.Vector{X: b.cfg.WidthMM, Y: b.cfg.LengthMM, Z: b.cfg.HeightMM},
+		b.Name().ShortName(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return []spatialmath.Geometry{box}, nil
+}
+
+// IsMoving is whether the boat is measurably moving if there's a movement sensor, since it can
+// be powered and holding still against a current, or coasting with no power. without one it's
+// whether any motor is powered.
 func (b *boat) IsMoving(ctx context.Context) (bool, error) {
+	if b.linearVelocitySource() != nil && b.angularVelocitySource() != nil {
+		linear, angular, err := b.readVelocities(ctx)
+		if err != nil {
+			return false, err
+		}
+		linearThreshold, angularThreshold := b.cfg.movingThresholds()
+		return linear.Norm() > linearThreshold || math.Abs(angular) > angularThreshold, nil
+	}
+
 	for _, m := range b.motors {
 		isMoving, _, err := m.IsPowered(ctx, nil)
 		if err != nil {
@@ -343,10 +1718,15 @@ func (b *boat) IsMoving(ctx context.Context) (bool, error) {
 }
 
 func (b *boat) Close(ctx context.Context) error {
-	if b.cancel != nil {
-		b.cancel()
-		b.cancel = nil
-		b.waitGroup.Wait()
-	}
+	b.release()
 	return b.Stop(ctx, nil)
 }
+
+// release stops everything the boat runs on its own and frees the optimizer, without sending
+// anything to the motors
+func (b *boat) release() {
+	b.stopKeepAlive()
+	b.stopVelocityThread()
+	b.SetControlObserver(nil)
+	b.optimizer.Close()
+}
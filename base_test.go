@@ -1,12 +1,26 @@
 package viamboatbase
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/edaniels/golog"
 	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
 	"go.viam.com/test"
 
+	"go.viam.com/rdk/components/base"
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/rdk/testutils/inject"
 )
 
 func TestComputeNextPower(t *testing.T) {
@@ -24,3 +38,1774 @@ func TestComputeNextPower(t *testing.T) {
 	)
 	test.That(t, a.Z, test.ShouldAlmostEqual, .588, .01)
 }
+
+func TestRampGoals(t *testing.T) {
+	state := &boatState{}
+	state.configure(&Config{MaxLinearAccelMMPerSec2: 100, MaxAngularAccelDegPerSec2: 10})
+	state.velocityLinearGoal = r3.Vector{Y: 1000}
+	state.velocityAngularGoal = r3.Vector{Z: -20}
+
+	for i := 1; i <= 4; i++ {
+		computeNextPower(state, r3.Vector{}, spatialmath.AngularVelocity{}, nil)
+		test.That(t, state.rampedLinearGoal.Y, test.ShouldAlmostEqual, 50*float64(i))
+		test.That(t, state.rampedAngularGoal.Z, test.ShouldAlmostEqual, -5*float64(i))
+	}
+
+	for i := 0; i < 100; i++ {
+		computeNextPower(state, r3.Vector{}, spatialmath.AngularVelocity{}, nil)
+	}
+	test.That(t, state.rampedLinearGoal.Y, test.ShouldAlmostEqual, 1000)
+	test.That(t, state.rampedAngularGoal.Z, test.ShouldAlmostEqual, -20)
+
+	// no limit goes right to the goal
+	state = &boatState{velocityLinearGoal: r3.Vector{Y: 1000}}
+	state.rampGoals(pidLoopTime)
+	test.That(t, state.rampedLinearGoal.Y, test.ShouldEqual, 1000)
+}
+
+func TestRampGoalsJerk(t *testing.T) {
+	state := &boatState{}
+	state.configure(&Config{MaxLinearAccelMMPerSec2: 100, MaxLinearJerkMMPerSec3: 100})
+	state.velocityLinearGoal = r3.Vector{Y: 1000}
+
+	// the acceleration grows by 100 mm/sec^2 every second until it hits the limit
+	expected := []float64{100, 200, 300, 400}
+	for _, e := range expected {
+		state.rampGoals(time.Second)
+		test.That(t, state.rampedLinearGoal.Y, test.ShouldAlmostEqual, e)
+	}
+	test.That(t, state.rampedLinearAccel.Y, test.ShouldAlmostEqual, 100)
+
+	for i := 0; i < 20; i++ {
+		state.rampGoals(time.Second)
+	}
+	test.That(t, state.rampedLinearGoal.Y, test.ShouldAlmostEqual, 1000)
+	test.That(t, state.rampedLinearAccel, test.ShouldResemble, r3.Vector{})
+
+	// with only a jerk limit, the acceleration keeps growing
+	state = &boatState{}
+	state.configure(&Config{MaxLinearJerkMMPerSec3: 100})
+	state.velocityLinearGoal = r3.Vector{Y: 1000}
+	expected = []float64{100, 300, 600, 1000}
+	for _, e := range expected {
+		state.rampGoals(time.Second)
+		test.That(t, state.rampedLinearGoal.Y, test.ShouldAlmostEqual, e)
+	}
+}
+
+func TestSetVelocityRampLimits(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000, MaxLinearAccelMMPerSec2: 100}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	b.movementSensor = (&fakeSensor{}).movementSensor()
+	defer b.Close(context.Background())
+
+	limits := func() (float64, float64) {
+		s := b.snapshotState()
+		return s.maxLinearAccel, s.maxLinearJerk
+	}
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 1000}, r3.Vector{}, map[string]interface{}{"max_accel": 200.0})
+	test.That(t, err, test.ShouldBeNil)
+	accel, jerk := limits()
+	test.That(t, accel, test.ShouldEqual, 200)
+	test.That(t, jerk, test.ShouldEqual, 0)
+
+	b.stateMutex.Lock()
+	b.state.rampGoals(500 * time.Millisecond)
+	test.That(t, b.state.rampedLinearGoal.Y, test.ShouldAlmostEqual, 100)
+	b.stateMutex.Unlock()
+
+	// only for that command
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 1000}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	accel, _ = limits()
+	test.That(t, accel, test.ShouldEqual, 100)
+
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 1000}, r3.Vector{}, map[string]interface{}{"max_jerk": 50})
+	test.That(t, err, test.ShouldBeNil)
+	accel, jerk = limits()
+	test.That(t, accel, test.ShouldEqual, 100)
+	test.That(t, jerk, test.ShouldEqual, 50)
+
+	// nonsense falls back to the config
+	for _, v := range []interface{}{-5.0, 0, math.NaN(), math.Inf(1), "fast"} {
+		err = b.SetVelocity(context.Background(), r3.Vector{Y: 1000}, r3.Vector{}, map[string]interface{}{"max_accel": v, "max_jerk": v})
+		test.That(t, err, test.ShouldBeNil)
+		accel, jerk = limits()
+		test.That(t, accel, test.ShouldEqual, 100)
+		test.That(t, jerk, test.ShouldEqual, 0)
+	}
+}
+
+func TestAngleDiffDeg(t *testing.T) {
+	test.That(t, angleDiffDeg(10, 350), test.ShouldAlmostEqual, 20)
+	test.That(t, angleDiffDeg(350, 10), test.ShouldAlmostEqual, -20)
+	test.That(t, angleDiffDeg(90, 45), test.ShouldAlmostEqual, 45)
+	test.That(t, angleDiffDeg(0, 270), test.ShouldAlmostEqual, 90)
+	test.That(t, angleDiffDeg(5, 5), test.ShouldAlmostEqual, 0)
+}
+
+func TestHeadingGoalShortestDirection(t *testing.T) {
+	turn := func(heading, goal float64) float64 {
+		state := &boatState{compassGoal: goal, spinVelocity: 10}
+		updateVelocityGoalForHeading(state, heading)
+		return state.velocityAngularGoal.Z
+	}
+
+	// crossing 0/360 should turn the same way as the equivalent turn that doesn't cross
+	test.That(t, turn(350, 10), test.ShouldEqual, turn(0, 20))
+	test.That(t, turn(10, 350), test.ShouldEqual, turn(20, 0))
+	test.That(t, turn(350, 10), test.ShouldEqual, -10)
+	test.That(t, turn(10, 350), test.ShouldEqual, 10)
+}
+
+func TestHeadingGoalRampAcrossZero(t *testing.T) {
+	turn := func(heading, goal float64) float64 {
+		state := &boatState{}
+		state.configure(&Config{HeadingControl: "ramp"})
+		state.compassGoal = goal
+		state.spinVelocity = 10
+		updateVelocityGoalForHeading(state, heading)
+		return state.velocityAngularGoal.Z
+	}
+
+	// in the ramp, the sign matches the full speed turn on the same side
+	test.That(t, turn(357, 0), test.ShouldAlmostEqual, -6)
+	test.That(t, turn(3, 0), test.ShouldAlmostEqual, 6)
+	test.That(t, turn(358, 1), test.ShouldAlmostEqual, -6)
+	test.That(t, turn(2, 359), test.ShouldAlmostEqual, 6)
+	test.That(t, turn(350, 0), test.ShouldEqual, -10)
+	test.That(t, turn(10, 0), test.ShouldEqual, 10)
+
+	// inside the deadband on either side of 0
+	test.That(t, turn(359.5, 0.2), test.ShouldEqual, 0)
+	test.That(t, turn(0.2, 359.5), test.ShouldEqual, 0)
+
+	// the ramp is the same as away from the boundary
+	test.That(t, turn(357, 0), test.ShouldAlmostEqual, turn(87, 90))
+	test.That(t, turn(3, 0), test.ShouldAlmostEqual, turn(93, 90))
+}
+
+func TestHeadingGoalRampConfigured(t *testing.T) {
+	deadband, ramp := 3.0, 20.0
+	state := &boatState{}
+	state.configure(&Config{HeadingControl: "ramp", HeadingDeadbandDeg: &deadband, HeadingRampDeg: &ramp})
+	state.spinVelocity = 10
+
+	turn := func(heading float64) float64 {
+		state.compassGoal = 100
+		updateVelocityGoalForHeading(state, heading)
+		return state.velocityAngularGoal.Z
+	}
+
+	// full speed only outside 20 degrees now
+	test.That(t, turn(130), test.ShouldEqual, 10)
+	test.That(t, turn(110), test.ShouldAlmostEqual, 5)
+	test.That(t, turn(90), test.ShouldAlmostEqual, -5)
+	test.That(t, turn(104), test.ShouldAlmostEqual, 2)
+	test.That(t, turn(102), test.ShouldEqual, 0)
+	test.That(t, turn(98), test.ShouldEqual, 0)
+
+	// with no deadband it only stops right on the goal
+	deadband = 0
+	state.configure(&Config{HeadingControl: "ramp", HeadingDeadbandDeg: &deadband, HeadingRampDeg: &ramp})
+	test.That(t, turn(101), test.ShouldAlmostEqual, .5)
+}
+
+func TestControlStateResetsPID(t *testing.T) {
+	b := &boat{}
+	b.state.angularPID.setDefaults()
+	b.state.linearPID.setDefaults()
+
+	b.setControlStateInLock(controlVelocity)
+	b.state.angularPID.Control(5, 0, pidLoopTime)
+	b.state.linearPID.Control(5, 0, pidLoopTime)
+
+	// same mode keeps state
+	b.setControlStateInLock(controlVelocity)
+	test.That(t, b.state.angularPID.integral, test.ShouldNotEqual, 0)
+	test.That(t, b.state.linearPID.integral, test.ShouldNotEqual, 0)
+
+	b.setControlStateInLock(controlHeading)
+	test.That(t, b.state.controlState, test.ShouldEqual, controlHeading)
+	test.That(t, b.state.angularPID.integral, test.ShouldEqual, 0)
+	test.That(t, b.state.linearPID.integral, test.ShouldEqual, 0)
+	test.That(t, b.state.angularPID.previousError, test.ShouldEqual, 0)
+}
+
+// fakeMotors are injected motors that remember the last power they were set to
+type fakeMotors struct {
+	mu      sync.Mutex
+	motors  []*inject.Motor
+	powers  []float64
+	history [][]float64   // every power each motor was set to
+	delay   time.Duration // how long each SetPower takes
+}
+
+func newFakeMotors(n int) *fakeMotors {
+	fm := &fakeMotors{powers: make([]float64, n), history: make([][]float64, n)}
+	for idx := 0; idx < n; idx++ {
+		idx := idx
+		m := inject.NewMotor(fmt.Sprintf("m%d", idx))
+		m.SetPowerFunc = func(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
+			time.Sleep(fm.delay)
+			fm.mu.Lock()
+			defer fm.mu.Unlock()
+			fm.powers[idx] = powerPct
+			fm.history[idx] = append(fm.history[idx], powerPct)
+			return nil
+		}
+		m.StopFunc = func(ctx context.Context, extra map[string]interface{}) error {
+			fm.mu.Lock()
+			defer fm.mu.Unlock()
+			fm.powers[idx] = 0
+			return nil
+		}
+		m.IsPoweredFunc = func(ctx context.Context, extra map[string]interface{}) (bool, float64, error) {
+			fm.mu.Lock()
+			defer fm.mu.Unlock()
+			return fm.powers[idx] != 0, math.Abs(fm.powers[idx]), nil
+		}
+		m.PropertiesFunc = func(ctx context.Context, extra map[string]interface{}) (map[motor.Feature]bool, error) {
+			return map[motor.Feature]bool{}, nil
+		}
+		fm.motors = append(fm.motors, m)
+	}
+	return fm
+}
+
+func (fm *fakeMotors) get() []float64 {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	return append([]float64{}, fm.powers...)
+}
+
+func newTestBoat(t *testing.T, cfg *Config, fm *fakeMotors) *boat {
+	b := &boat{
+		Named:  base.Named("boat").AsNamed(),
+		cfg:    cfg,
+		logger: golog.NewTestLogger(t),
+	}
+	b.motors = map[string]motor.Motor{}
+	for idx, mc := range cfg.Motors {
+		b.motors[mc.Name] = fm.motors[idx]
+	}
+	b.state.configure(cfg)
+	return b
+}
+
+func TestSetPowerClampsInput(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	b.solver = PseudoInverseSolver{}
+
+	checkPower := func(linear, angular r3.Vector, port, starboard float64) {
+		t.Helper()
+		test.That(t, b.SetPower(context.Background(), linear, angular, nil), test.ShouldBeNil)
+		powers := fm.get()
+		test.That(t, powers[0], test.ShouldAlmostEqual, port, 1e-9)
+		test.That(t, powers[1], test.ShouldAlmostEqual, starboard, 1e-9)
+	}
+
+	// past -1..1 is the same as 1
+	checkPower(r3.Vector{Y: 3}, r3.Vector{}, 1, 1)
+	checkPower(r3.Vector{Y: -2}, r3.Vector{}, -1, -1)
+	checkPower(r3.Vector{}, r3.Vector{Z: -5}, -1, 1)
+
+	// full power is 2000 mm/s and 90 degs/sec, but the boat is only allowed half that
+	cfg.OpenLoopLinearMMPerSec = 2000
+	cfg.OpenLoopAngularDegPerSec = 90
+	cfg.MaxLinearVelocityMMPerSec = 1000
+	cfg.MaxAngularVelocityDegPerSec = 45
+	checkPower(r3.Vector{Y: 1}, r3.Vector{}, .5, .5)
+	checkPower(r3.Vector{Y: .25}, r3.Vector{}, .25, .25)
+	checkPower(r3.Vector{}, r3.Vector{Z: 1}, .5, -.5)
+
+	// linear keeps its direction
+	linear, _, clamped := cfg.clampPowerInput(r3.Vector{X: 1, Y: 2}, r3.Vector{})
+	test.That(t, clamped, test.ShouldBeTrue)
+	test.That(t, linear.X, test.ShouldAlmostEqual, .25)
+	test.That(t, linear.Y, test.ShouldAlmostEqual, .5)
+
+	_, _, clamped = cfg.clampPowerInput(r3.Vector{Y: .5}, r3.Vector{Z: -.5})
+	test.That(t, clamped, test.ShouldBeFalse)
+}
+
+func TestForwardOnlyIgnoresLateral(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	test.That(t, cfg.lateralEnabled(), test.ShouldBeFalse)
+
+	// sideways doesn't take away from forward
+	test.That(t, cfg.computeGoal(r3.Vector{X: .5, Y: .5}, r3.Vector{}), test.ShouldResemble, cfg.computeGoal(r3.Vector{Y: .5}, r3.Vector{}))
+
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	logger, logs := golog.NewObservedTestLogger(t)
+	b.logger = logger
+	b.solver = PseudoInverseSolver{}
+
+	err := b.SetPower(context.Background(), r3.Vector{X: .5, Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	powers := fm.get()
+	test.That(t, powers[0], test.ShouldAlmostEqual, .5, 1e-9)
+	test.That(t, powers[1], test.ShouldAlmostEqual, .5, 1e-9)
+	test.That(t, logs.FilterMessageSnippet("doesn't move sideways").Len(), test.ShouldEqual, 1)
+
+	b.movementSensor = (&fakeSensor{}).movementSensor()
+	defer b.Close(context.Background())
+	err = b.SetVelocity(context.Background(), r3.Vector{X: 300, Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.snapshotState().velocityLinearGoal, test.ShouldResemble, r3.Vector{Y: 500})
+	test.That(t, logs.FilterMessageSnippet("doesn't move sideways").Len(), test.ShouldEqual, 2)
+
+	// a boat that can go sideways can have it turned off
+	lateral := &Config{Motors: testMotorConfig, LengthMM: 500, WidthMM: 500}
+	test.That(t, lateral.lateralEnabled(), test.ShouldBeTrue)
+	test.That(t, lateral.computeGoal(r3.Vector{X: .5}, r3.Vector{}).linearX, test.ShouldBeGreaterThan, 0)
+	lateral.DisableLateral = true
+	test.That(t, lateral.lateralEnabled(), test.ShouldBeFalse)
+	test.That(t, lateral.computeGoal(r3.Vector{X: .5}, r3.Vector{}).linearX, test.ShouldEqual, 0)
+}
+
+func TestSetPowerMotorLimits(t *testing.T) {
+	max := .5
+	cfg := &Config{
+		Motors: []MotorConfig{
+			{Name: "port", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1, MaxPower: &max},
+			{Name: "starboard", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1},
+		},
+		LengthMM: 3048,
+		WidthMM:  1100,
+	}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: 1}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	powers := fm.get()
+	test.That(t, powers[0], test.ShouldBeLessThanOrEqualTo, .5)
+	test.That(t, powers[1], test.ShouldAlmostEqual, 1, testTheta)
+}
+
+func TestSetPowerReversedMotor(t *testing.T) {
+	cfg := &Config{
+		Motors: []MotorConfig{
+			{Name: "port", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1, Reversed: true},
+			{Name: "starboard", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1},
+		},
+		LengthMM: 3048,
+		WidthMM:  1100,
+	}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: 1}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	powers := fm.get()
+	test.That(t, powers[0], test.ShouldAlmostEqual, -1, testTheta)
+	test.That(t, powers[1], test.ShouldAlmostEqual, 1, testTheta)
+
+	// the state still reports what we wanted in thrust terms
+	test.That(t, b.snapshotState().lastPower[0], test.ShouldAlmostEqual, 1, testTheta)
+}
+
+func TestSetPowerByMotorName(t *testing.T) {
+	port := MotorConfig{Name: "port", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1}
+	starboard := MotorConfig{Name: "starboard", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1}
+
+	// turning, so the two motors get different power
+	powers := func(motors ...MotorConfig) map[string]float64 {
+		cfg := &Config{Motors: motors, LengthMM: 3048, WidthMM: 1100}
+		fm := newFakeMotors(2)
+		b := newTestBoat(t, cfg, fm)
+		b.motors = map[string]motor.Motor{"port": fm.motors[0], "starboard": fm.motors[1]}
+
+		err := b.SetPower(context.Background(), r3.Vector{Y: .2}, r3.Vector{Z: .5}, nil)
+		test.That(t, err, test.ShouldBeNil)
+		p := fm.get()
+		return map[string]float64{"port": p[0], "starboard": p[1]}
+	}
+
+	inOrder := powers(port, starboard)
+	test.That(t, inOrder["port"], test.ShouldNotAlmostEqual, inOrder["starboard"])
+
+	reordered := powers(starboard, port)
+	test.That(t, reordered["port"], test.ShouldAlmostEqual, inOrder["port"], testTheta)
+	test.That(t, reordered["starboard"], test.ShouldAlmostEqual, inOrder["starboard"], testTheta)
+}
+
+// fakeSensor is an injected movement sensor whose readings can be changed by the test
+type fakeSensor struct {
+	mu              sync.Mutex
+	heading         float64
+	linearVelocity  r3.Vector
+	angularVelocity spatialmath.AngularVelocity
+
+	// if position is set, position is supported, and it's moved by positionStepMM north every time it's read
+	position       *geo.Point
+	positionStepMM float64
+
+	// if set, every reading fails with this
+	err error
+
+	// if set, every reading takes this long
+	delay time.Duration
+
+	// if set, every reading waits for it to be closed, whatever its ctx says
+	hang chan struct{}
+
+	// how many readings have been asked for
+	reads int
+}
+
+func (fs *fakeSensor) set(heading float64, lv r3.Vector, av spatialmath.AngularVelocity) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.heading = heading
+	fs.linearVelocity = lv
+	fs.angularVelocity = av
+}
+
+func (fs *fakeSensor) wait() {
+	fs.mu.Lock()
+	delay, hang := fs.delay, fs.hang
+	fs.reads++
+	fs.mu.Unlock()
+	time.Sleep(delay)
+	if hang != nil {
+		<-hang
+	}
+}
+
+func (fs *fakeSensor) movementSensor() *inject.MovementSensor {
+	ms := inject.NewMovementSensor("ms")
+	ms.CompassHeadingFunc = func(ctx context.Context, extra map[string]interface{}) (float64, error) {
+		fs.wait()
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		if fs.err != nil {
+			return 0, fs.err
+		}
+		return fs.heading, nil
+	}
+	ms.LinearVelocityFunc = func(ctx context.Context, extra map[string]interface{}) (r3.Vector, error) {
+		fs.wait()
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		if fs.err != nil {
+			return r3.Vector{}, fs.err
+		}
+		return fs.linearVelocity, nil
+	}
+	ms.PositionFunc = func(ctx context.Context, extra map[string]interface{}) (*geo.Point, float64, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		if fs.position == nil {
+			return nil, 0, errors.New("no position")
+		}
+		p := fs.position
+		fs.position = p.PointAtDistanceAndBearing(fs.positionStepMM/1000/1000, 0)
+		return p, 0, nil
+	}
+	ms.PropertiesFunc = func(ctx context.Context, extra map[string]interface{}) (*movementsensor.Properties, error) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		return &movementsensor.Properties{
+			LinearVelocitySupported:  true,
+			AngularVelocitySupported: true,
+			CompassHeadingSupported:  true,
+			PositionSupported:        fs.position != nil,
+		}, nil
+	}
+	ms.AngularVelocityFunc = func(ctx context.Context, extra map[string]interface{}) (spatialmath.AngularVelocity, error) {
+		fs.wait()
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		if fs.err != nil {
+			return spatialmath.AngularVelocity{}, fs.err
+		}
+		return fs.angularVelocity, nil
+	}
+	return ms
+}
+
+// concurrentSensor calls straight through to the inject funcs, since the inject sensor
+// remembers the last extra it was called with, which races when reads overlap
+type concurrentSensor struct {
+	*inject.MovementSensor
+}
+
+func (ms concurrentSensor) CompassHeading(ctx context.Context, extra map[string]interface{}) (float64, error) {
+	return ms.CompassHeadingFunc(ctx, extra)
+}
+
+func (ms concurrentSensor) LinearVelocity(ctx context.Context, extra map[string]interface{}) (r3.Vector, error) {
+	return ms.LinearVelocityFunc(ctx, extra)
+}
+
+func (ms concurrentSensor) AngularVelocity(ctx context.Context, extra map[string]interface{}) (spatialmath.AngularVelocity, error) {
+	return ms.AngularVelocityFunc(ctx, extra)
+}
+
+func (ms concurrentSensor) Position(ctx context.Context, extra map[string]interface{}) (*geo.Point, float64, error) {
+	return ms.PositionFunc(ctx, extra)
+}
+
+func (ms concurrentSensor) Properties(ctx context.Context, extra map[string]interface{}) (*movementsensor.Properties, error) {
+	return ms.PropertiesFunc(ctx, extra)
+}
+
+var testTwoMotorConfig = []MotorConfig{
+	{Name: "port", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1},
+	{Name: "starboard", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1},
+}
+
+func TestSetVelocityClamped(t *testing.T) {
+	cfg := &Config{
+		Motors:                      testTwoMotorConfig,
+		LengthMM:                    3048,
+		WidthMM:                     1100,
+		MaxLinearVelocityMMPerSec:   1000,
+		MaxAngularVelocityDegPerSec: 20,
+	}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	b.movementSensor = (&fakeSensor{}).movementSensor()
+	defer b.Close(context.Background())
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 5000}, r3.Vector{Z: -100}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	st := b.snapshotState()
+	test.That(t, st.velocityLinearGoal.Y, test.ShouldAlmostEqual, 1000)
+	test.That(t, st.velocityAngularGoal.Z, test.ShouldAlmostEqual, -20)
+}
+
+func TestProperties(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+
+	props, err := b.Properties(context.Background(), nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, props.WidthMeters, test.ShouldAlmostEqual, 1.1)
+	test.That(t, props.TurningRadiusMeters, test.ShouldEqual, 0)
+}
+
+func TestGeometries(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, HeightMM: 400}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+
+	geoms, err := b.Geometries(context.Background(), nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(geoms), test.ShouldEqual, 1)
+
+	dims := geoms[0].ToProtobuf().GetBox().GetDimsMm()
+	test.That(t, dims.X, test.ShouldAlmostEqual, 1100)
+	test.That(t, dims.Y, test.ShouldAlmostEqual, 3048)
+	test.That(t, dims.Z, test.ShouldAlmostEqual, 400)
+	test.That(t, geoms[0].Pose().Point(), test.ShouldResemble, r3.Vector{})
+}
+
+func TestMoveStraightPosition(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	start := geo.NewPoint(40.7, -73.9)
+	fs := &fakeSensor{position: start, positionStepMM: 100}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	err := b.MoveStraight(context.Background(), 1000, 500, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	fs.mu.Lock()
+	traveled := kmToMM(start.GreatCircleDistance(fs.position))
+	fs.mu.Unlock()
+
+	// we stop on the first reading at or past the goal, and then one more step is taken by the next read
+	test.That(t, traveled, test.ShouldBeBetweenOrEqual, 1000, 1200)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+}
+
+func TestMoveStraightLateral(t *testing.T) {
+	cfg := &Config{Motors: testMotorConfig, LengthMM: 500, WidthMM: 500, ControlLoopMs: 60000}
+	fm := newFakeMotors(len(cfg.Motors))
+	b := newTestBoat(t, cfg, fm)
+	b.solver = PseudoInverseSolver{}
+
+	// read by MoveStraight and the loop run below at the same time
+	b.movementSensor = concurrentSensor{(&fakeSensor{}).movementSensor()}
+	defer b.Close(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- b.MoveStraight(ctx, 5000, 200, map[string]interface{}{"direction": 90.0})
+	}()
+
+	var goal r3.Vector
+	for start := time.Now(); time.Since(start) < 3*time.Second && goal.Norm() == 0; {
+		time.Sleep(10 * time.Millisecond)
+		goal = b.snapshotState().velocityLinearGoal
+	}
+	test.That(t, goal.X, test.ShouldAlmostEqual, 200)
+	test.That(t, goal.Y, test.ShouldAlmostEqual, 0)
+
+	// and the control loop pushes the boat sideways toward it
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	out, err := cfg.ComputePowerOutput(fm.get())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, out.linearX, test.ShouldBeGreaterThan, .01)
+	test.That(t, out.linearY, test.ShouldAlmostEqual, 0, 1e-3)
+
+	cancel()
+	test.That(t, <-done, test.ShouldBeNil)
+	test.That(t, b.snapshotState().velocityLinearGoal, test.ShouldResemble, r3.Vector{})
+
+	// backwards distance goes the other way
+	test.That(t, moveStraightVelocity(-200, map[string]interface{}{"direction": 90}).X, test.ShouldAlmostEqual, -200)
+	test.That(t, moveStraightVelocity(200, nil), test.ShouldResemble, r3.Vector{Y: 200})
+}
+
+func TestMoveStraightOdometry(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	// going much faster than asked, so it gets there long before the 2 seconds it should take
+	fs := &fakeSensor{linearVelocity: r3.Vector{Y: 2000}}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	start := time.Now()
+	err := b.MoveStraight(context.Background(), 200, 100, map[string]interface{}{"poll_ms": 5})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, time.Since(start), test.ShouldBeBetween, 90*time.Millisecond, time.Second)
+	test.That(t, b.snapshotState().controlState, test.ShouldEqual, controlNone)
+
+	// going the wrong way doesn't count
+	fs.set(0, r3.Vector{Y: -2000}, spatialmath.AngularVelocity{})
+	err = b.MoveStraight(context.Background(), 200, 100, map[string]interface{}{"poll_ms": 5, "stall_sec": .1})
+	test.That(t, errors.Is(err, ErrNoProgress), test.ShouldBeTrue)
+}
+
+func TestMoveStraightStall(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	// aground, with the motors running and not going anywhere
+	start := geo.NewPoint(40.7, -73.9)
+	b.movementSensor = (&fakeSensor{position: start}).movementSensor()
+	defer b.Close(context.Background())
+
+	began := time.Now()
+	err := b.MoveStraight(context.Background(), 10000, 500, map[string]interface{}{"poll_ms": 5, "stall_sec": .1})
+	test.That(t, errors.Is(err, ErrNoProgress), test.ShouldBeTrue)
+	test.That(t, time.Since(began), test.ShouldBeLessThan, time.Second)
+	test.That(t, b.snapshotState().controlState, test.ShouldEqual, controlNone)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+
+	// slow, but getting there, runs out of time instead
+	b.movementSensor = (&fakeSensor{linearVelocity: r3.Vector{Y: 100}}).movementSensor()
+	err = b.MoveStraight(context.Background(), 10000, 500, map[string]interface{}{"poll_ms": 5, "timeout_sec": .1})
+	test.That(t, errors.Is(err, ErrMoveStraightTimeout), test.ShouldBeTrue)
+	test.That(t, err.Error(), test.ShouldStartWith, "move straight timed out")
+	test.That(t, b.snapshotState().controlState, test.ShouldEqual, controlNone)
+}
+
+func TestMoveStraightOpenLoopTime(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	// with nothing to measure with it runs for as long as it should take at that speed
+	start := time.Now()
+	err := b.MoveStraight(context.Background(), 100, 500, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, time.Since(start), test.ShouldBeBetween, 190*time.Millisecond, time.Second)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+}
+
+func TestCurrentHeadingAndPosition(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+
+	_, err := b.CurrentHeading(context.Background())
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = b.CurrentPosition(context.Background())
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// no position support
+	fs := &fakeSensor{heading: 45}
+	b.movementSensor = fs.movementSensor()
+	h, err := b.CurrentHeading(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, h, test.ShouldEqual, 45)
+	_, err = b.CurrentPosition(context.Background())
+	test.That(t, err, test.ShouldNotBeNil)
+
+	fs.mu.Lock()
+	fs.position = geo.NewPoint(40.7, -73.9)
+	fs.mu.Unlock()
+	p, err := b.CurrentPosition(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, p.Lat(), test.ShouldEqual, 40.7)
+	test.That(t, p.Lng(), test.ShouldEqual, -73.9)
+
+	// a separate heading sensor wins
+	b.headingSensor = (&fakeSensor{heading: 200}).movementSensor()
+	h, err = b.CurrentHeading(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, h, test.ShouldEqual, 200)
+}
+
+func TestSpinTimeout(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, SpinTimeoutSec: .2}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	// the heading never changes, so we never get there
+	b.movementSensor = (&fakeSensor{heading: 10}).movementSensor()
+	defer b.Close(context.Background())
+
+	start := time.Now()
+	err := b.Spin(context.Background(), 90, 10, nil)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "spin timed out, didn't get within")
+	test.That(t, time.Since(start), test.ShouldBeLessThan, time.Second)
+
+	// a large enough tolerance succeeds right away
+	err = b.Spin(context.Background(), 90, 10, map[string]interface{}{"tolerance_deg": 100.0})
+	test.That(t, err, test.ShouldBeNil)
+}
+
+func TestSpinReturnsPromptly(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000, SpinPollMs: 10}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	fs := &fakeSensor{heading: 10}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	// gets there shortly after starting
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		fs.set(100, r3.Vector{}, spatialmath.AngularVelocity{})
+	}()
+
+	start := time.Now()
+	err := b.Spin(context.Background(), 90, 10, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, time.Since(start), test.ShouldBeLessThan, 500*time.Millisecond)
+
+	test.That(t, (&Config{}).spinPollTime(), test.ShouldEqual, defaultSpinPollTime)
+}
+
+func TestSetVelocityHoldHeading(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	// sitting still, pointed 90 degrees left of where we want to be
+	fs := &fakeSensor{heading: 0}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{Z: 50}, map[string]interface{}{"hold_heading": 90.0})
+	test.That(t, err, test.ShouldBeNil)
+
+	err = b.velocityThreadLoop(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+
+	st := b.snapshotState()
+	test.That(t, st.controlState, test.ShouldEqual, controlHeading)
+	test.That(t, st.compassGoal, test.ShouldEqual, 90)
+	test.That(t, st.velocityLinearGoal.Y, test.ShouldEqual, 500)
+	// the angular velocity only limits how fast we turn
+	test.That(t, st.velocityAngularGoal.Z, test.ShouldEqual, -50)
+
+	// driving forward, and turning toward the heading
+	powers := fm.get()
+	test.That(t, powers[0]+powers[1], test.ShouldBeGreaterThan, 0)
+	test.That(t, powers[1], test.ShouldBeGreaterThan, powers[0])
+
+	// once on heading, just go straight
+	fs.set(90, r3.Vector{Y: 500}, spatialmath.AngularVelocity{})
+	err = b.velocityThreadLoop(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	st = b.snapshotState()
+	test.That(t, st.velocityAngularGoal.Z, test.ShouldEqual, 0)
+}
+
+func TestStopRamp(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, StopRampMs: 200}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: 1}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	err = b.Stop(context.Background(), nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+
+	fm.mu.Lock()
+	history := append([]float64{}, fm.history[0]...)
+	fm.mu.Unlock()
+
+	// full power, then steadily down, then stopped
+	test.That(t, len(history), test.ShouldBeGreaterThan, 2)
+	test.That(t, history[0], test.ShouldAlmostEqual, 1, testTheta)
+	for idx := 1; idx < len(history); idx++ {
+		test.That(t, history[idx], test.ShouldBeLessThan, history[idx-1])
+		test.That(t, history[idx], test.ShouldBeGreaterThan, 0)
+	}
+
+	// emergency skips the ramp
+	err = b.SetPower(context.Background(), r3.Vector{Y: 1}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	fm.mu.Lock()
+	before := len(fm.history[0])
+	fm.mu.Unlock()
+
+	err = b.Stop(context.Background(), map[string]interface{}{"emergency": true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+	fm.mu.Lock()
+	test.That(t, len(fm.history[0]), test.ShouldEqual, before)
+	fm.mu.Unlock()
+}
+
+func TestSetPowerSlew(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, PowerSlewPerSec: 4}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	start := time.Now()
+	err := b.SetPower(context.Background(), r3.Vector{Y: 1}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, time.Since(start), test.ShouldBeGreaterThanOrEqualTo, 4*powerRampStep)
+	test.That(t, fm.get()[0], test.ShouldAlmostEqual, 1, testTheta)
+
+	fm.mu.Lock()
+	history := append([]float64{}, fm.history[0]...)
+	fm.mu.Unlock()
+
+	// a step to full power takes 5 steps of .2
+	maxStep := cfg.PowerSlewPerSec * powerRampStep.Seconds()
+	test.That(t, len(history), test.ShouldEqual, 5)
+	prev := 0.0
+	for _, p := range history {
+		test.That(t, p, test.ShouldBeGreaterThan, prev)
+		test.That(t, p-prev, test.ShouldBeLessThanOrEqualTo, maxStep+testTheta)
+		prev = p
+	}
+
+	// small changes go straight there
+	err = b.SetPower(context.Background(), r3.Vector{Y: .9}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	fm.mu.Lock()
+	test.That(t, len(fm.history[0]), test.ShouldEqual, 6)
+	fm.mu.Unlock()
+
+	// the control loop isn't slew limited unless asked
+	err = b.setPowerInternal(context.Background(), r3.Vector{Y: -1}, r3.Vector{}, cfg.SlewControlLoop)
+	test.That(t, err, test.ShouldBeNil)
+	fm.mu.Lock()
+	test.That(t, len(fm.history[0]), test.ShouldEqual, 7)
+	fm.mu.Unlock()
+	test.That(t, fm.get()[0], test.ShouldAlmostEqual, -1, testTheta)
+}
+
+func BenchmarkSendPowerSlowMotors(b *testing.B) {
+	cfg := &Config{Motors: testMotorConfig, LengthMM: 500, WidthMM: 500}
+	fm := newFakeMotors(len(cfg.Motors))
+	fm.delay = 5 * time.Millisecond
+	boat := &boat{cfg: cfg, logger: golog.NewTestLogger(b), motors: map[string]motor.Motor{}}
+	for idx, mc := range cfg.Motors {
+		boat.motors[mc.Name] = fm.motors[idx]
+	}
+	power := make([]float64, len(cfg.Motors))
+	for idx := range power {
+		power[idx] = .5
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for idx, p := range power {
+				fm.motors[idx].SetPower(context.Background(), p, nil)
+			}
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			boat.sendPower(context.Background(), power, 1)
+		}
+	})
+}
+
+func TestSensorTimeoutStops(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, SensorTimeoutSec: .2}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	fs := &fakeSensor{}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	waitFor := func(f func() bool) bool {
+		for start := time.Now(); time.Since(start) < 3*time.Second; {
+			if f() {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	moving := func() bool {
+		p := fm.get()
+		return p[0] != 0 || p[1] != 0
+	}
+	test.That(t, waitFor(moving), test.ShouldBeTrue)
+
+	fs.mu.Lock()
+	fs.err = errors.New("sensor gone")
+	fs.mu.Unlock()
+
+	// the first failed read is already past the timeout, since the loop runs slower than it
+	start := time.Now()
+	test.That(t, waitFor(func() bool { return !moving() }), test.ShouldBeTrue)
+	test.That(t, time.Since(start), test.ShouldBeLessThan, pidLoopTime+time.Duration(cfg.SensorTimeoutSec*float64(time.Second))+100*time.Millisecond)
+
+	st := b.snapshotState()
+	test.That(t, st.controlState, test.ShouldEqual, controlNone)
+}
+
+func TestHungSensorTimesOut(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 20, SensorTimeoutSec: .2}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	// the hung reads are still going when the next loop starts its own
+	fs := &fakeSensor{}
+	b.movementSensor = concurrentSensor{fs.movementSensor()}
+	defer b.Close(context.Background())
+
+	hang := make(chan struct{})
+	defer close(hang)
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	moving := func() bool {
+		p := fm.get()
+		return p[0] != 0 || p[1] != 0
+	}
+	for start := time.Now(); !moving() && time.Since(start) < 3*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.That(t, moving(), test.ShouldBeTrue)
+
+	fs.mu.Lock()
+	fs.hang = hang
+	fs.mu.Unlock()
+
+	// the reads never come back, but the loop keeps going and the watchdog stops the boat
+	start := time.Now()
+	for moving() && time.Since(start) < 3*time.Second {
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.That(t, moving(), test.ShouldBeFalse)
+	test.That(t, time.Since(start), test.ShouldBeLessThan, time.Second)
+	test.That(t, b.snapshotState().controlState, test.ShouldEqual, controlNone)
+}
+
+func TestIdleStopsControlLoop(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 20, IdleStopSec: .1}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	fs := &fakeSensor{}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	reads := func() int {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		return fs.reads
+	}
+
+	waitFor := func(f func() bool) bool {
+		for start := time.Now(); time.Since(start) < 3*time.Second; {
+			if f() {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	// keeps running while there's something to do
+	time.Sleep(300 * time.Millisecond)
+	test.That(t, b.snapshotState().threadStarted, test.ShouldBeTrue)
+
+	err = b.Stop(context.Background(), nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	test.That(t, waitFor(func() bool { return !b.snapshotState().threadStarted }), test.ShouldBeTrue)
+
+	// the goroutine is gone, not just paused
+	exited := make(chan struct{})
+	go func() {
+		b.waitGroup.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("control loop goroutine didn't exit")
+	}
+
+	stopped := reads()
+	time.Sleep(100 * time.Millisecond)
+	test.That(t, reads(), test.ShouldEqual, stopped)
+
+	// and comes back for the next motion command
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.snapshotState().threadStarted, test.ShouldBeTrue)
+	test.That(t, waitFor(func() bool { return reads() > stopped }), test.ShouldBeTrue)
+}
+
+func TestInvalidSensorReadings(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	fs := &fakeSensor{}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{Z: 10}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	good := fm.get()
+
+	for _, bad := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		fs.set(0, r3.Vector{}, spatialmath.AngularVelocity{Z: bad})
+		test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldNotBeNil)
+
+		fs.set(bad, r3.Vector{}, spatialmath.AngularVelocity{})
+		test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldNotBeNil)
+
+		fs.set(0, r3.Vector{Y: bad}, spatialmath.AngularVelocity{})
+		test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldNotBeNil)
+
+		// motors are left where they were
+		test.That(t, fm.get(), test.ShouldResemble, good)
+	}
+
+	// and nan can never be sent directly
+	err = b.SetPower(context.Background(), r3.Vector{Y: math.NaN()}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldNotBeNil)
+	fm.mu.Lock()
+	for _, h := range fm.history {
+		for _, p := range h {
+			test.That(t, math.IsNaN(p), test.ShouldBeFalse)
+		}
+	}
+	fm.mu.Unlock()
+}
+
+func TestReadSensorsConcurrently(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+
+	delay := 100 * time.Millisecond
+	fs := &fakeSensor{heading: 30, linearVelocity: r3.Vector{Y: 5}, delay: delay}
+	b.movementSensor = fs.movementSensor()
+
+	start := time.Now()
+	r, err := b.readSensors(context.Background(), false)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, time.Since(start), test.ShouldBeLessThan, 2*delay)
+	test.That(t, r.heading, test.ShouldEqual, 30)
+	test.That(t, r.linearVelocity.Y, test.ShouldEqual, 5)
+	test.That(t, r.position, test.ShouldBeNil)
+
+	start = time.Now()
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	test.That(t, time.Since(start), test.ShouldBeLessThan, 2*delay)
+
+	fs.mu.Lock()
+	fs.err = errors.New("broken")
+	fs.mu.Unlock()
+	_, err = b.readSensors(context.Background(), false)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestControlLoopPeriod(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 20}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	test.That(t, b.state.period(), test.ShouldEqual, 20*time.Millisecond)
+
+	b.movementSensor = (&fakeSensor{}).movementSensor()
+	defer b.Close(context.Background())
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	// the default period would only get one or two loops in
+	time.Sleep(300 * time.Millisecond)
+	fm.mu.Lock()
+	loops := len(fm.history[0])
+	fm.mu.Unlock()
+	test.That(t, loops, test.ShouldBeGreaterThan, 5)
+}
+
+func TestMeasuredLoopTime(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 10}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	b.movementSensor = (&fakeSensor{}).movementSensor()
+
+	// drive the loop by hand, a constant error of 1 makes the integral the total time
+	b.state.controlState = controlVelocity
+	b.state.velocityLinearGoal = r3.Vector{Y: 1}
+
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	start := time.Now()
+
+	for _, d := range []time.Duration{20, 60, 5, 40} {
+		time.Sleep(d * time.Millisecond)
+		test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	}
+	elapsed := time.Since(start)
+
+	// the first loop had nothing to measure against, so it used the period
+	expected := (10*time.Millisecond + elapsed).Seconds()
+	test.That(t, b.state.linearPID.integral, test.ShouldAlmostEqual, expected, .005)
+	test.That(t, b.state.elapsed, test.ShouldBeGreaterThanOrEqualTo, 40*time.Millisecond)
+}
+
+func TestSetPowerDeadband(t *testing.T) {
+	cfg := &Config{
+		Motors: []MotorConfig{
+			{Name: "port", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1, DeadbandPower: .2},
+			{Name: "starboard", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1, DeadbandPower: .2},
+		},
+		LengthMM: 3048,
+		WidthMM:  1100,
+	}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	// a small correction still turns the motors
+	err := b.SetPower(context.Background(), r3.Vector{Y: .05}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	powers := fm.get()
+	test.That(t, powers[0], test.ShouldEqual, .2)
+	test.That(t, powers[1], test.ShouldEqual, .2)
+
+	err = b.SetPower(context.Background(), r3.Vector{}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+}
+
+func TestSetPowerQuantum(t *testing.T) {
+	cfg := &Config{
+		Motors: []MotorConfig{
+			{Name: "port", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1, PowerQuantum: .05},
+			{Name: "starboard", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1, PowerQuantum: .05},
+		},
+		LengthMM: 3048,
+		WidthMM:  1100,
+	}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	b.solver = PseudoInverseSolver{}
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .4173}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	powers := fm.get()
+	test.That(t, powers[0], test.ShouldAlmostEqual, .4, 1e-9)
+	test.That(t, powers[1], test.ShouldAlmostEqual, .4, 1e-9)
+
+	err = b.SetPower(context.Background(), r3.Vector{}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+}
+
+func TestSetPowerTrim(t *testing.T) {
+	cfg := &Config{
+		Motors: []MotorConfig{
+			{Name: "port", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1, Trim: -.04},
+			{Name: "starboard", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1},
+		},
+		LengthMM: 3048,
+		WidthMM:  1100,
+	}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	b.solver = PseudoInverseSolver{}
+
+	// the port motor pushes a bit hard, so it gets a bit less
+	err := b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	powers := fm.get()
+	test.That(t, powers[0], test.ShouldAlmostEqual, .46, 1e-9)
+	test.That(t, powers[1], test.ShouldAlmostEqual, .5, 1e-9)
+
+	err = b.SetPower(context.Background(), r3.Vector{}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+}
+
+func TestSeparateSensors(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+
+	gps := &fakeSensor{heading: 1, linearVelocity: r3.Vector{Y: 300}, angularVelocity: spatialmath.AngularVelocity{Z: 1}}
+	imu := &fakeSensor{heading: 45, linearVelocity: r3.Vector{Y: 1}, angularVelocity: spatialmath.AngularVelocity{Z: 7}}
+
+	// only the gps, everything comes from it
+	b.movementSensor = gps.movementSensor()
+	r, err := b.readSensors(context.Background(), false)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, r.heading, test.ShouldEqual, 1)
+	test.That(t, r.angularVelocity.Z, test.ShouldEqual, 1)
+	test.That(t, r.linearVelocity.Y, test.ShouldEqual, 300)
+
+	// heading and rotation from the imu
+	b.headingSensor = imu.movementSensor()
+	b.angularVelocitySensor = b.headingSensor
+	r, err = b.readSensors(context.Background(), false)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, r.heading, test.ShouldEqual, 45)
+	test.That(t, r.angularVelocity.Z, test.ShouldEqual, 7)
+	test.That(t, r.linearVelocity.Y, test.ShouldEqual, 300)
+
+	// no primary sensor is fine if everything has a source
+	b.movementSensor = nil
+	b.linearVelocitySensor = gps.movementSensor()
+	defer b.Close(context.Background())
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 300}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	st := b.snapshotState()
+	test.That(t, st.lastHeading, test.ShouldEqual, 45)
+	test.That(t, st.lastLinearVelocity.Y, test.ShouldEqual, 300)
+
+	cfg.HeadingSensor = "imu"
+	cfg.MovementSensor = "gps"
+	deps, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldContain, "imu")
+	test.That(t, deps, test.ShouldContain, "gps")
+}
+
+func TestDeadReckoning(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, DeadReckoningSec: .3, ControlLoopMs: 60000}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	// turning clockwise at 10 degrees a second
+	fs := &fakeSensor{heading: 10, linearVelocity: r3.Vector{Y: 200}, angularVelocity: spatialmath.AngularVelocity{Z: -10}}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{Z: -10}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	good := fm.get()
+
+	fs.mu.Lock()
+	fs.err = errors.New("lost fix")
+	fs.mu.Unlock()
+
+	// the loop keeps going on the estimate
+	for i := 0; i < 2; i++ {
+		time.Sleep(100 * time.Millisecond)
+		test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	}
+
+	st := b.snapshotState()
+	test.That(t, st.lastHeading, test.ShouldAlmostEqual, 12, .3)
+	test.That(t, st.lastLinearVelocity.Y, test.ShouldEqual, 200)
+
+	powers := fm.get()
+	for idx := range powers {
+		test.That(t, validFloat(powers[idx]), test.ShouldBeTrue)
+		test.That(t, powers[idx], test.ShouldAlmostEqual, good[idx], .5)
+	}
+
+	// until the window runs out
+	time.Sleep(200 * time.Millisecond)
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldNotBeNil)
+
+	// and a good reading starts it over
+	fs.mu.Lock()
+	fs.err = nil
+	fs.mu.Unlock()
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	st = b.snapshotState()
+	test.That(t, st.lastHeading, test.ShouldEqual, 10)
+}
+
+func TestCreateBoatMissingDependency(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, MovementSensor: "gps"}
+	conf := resource.Config{Name: "boat", API: base.API, Model: Model, ConvertedAttributes: cfg}
+
+	fm := newFakeMotors(2)
+	calls := 0
+	for _, m := range fm.motors {
+		m.SetPowerFunc = func(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
+			calls++
+			return nil
+		}
+		m.StopFunc = func(ctx context.Context, extra map[string]interface{}) error {
+			calls++
+			return nil
+		}
+	}
+	deps := resource.Dependencies{
+		motor.Named("port"):      fm.motors[0],
+		motor.Named("starboard"): fm.motors[1],
+	}
+
+	b, err := createBoat(deps, conf, golog.NewTestLogger(t))
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "gps")
+	test.That(t, b, test.ShouldBeNil)
+	test.That(t, calls, test.ShouldEqual, 0)
+
+	// and it works once the sensor is there
+	deps[movementsensor.Named("gps")] = (&fakeSensor{}).movementSensor()
+	b, err = createBoat(deps, conf, golog.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b, test.ShouldNotBeNil)
+	test.That(t, calls, test.ShouldEqual, 0)
+}
+
+func TestDryRun(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, StopRampMs: 200, DryRun: true}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{Z: .25}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.history[0], test.ShouldBeEmpty)
+	test.That(t, fm.history[1], test.ShouldBeEmpty)
+
+	// the mixing still ran, and the status says what the motors would have gotten
+	res, err := b.DoCommand(context.Background(), map[string]interface{}{"status": true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["dry_run"], test.ShouldEqual, true)
+	test.That(t, res["power_port"], test.ShouldAlmostEqual, .75, 1e-6)
+	test.That(t, res["power_starboard"], test.ShouldAlmostEqual, .25, 1e-6)
+
+	// and stopping doesn't ramp down power that was never there
+	err = b.Stop(context.Background(), nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.history[0], test.ShouldBeEmpty)
+	test.That(t, fm.history[1], test.ShouldBeEmpty)
+}
+
+func TestStatusSaturated(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	fs := &fakeSensor{}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	saturated := func() (interface{}, interface{}, interface{}) {
+		t.Helper()
+		res, err := b.DoCommand(context.Background(), map[string]interface{}{"status": true})
+		test.That(t, err, test.ShouldBeNil)
+		return res["saturated"], res["linear_saturated"], res["angular_saturated"]
+	}
+
+	all, linear, angular := saturated()
+	test.That(t, all, test.ShouldBeFalse)
+	test.That(t, linear, test.ShouldBeFalse)
+	test.That(t, angular, test.ShouldBeFalse)
+
+	// sitting still with a goal far away, the linear pid is maxed out
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+
+	all, linear, angular = saturated()
+	test.That(t, all, test.ShouldBeTrue)
+	test.That(t, linear, test.ShouldBeTrue)
+	test.That(t, angular, test.ShouldBeFalse)
+
+	// once it's there it isn't. long enough later the jump in speed doesn't kick the derivative
+	time.Sleep(100 * time.Millisecond)
+	fs.set(0, r3.Vector{Y: 500}, spatialmath.AngularVelocity{})
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+
+	all, linear, _ = saturated()
+	test.That(t, all, test.ShouldBeFalse)
+	test.That(t, linear, test.ShouldBeFalse)
+}
+
+func TestModeSwitchBumpless(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	b.solver = PseudoInverseSolver{}
+	fs := &fakeSensor{heading: 90, linearVelocity: r3.Vector{Y: 290}, angularVelocity: spatialmath.AngularVelocity{Z: 4}}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	// most of the way there, with the integral doing most of the work
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 300}, r3.Vector{Z: 5}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	}
+	before := fm.get()
+
+	// holding the heading it's already at, the power carries on from where it was
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 300}, r3.Vector{}, map[string]interface{}{"hold_heading": 90.0})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.snapshotState().controlState, test.ShouldEqual, controlHeading)
+	time.Sleep(20 * time.Millisecond)
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	after := fm.get()
+	test.That(t, after[0], test.ShouldAlmostEqual, before[0], 1e-6)
+	test.That(t, after[1], test.ShouldAlmostEqual, before[1], 1e-6)
+
+	// and back again
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 300}, r3.Vector{Z: 5}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	time.Sleep(20 * time.Millisecond)
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	back := fm.get()
+	test.That(t, back[0], test.ShouldAlmostEqual, after[0], 1e-6)
+	test.That(t, back[1], test.ShouldAlmostEqual, after[1], 1e-6)
+}
+
+func TestSpinFlakyCompass(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	fs := &fakeSensor{}
+	ms := fs.movementSensor()
+	b.movementSensor = ms
+	defer b.Close(context.Background())
+
+	// the first read is Spin working out its goal, after that two of every three fail, and the
+	// boat gets a bit further each time
+	var reads int32
+	heading := ms.CompassHeadingFunc
+	ms.CompassHeadingFunc = func(ctx context.Context, extra map[string]interface{}) (float64, error) {
+		n := atomic.AddInt32(&reads, 1)
+		if n > 1 && n%3 != 0 {
+			return 0, errors.New("compass busy")
+		}
+		fs.set(math.Min(float64(n-1)*5, 90), r3.Vector{}, spatialmath.AngularVelocity{})
+		return heading(ctx, extra)
+	}
+
+	err := b.Spin(context.Background(), 90, 20, map[string]interface{}{"poll_ms": 1})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, atomic.LoadInt32(&reads), test.ShouldBeGreaterThan, 20)
+
+	// but one that stays down fails it, after the retries
+	retries := 2
+	cfg.SpinHeadingRetries = &retries
+	atomic.StoreInt32(&reads, 0)
+	ms.CompassHeadingFunc = func(ctx context.Context, extra map[string]interface{}) (float64, error) {
+		if atomic.AddInt32(&reads, 1) > 1 {
+			return 0, errors.New("compass unplugged")
+		}
+		return 0, nil
+	}
+	err = b.Spin(context.Background(), 90, 20, map[string]interface{}{"poll_ms": 1})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "compass unplugged")
+	test.That(t, atomic.LoadInt32(&reads), test.ShouldEqual, 1+retries+1)
+}
+
+func TestSpinUpStagger(t *testing.T) {
+	cfg := &Config{Motors: testDoubledMotorConfig, LengthMM: 3048, WidthMM: 1100, SpinUpStaggerMs: 20}
+	fm := newFakeMotors(4)
+	b := newTestBoat(t, cfg, fm)
+
+	// when each motor first got power
+	var mu sync.Mutex
+	started := make([]time.Time, 4)
+	for idx, m := range fm.motors {
+		idx, setPower := idx, m.SetPowerFunc
+		m.SetPowerFunc = func(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
+			mu.Lock()
+			if powerPct != 0 && started[idx].IsZero() {
+				started[idx] = time.Now()
+			}
+			mu.Unlock()
+			return setPower(ctx, powerPct, extra)
+		}
+	}
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	for _, p := range fm.get() {
+		test.That(t, p, test.ShouldAlmostEqual, .5, 1e-6)
+	}
+	for idx := 1; idx < 4; idx++ {
+		test.That(t, started[idx].Sub(started[idx-1]), test.ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+	}
+
+	// already running, so changes go out all at once
+	calls := len(fm.history[0])
+	err = b.SetPower(context.Background(), r3.Vector{Y: .25}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(fm.history[0]), test.ShouldEqual, calls+1)
+	test.That(t, fm.get()[3], test.ShouldAlmostEqual, .25, 1e-6)
+}
+
+func TestResidualInStatus(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+
+	residual := func() float64 {
+		res, err := b.DoCommand(context.Background(), map[string]interface{}{"status": true})
+		test.That(t, err, test.ShouldBeNil)
+		return res["residual"].(float64)
+	}
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, residual(), test.ShouldAlmostEqual, 0, 1e-6)
+
+	err = b.SetPower(context.Background(), r3.Vector{Y: 1}, r3.Vector{Z: 1}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, residual(), test.ShouldBeGreaterThan, .1)
+}
+
+func TestIsMovingMeasured(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	// without a sensor, power is all there is to go on
+	moving, err := b.IsMoving(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, moving, test.ShouldBeTrue)
+
+	// powered but holding still against a current
+	fs := &fakeSensor{linearVelocity: r3.Vector{Y: 10}, angularVelocity: spatialmath.AngularVelocity{Z: -1}}
+	b.movementSensor = fs.movementSensor()
+	moving, err = b.IsMoving(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, moving, test.ShouldBeFalse)
+
+	// coasting with the motors off
+	err = b.Stop(context.Background(), nil)
+	test.That(t, err, test.ShouldBeNil)
+	fs.set(0, r3.Vector{Y: 300}, spatialmath.AngularVelocity{})
+	moving, err = b.IsMoving(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, moving, test.ShouldBeTrue)
+
+	// turning in place
+	fs.set(0, r3.Vector{}, spatialmath.AngularVelocity{Z: 5})
+	moving, err = b.IsMoving(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, moving, test.ShouldBeTrue)
+
+	// with a higher threshold that's still
+	cfg.MovingAngularDegPerSec = 10
+	moving, err = b.IsMoving(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, moving, test.ShouldBeFalse)
+}
+
+func TestSetVelocityCancelsSpin(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	b.movementSensor = (&fakeSensor{heading: 10}).movementSensor()
+	defer b.Close(context.Background())
+
+	spinErr := make(chan error, 1)
+	go func() {
+		spinErr <- b.Spin(context.Background(), 90, 20, nil)
+	}()
+
+	// wait for the spin to take over
+	for b.snapshotState().controlState != controlHeading {
+		time.Sleep(time.Millisecond)
+	}
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	select {
+	case err = <-spinErr:
+		test.That(t, errors.Is(err, context.Canceled), test.ShouldBeTrue)
+	case <-time.After(5 * time.Second):
+		t.Fatal("spin didn't return")
+	}
+
+	// the spin didn't stop anything on the way out
+	s := b.snapshotState()
+	test.That(t, s.controlState, test.ShouldEqual, controlVelocity)
+	test.That(t, s.velocityLinearGoal, test.ShouldResemble, r3.Vector{Y: 500})
+	test.That(t, s.headingPID.integral, test.ShouldEqual, 0)
+}
+
+func TestSetVelocityCancelsMoveStraight(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	b.movementSensor = (&fakeSensor{}).movementSensor()
+	defer b.Close(context.Background())
+
+	moveErr := make(chan error, 1)
+	go func() {
+		moveErr <- b.MoveStraight(context.Background(), 10000, 200, nil)
+	}()
+
+	for b.snapshotState().controlState != controlVelocity {
+		time.Sleep(time.Millisecond)
+	}
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: -300}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	select {
+	case err = <-moveErr:
+		test.That(t, errors.Is(err, context.Canceled), test.ShouldBeTrue)
+	case <-time.After(5 * time.Second):
+		t.Fatal("MoveStraight didn't return")
+	}
+
+	s := b.snapshotState()
+	test.That(t, s.controlState, test.ShouldEqual, controlVelocity)
+	test.That(t, s.velocityLinearGoal, test.ShouldResemble, r3.Vector{Y: -300})
+}
+
+func TestSnapshotState(t *testing.T) {
+	b := newTestBoat(t, &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}, newFakeMotors(2))
+	b.state.lastPower = []float64{.1, .2}
+	b.state.compassGoal = 33
+
+	st := b.snapshotState()
+	test.That(t, st.compassGoal, test.ShouldEqual, 33)
+	test.That(t, st.lastPower, test.ShouldResemble, []float64{.1, .2})
+
+	// it's a copy
+	st.lastPower[0] = 1
+	test.That(t, b.state.lastPower[0], test.ShouldEqual, .1)
+}
+
+func TestSpinProgress(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	fs := &fakeSensor{}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	spinErr := make(chan error, 1)
+	go func() {
+		spinErr <- b.Spin(context.Background(), 90, 20, map[string]interface{}{"poll_ms": 2})
+	}()
+
+	// the boat turns toward the goal a bit at a time, sampling status as it goes
+	var errs []float64
+	for heading := 0.0; heading <= 90; heading += 5 {
+		fs.set(heading, r3.Vector{}, spatialmath.AngularVelocity{})
+		time.Sleep(10 * time.Millisecond)
+
+		res, err := b.DoCommand(context.Background(), map[string]interface{}{"status": true})
+		test.That(t, err, test.ShouldBeNil)
+		if e := res["spin_heading_error"].(float64); e > 0 {
+			errs = append(errs, e)
+			// turning at the 20 degs/sec spin velocity
+			test.That(t, res["spin_eta_sec"], test.ShouldAlmostEqual, e/20)
+		}
+	}
+
+	select {
+	case err := <-spinErr:
+		test.That(t, err, test.ShouldBeNil)
+	case <-time.After(5 * time.Second):
+		t.Fatal("spin didn't return")
+	}
+
+	test.That(t, len(errs), test.ShouldBeGreaterThan, 10)
+	test.That(t, errs[0], test.ShouldBeGreaterThan, 80)
+	for idx := 1; idx < len(errs); idx++ {
+		test.That(t, errs[idx], test.ShouldBeLessThanOrEqualTo, errs[idx-1])
+	}
+
+	// and it's cleared once the spin is done
+	s := b.snapshotState()
+	test.That(t, s.spinHeadingError, test.ShouldEqual, 0)
+	test.That(t, s.spinETASec, test.ShouldEqual, 0)
+}
+
+func TestStopConcurrent(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, StopRampMs: 100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	var stops int32
+	for _, m := range fm.motors {
+		stop := m.StopFunc
+		m.StopFunc = func(ctx context.Context, extra map[string]interface{}) error {
+			atomic.AddInt32(&stops, 1)
+			return stop(ctx, extra)
+		}
+	}
+
+	for round := 0; round < 5; round++ {
+		err := b.SetPower(context.Background(), r3.Vector{Y: .8}, r3.Vector{}, nil)
+		test.That(t, err, test.ShouldBeNil)
+		atomic.StoreInt32(&stops, 0)
+
+		start := time.Now()
+		var wg sync.WaitGroup
+		errs := make([]error, 8)
+		for idx := range errs {
+			idx := idx
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var extra map[string]interface{}
+				// one of them is in a hurry, and cuts short everyone else's ramp
+				if idx == len(errs)-1 {
+					time.Sleep(10 * time.Millisecond)
+					extra = map[string]interface{}{"emergency": true}
+				}
+				errs[idx] = b.Stop(context.Background(), extra)
+			}()
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			test.That(t, err, test.ShouldBeNil)
+		}
+		test.That(t, time.Since(start), test.ShouldBeLessThan, 100*time.Millisecond)
+		test.That(t, atomic.LoadInt32(&stops), test.ShouldEqual, 2*len(errs))
+
+		// nothing was left running by a ramp that finished after a stop
+		test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+		s := b.snapshotState()
+		test.That(t, s.controlState, test.ShouldEqual, controlNone)
+		test.That(t, s.lastPower, test.ShouldResemble, []float64{0, 0})
+	}
+}
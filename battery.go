@@ -0,0 +1,76 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// how far power is scaled to make up for battery voltage, so a bad reading can't do anything crazy
+const (
+	minVoltageScale = .8
+	maxVoltageScale = 1.5
+)
+
+// voltage reads the battery voltage from the power sensor
+func (b *boat) voltage(ctx context.Context) (float64, error) {
+	if b.powerSensor == nil {
+		return 0, errors.New("no power sensor")
+	}
+
+	readings, err := b.powerSensor.Readings(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	v, ok := readings["voltage"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("power sensor readings have no voltage: %v", readings)
+	}
+	// a disconnected sensor can read 0, which isn't a battery that's run down to nothing
+	if !validFloat(v) || v <= 0 {
+		return 0, fmt.Errorf("invalid voltage %v", v)
+	}
+
+	b.stateMutex.Lock()
+	b.state.lastVoltage = v
+	b.stateMutex.Unlock()
+
+	return v, nil
+}
+
+// ErrLowBattery is returned for motion commands when the battery is below min_voltage
+var ErrLowBattery = errors.New("battery voltage too low to move")
+
+// checkBattery reads the voltage if it's needed, and returns how much to multiply power by to
+// make up for the battery being below nominal. if the battery is below min_voltage, it returns
+// an error wrapping ErrLowBattery. if the voltage can't be read, power isn't scaled and motion is allowed.
+func (b *boat) checkBattery(ctx context.Context) (float64, error) {
+	if b.powerSensor == nil || (b.cfg.NominalVoltage <= 0 && b.cfg.MinVoltage <= 0) {
+		return 1, nil
+	}
+
+	v, err := b.voltage(ctx)
+	if err != nil {
+		b.logger.Warnf("can't check battery voltage: %v", err)
+		return 1, nil
+	}
+
+	if b.cfg.MinVoltage > 0 && v < b.cfg.MinVoltage {
+		return 0, fmt.Errorf("%w: %v volts, min_voltage is %v", ErrLowBattery, v, b.cfg.MinVoltage)
+	}
+
+	return b.voltageScale(v), nil
+}
+
+// voltageScale is how much to multiply power by at voltage v
+func (b *boat) voltageScale(v float64) float64 {
+	if b.cfg.NominalVoltage <= 0 {
+		return 1
+	}
+	if v <= 0 {
+		return 1
+	}
+	return math.Max(minVoltageScale, math.Min(maxVoltageScale, b.cfg.NominalVoltage/v))
+}
@@ -0,0 +1,151 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/testutils/inject"
+)
+
+// fakePowerSensor is a power sensor whose voltage can be changed by the test
+type fakePowerSensor struct {
+	mu      sync.Mutex
+	voltage float64
+}
+
+func (fp *fakePowerSensor) set(v float64) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.voltage = v
+}
+
+func (fp *fakePowerSensor) sensor() *inject.Sensor {
+	s := inject.NewSensor("power")
+	s.ReadingsFunc = func(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+		fp.mu.Lock()
+		defer fp.mu.Unlock()
+		return map[string]interface{}{"voltage": fp.voltage, "current": 10.0}, nil
+	}
+	return s
+}
+
+func TestVoltageCompensation(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, PowerSensor: "power", NominalVoltage: 12}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	fp := &fakePowerSensor{voltage: 12}
+	b.powerSensor = fp.sensor()
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get()[0], test.ShouldAlmostEqual, .5, testTheta)
+
+	// sagging battery gets more power
+	fp.set(10)
+	err = b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get()[0], test.ShouldAlmostEqual, .6, testTheta)
+	test.That(t, fm.get()[1], test.ShouldAlmostEqual, .6, testTheta)
+
+	// the state still has the uncompensated power
+	st := b.snapshotState()
+	test.That(t, st.lastPower[0], test.ShouldAlmostEqual, .5, testTheta)
+	test.That(t, st.lastVoltage, test.ShouldEqual, 10)
+
+	// but only so much
+	test.That(t, b.voltageScale(2), test.ShouldEqual, maxVoltageScale)
+	test.That(t, b.voltageScale(100), test.ShouldEqual, minVoltageScale)
+
+	// a 0 volt reading is a broken sensor, not a flat battery, so nothing is boosted
+	fp.set(0)
+	err = b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get()[0], test.ShouldAlmostEqual, .5, testTheta)
+	test.That(t, b.voltageScale(0), test.ShouldEqual, 1)
+
+	// and never past the motor limits
+	fp.set(6)
+	err = b.SetPower(context.Background(), r3.Vector{Y: 1}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get()[0], test.ShouldAlmostEqual, 1, testTheta)
+
+	// without a nominal voltage nothing changes
+	cfg.NominalVoltage = 0
+	scale, err := b.checkBattery(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, scale, test.ShouldEqual, 1)
+}
+
+func TestMaxTotalPowerWithVoltageCompensation(t *testing.T) {
+	cfg := &Config{
+		Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, PowerSensor: "power", NominalVoltage: 12,
+		MaxTotalPower: 1,
+	}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	b.solver = PseudoInverseSolver{}
+
+	// .5 each is right at the cap, and the sagging battery would push it to .6 each
+	fp := &fakePowerSensor{voltage: 10}
+	b.powerSensor = fp.sensor()
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	powers := fm.get()
+	test.That(t, math.Abs(powers[0])+math.Abs(powers[1]), test.ShouldAlmostEqual, 1, testTheta)
+	test.That(t, powers[0], test.ShouldAlmostEqual, .5, testTheta)
+
+	// same for trim, which is added after the solver
+	fp.set(12)
+	cfg.Motors = append([]MotorConfig{}, testTwoMotorConfig...)
+	cfg.Motors[0].Trim = .2
+	err = b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	powers = fm.get()
+	test.That(t, math.Abs(powers[0])+math.Abs(powers[1]), test.ShouldAlmostEqual, 1, testTheta)
+	test.That(t, powers[0], test.ShouldBeGreaterThan, powers[1])
+}
+
+func TestLowBattery(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, PowerSensor: "power", MinVoltage: 10.5}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	fp := &fakePowerSensor{voltage: 12}
+	b.powerSensor = fp.sensor()
+	b.movementSensor = (&fakeSensor{}).movementSensor()
+	defer b.Close(context.Background())
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	test.That(t, fm.get()[0], test.ShouldBeGreaterThan, 0)
+
+	// the battery sags, and the control loop stops the boat
+	fp.set(10)
+	err = b.velocityThreadLoop(context.Background())
+	test.That(t, errors.Is(err, ErrLowBattery), test.ShouldBeTrue)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+	test.That(t, b.snapshotState().controlState, test.ShouldEqual, controlNone)
+
+	// and won't start moving again
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, errors.Is(err, ErrLowBattery), test.ShouldBeTrue)
+	err = b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, errors.Is(err, ErrLowBattery), test.ShouldBeTrue)
+	err = b.Spin(context.Background(), 90, 10, nil)
+	test.That(t, errors.Is(err, ErrLowBattery), test.ShouldBeTrue)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+
+	// until it's charged
+	fp.set(12.5)
+	err = b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+}
@@ -0,0 +1,61 @@
+package viamboatbase
+
+import (
+	"math"
+	"time"
+
+	"github.com/golang/geo/r3"
+
+	"go.viam.com/rdk/spatialmath"
+)
+
+// the bias is only learned when we're this close to the goal, so it only picks up the steady
+// state and not what it takes to get there
+const (
+	biasLinearErrorMMPerSec   = 50
+	biasAngularErrorDegPerSec = 2
+)
+
+// applyBias adds the learned bias to the pid outputs, and when holding moves the bias toward
+// whatever output it's taking to stay put. over time the bias takes over from the integral,
+// so after a change the pids start from the right offset.
+func (s *boatState) applyBias(
+	linearVelocity r3.Vector,
+	angularVelocity spatialmath.AngularVelocity,
+	linear, angular float64,
+	dt time.Duration,
+) (float64, float64) {
+	linear = math.Max(-1, math.Min(1, linear+s.linearBias))
+	angular = math.Max(-1, math.Min(1, angular+s.angularBias))
+
+	holding := s.controlState == controlHeading || s.controlState == controlPosition
+	if !holding || s.biasLearnRate <= 0 {
+		return linear, angular
+	}
+
+	alpha := math.Min(1, s.biasLearnRate*dt.Seconds())
+	if math.Abs(s.rampedLinearGoal.Y-linearVelocity.Y) < biasLinearErrorMMPerSec {
+		s.linearBias += alpha * (linear - s.linearBias)
+	}
+	if math.Abs(s.rampedAngularGoal.Z-angularVelocity.Z) < biasAngularErrorDegPerSec {
+		s.angularBias += alpha * (angular - s.angularBias)
+	}
+
+	return linear, angular
+}
+
+// resetBias forgets the learned bias. it's in the boat's frame while the current or wind is
+// not, so it's only good for the heading it was learned at, and after a stop or a new heading
+// it has to be learned again.
+func (s *boatState) resetBias() {
+	s.linearBias = 0
+	s.angularBias = 0
+}
+
+// foldBias moves the bias into the last pid outputs before a Transfer, so switching between
+// running modes drops the bias without the output jumping. the integral picks it up instead.
+func (s *boatState) foldBias() {
+	s.linearPID.output = math.Max(-1, math.Min(1, s.linearPID.output+s.linearBias))
+	s.angularPID.output = math.Max(-1, math.Min(1, s.angularPID.output+s.angularBias))
+	s.resetBias()
+}
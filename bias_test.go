@@ -0,0 +1,91 @@
+package viamboatbase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/spatialmath"
+)
+
+func TestBiasConverges(t *testing.T) {
+	state := &boatState{}
+	state.configure(&Config{BiasLearnRate: .5})
+	state.controlState = controlHeading
+
+	// a current that turns the boat at 1 degree a second with no power, and full power turns 5
+	disturbance := 1.0
+	rate := 0.0
+	for i := 0; i < 500; i++ {
+		_, angular := computeNextPower(state, r3.Vector{}, spatialmath.AngularVelocity{Z: rate}, nil)
+		rate = 5*angular.Z + disturbance
+	}
+
+	test.That(t, rate, test.ShouldAlmostEqual, 0, .1)
+	test.That(t, state.angularBias, test.ShouldAlmostEqual, -disturbance/5, .01)
+
+	// the learned bias means the integral isn't doing the work anymore
+	test.That(t, state.angularPID.integralGain*state.angularPID.integral, test.ShouldAlmostEqual, 0, .02)
+	test.That(t, state.linearBias, test.ShouldAlmostEqual, 0)
+}
+
+func TestBiasOnlyWhenHolding(t *testing.T) {
+	state := &boatState{}
+	state.configure(&Config{BiasLearnRate: .5})
+	state.controlState = controlVelocity
+	state.velocityAngularGoal = r3.Vector{Z: 1}
+
+	for i := 0; i < 50; i++ {
+		computeNextPower(state, r3.Vector{}, spatialmath.AngularVelocity{Z: 1}, nil)
+	}
+	test.That(t, state.angularBias, test.ShouldEqual, 0)
+
+	// off by default
+	state.configure(&Config{})
+	state.controlState = controlHeading
+	for i := 0; i < 50; i++ {
+		computeNextPower(state, r3.Vector{}, spatialmath.AngularVelocity{Z: 1}, nil)
+	}
+	test.That(t, state.angularBias, test.ShouldEqual, 0)
+}
+
+func TestBiasResets(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, BiasLearnRate: .5}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	b.solver = PseudoInverseSolver{}
+
+	var angular r3.Vector
+	learn := func() {
+		t.Helper()
+		b.setControlStateInLock(controlHeading)
+		rate := 0.0
+		for i := 0; i < 500; i++ {
+			_, angular = computeNextPower(&b.state, r3.Vector{}, spatialmath.AngularVelocity{Z: rate}, nil)
+			rate = 5*angular.Z + 1
+		}
+		test.That(t, b.state.angularBias, test.ShouldAlmostEqual, -.2, .01)
+	}
+
+	// the same heading keeps it, a new one starts over
+	learn()
+	b.setCompassGoalInLock(b.state.compassGoal)
+	test.That(t, b.state.angularBias, test.ShouldAlmostEqual, -.2, .01)
+	b.setCompassGoalInLock(b.state.compassGoal + 90)
+	test.That(t, b.state.angularBias, test.ShouldEqual, 0)
+	b.setCompassGoalInLock(0)
+
+	// going to velocity drops it, but the pid takes it over so the output doesn't jump
+	learn()
+	b.setControlStateInLock(controlVelocity)
+	test.That(t, b.state.angularBias, test.ShouldEqual, 0)
+	_, next := computeNextPower(&b.state, r3.Vector{}, spatialmath.AngularVelocity{Z: 5*angular.Z + 1}, nil)
+	test.That(t, next.Z, test.ShouldAlmostEqual, angular.Z, .01)
+
+	// and stopping drops it
+	learn()
+	test.That(t, b.Stop(context.Background(), nil), test.ShouldBeNil)
+	test.That(t, b.state.angularBias, test.ShouldEqual, 0)
+	test.That(t, b.state.linearBias, test.ShouldEqual, 0)
+}
@@ -1,8 +1,11 @@
 package viamboatbase
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"sync"
+	"time"
 
 	"github.com/go-nlopt/nlopt"
 	"github.com/golang/geo/r3"
@@ -16,7 +19,189 @@ type Config struct {
 	Motors         []MotorConfig
 	LengthMM       float64 `json:"length_mm"`
 	WidthMM        float64 `json:"width_mm"`
+	HeightMM       float64 `json:"height_mm,omitempty"` // only used for the collision geometry
 	MovementSensor string  `json:"movement_sensor"`
+
+	// instead of listing motors, layout "differential" generates them from left_motor and right_motor,
+	// mounted at the stern motor_spacing_mm apart (default half the width)
+	Layout         string  `json:"layout,omitempty"`
+	LeftMotor      string  `json:"left_motor,omitempty"`
+	RightMotor     string  `json:"right_motor,omitempty"`
+	MotorSpacingMM float64 `json:"motor_spacing_mm,omitempty"`
+
+	// where to get each reading from, if not movement_sensor
+	HeadingSensor         string `json:"heading_sensor,omitempty"`
+	AngularVelocitySensor string `json:"angular_velocity_sensor,omitempty"`
+	LinearVelocitySensor  string `json:"linear_velocity_sensor,omitempty"`
+
+	// a sensor whose readings include "voltage". if nominal_voltage is set too, power is scaled
+	// up as the battery sags so the same power makes the same thrust.
+	PowerSensor    string  `json:"power_sensor,omitempty"`
+	NominalVoltage float64 `json:"nominal_voltage,omitempty"`
+
+	// below this voltage the boat stops and won't move again, 0 means no limit
+	MinVoltage float64 `json:"min_voltage,omitempty"`
+
+	AngularPID *PIDConfig `json:"angular_pid,omitempty"`
+	LinearPID  *PIDConfig `json:"linear_pid,omitempty"`
+
+	// runs sideways velocity on boats that can move sideways, linear_pid if not set
+	LateralPID *PIDConfig `json:"lateral_pid,omitempty"`
+
+	// if set, pid gains saved with the save_pid command are loaded from here at startup,
+	// replacing angular_pid, linear_pid, lateral_pid, and heading_pid
+	PIDStatePath string `json:"pid_state_path,omitempty"`
+
+	// if set, the boat stops whenever it's outside this polygon while moving on its own. needs a
+	// movement_sensor that supports position
+	Geofence []GeoPoint `json:"geofence,omitempty"`
+
+	// used when holding position, the output is a velocity in mm/s per mm of position error
+	PositionPID *PIDConfig `json:"position_pid,omitempty"`
+
+	// when the motors can't exactly produce the goal, an optimizer searches for the closest powers.
+	// it stops once the error is below OptimizerStopVal (default .002) or it has run for
+	// OptimizerMaxTimeSec (default .25). a smaller stop value is more accurate but slower, and the
+	// max time is spent inside the control loop, so it should be well under control loop period.
+	OptimizerStopVal    float64 `json:"optimizer_stop_val,omitempty"`
+	OptimizerMaxTimeSec float64 `json:"optimizer_max_time_sec,omitempty"`
+
+	// set to never push the boat sideways, even if the motors can. either way, on a boat that
+	// doesn't, sideways goals are dropped with a warning.
+	DisableLateral bool `json:"disable_lateral,omitempty"`
+
+	// what to do when the motors can't give everything asked for. "optimize" (default) searches
+	// for the closest powers within their limits, which can change the direction the boat goes.
+	// "scale" slows every motor down together until they fit, keeping the direction at the cost
+	// of speed.
+	PowerSaturation string `json:"power_saturation,omitempty"`
+
+	// the most all the motors can use at once, as the sum of each one's |power|, for a battery or
+	// supply that can't run them all flat out. over it every motor is scaled down together. it's
+	// checked again on what's actually sent, after the battery scale, trim, and deadband. 0 means
+	// no limit.
+	MaxTotalPower float64 `json:"max_total_power,omitempty"`
+
+	// how much the optimizer cares about missing the linear and angular goals, both default to 1.
+	// raising angular_weight holds heading better at the cost of speed when both can't be had.
+	LinearWeight  *float64 `json:"linear_weight,omitempty"`
+	AngularWeight *float64 `json:"angular_weight,omitempty"`
+
+	// lateral_weight is linear_weight for sideways, and defaults to it. misses are measured in raw
+	// thrust, where turning and going straight usually aren't on the same scale, unless
+	// normalize_objective is set, which measures each as a fraction of what the motors can do on
+	// that axis, so the weights mean the same thing on any boat.
+	LateralWeight      *float64 `json:"lateral_weight,omitempty"`
+	NormalizeObjective bool     `json:"normalize_objective,omitempty"`
+
+	// limits on commanded velocity, 0 means no limit
+	MaxLinearVelocityMMPerSec   float64 `json:"max_linear_velocity_mm_per_sec,omitempty"`
+	MaxAngularVelocityDegPerSec float64 `json:"max_angular_velocity_degs_per_sec,omitempty"`
+
+	// with no movement sensor, SetVelocity and Spin run open loop, assuming full power moves the
+	// boat this fast. default to the max velocities, or 1000 mm/s and 90 degs/sec without those.
+	OpenLoopLinearMMPerSec   float64 `json:"open_loop_linear_mm_per_sec,omitempty"`
+	OpenLoopAngularDegPerSec float64 `json:"open_loop_angular_degs_per_sec,omitempty"`
+
+	// how fast the velocity goal can change, 0 means it changes immediately
+	MaxLinearAccelMMPerSec2   float64 `json:"max_linear_accel_mm_per_sec2,omitempty"`
+	MaxAngularAccelDegPerSec2 float64 `json:"max_angular_accel_degs_per_sec2,omitempty"`
+
+	// how fast the linear acceleration can change, 0 means it's only limited by the max accel.
+	// SetVelocity can override both with extra["max_accel"] and extra["max_jerk"].
+	MaxLinearJerkMMPerSec3 float64 `json:"max_linear_jerk_mm_per_sec3,omitempty"`
+
+	// Spin is done when within SpinToleranceDeg (default 1) of the goal, checking every
+	// SpinPollMs (default 100), and fails if that takes longer than SpinTimeoutSec (0 means wait
+	// forever). all can be overridden per call with "tolerance_deg", "poll_ms", and "timeout_sec"
+	// in extra.
+	SpinToleranceDeg float64 `json:"spin_tolerance_deg,omitempty"`
+	SpinPollMs       float64 `json:"spin_poll_ms,omitempty"`
+	SpinTimeoutSec   float64 `json:"spin_timeout_sec,omitempty"`
+
+	// how many times in a row Spin can fail to read the heading before giving up, default 3,
+	// waiting twice as long after each
+	SpinHeadingRetries *int `json:"spin_heading_retries,omitempty"`
+
+	// set if the heading sensor's compass heading increases counterclockwise. it's flipped as it's
+	// read, so headings everywhere else, like hold_heading and current_heading, increase clockwise.
+	HeadingCounterClockwise bool `json:"heading_counterclockwise,omitempty"`
+
+	// set if the angular velocity sensor's positive z is clockwise. like the heading it's flipped as
+	// it's read, so everywhere else positive z is counterclockwise and the heading goes down with it.
+	AngularVelocityClockwise bool `json:"angular_velocity_clockwise,omitempty"`
+
+	// MoveStraight fails if it's gone less than a tenth of what it should have in this long,
+	// default 5. extra can override it with "stall_sec", and set "timeout_sec" to give up after,
+	// by default twice as long as it should take plus the stall time.
+	MoveStraightStallSec float64 `json:"move_straight_stall_sec,omitempty"`
+
+	// how Spin and hold_heading turn toward a compass goal. "pid" (default) uses heading_pid to turn
+	// the heading error into an angular velocity goal. "ramp" is the older behavior, turning at full
+	// speed until within heading_ramp_deg (default 5) of the goal, then slowing down proportionally.
+	// either way it stops turning within heading_deadband_deg (default 1).
+	HeadingControl     string     `json:"heading_control,omitempty"`
+	HeadingPID         *PIDConfig `json:"heading_pid,omitempty"`
+	HeadingDeadbandDeg *float64   `json:"heading_deadband_deg,omitempty"`
+	HeadingRampDeg     *float64   `json:"heading_ramp_deg,omitempty"`
+
+	// if set, Stop brings the power down to 0 over this long instead of cutting it,
+	// unless "emergency": true is passed in extra
+	StopRampMs float64 `json:"stop_ramp_ms,omitempty"`
+
+	// if set, SetPower changes each motor's power by at most this much (1 being full power) per second,
+	// stepping there instead of jumping. the control loop only uses it if SlewControlLoop is set.
+	PowerSlewPerSec float64 `json:"power_slew_per_sec,omitempty"`
+	SlewControlLoop bool    `json:"slew_control_loop,omitempty"`
+
+	// when the motors start from all stopped, turn them on one at a time this far apart instead of
+	// all at once, so the inrush current is spread out. 0 starts them together.
+	SpinUpStaggerMs float64 `json:"spin_up_stagger_ms,omitempty"`
+
+	// if set, every motor is sent 0 this often while the boat is stopped, for ESCs that disarm
+	// when they go too long without a command. 0 means don't.
+	MotorKeepAliveMs float64 `json:"motor_keep_alive_ms,omitempty"`
+
+	// if the movement sensor hasn't given a good reading in this long while we're controlling
+	// the motors, the boat stops. 0 means never.
+	SensorTimeoutSec float64 `json:"sensor_timeout_sec,omitempty"`
+
+	// if the movement sensor drops out, keep controlling from an estimate for up to this long.
+	// 0 means don't.
+	DeadReckoningSec float64 `json:"dead_reckoning_sec,omitempty"`
+
+	// when holding a heading or position, how fast (per second) to learn the steady output needed
+	// to fight a constant current or wind. 0 means don't.
+	BiasLearnRate float64 `json:"bias_learn_rate,omitempty"`
+
+	// how often the control loop runs, default 500
+	ControlLoopMs float64 `json:"control_loop_ms,omitempty"`
+
+	// with a movement sensor, IsMoving is true when the boat is going faster than these, default
+	// 50 mm/sec and 2 degs/sec
+	MovingLinearMMPerSec   float64 `json:"moving_linear_mm_per_sec,omitempty"`
+	MovingAngularDegPerSec float64 `json:"moving_angular_degs_per_sec,omitempty"`
+
+	// if set, the control loop stops polling the sensors after it's had nothing to do for this long,
+	// and starts again on the next motion command. 0 means it runs until the boat is closed.
+	IdleStopSec float64 `json:"idle_stop_sec,omitempty"`
+
+	// what the boat does once it's created. "none" (default) waits for a command, "hold_heading"
+	// holds startup_heading_degs, or the heading it starts at if that isn't set, and
+	// "hold_position" holds wherever it starts.
+	StartupMode       string   `json:"startup_mode,omitempty"`
+	StartupHeadingDeg *float64 `json:"startup_heading_degs,omitempty"`
+
+	// for checking the mixing on the bench, everything runs as normal except the motors are never
+	// given power. what they would have gotten is logged and shows up in the status DoCommand.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// if a motor fails to take power, stop using it and spread its work over the rest instead of
+	// stopping the boat. it stays out until the boat is reconfigured.
+	FaultTolerant bool `json:"fault_tolerant,omitempty"`
+
+	// set on the copy used to solve without faulted motors, so goals stay relative to all of them
+	fullMaxWeights *motorWeights
 }
 
 func (cfg *Config) Validate(path string) ([]string, error) {
@@ -28,20 +213,405 @@ func (cfg *Config) Validate(path string) ([]string, error) {
 		return nil, utils.NewConfigValidationFieldRequiredError(path, "length_mm")
 	}
 
+	if cfg.HeightMM < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("height_mm can't be negative"))
+	}
+
+	if err := cfg.applyLayout(); err != nil {
+		return nil, utils.NewConfigValidationError(path, err)
+	}
+
+	if err := cfg.AngularPID.Validate(path + ".angular_pid"); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.LinearPID.Validate(path + ".linear_pid"); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.LateralPID.Validate(path + ".lateral_pid"); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.PositionPID.Validate(path + ".position_pid"); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.HeadingPID.Validate(path + ".heading_pid"); err != nil {
+		return nil, err
+	}
+
+	if cfg.HeadingControl != "" && cfg.HeadingControl != headingControlPID && cfg.HeadingControl != headingControlRamp {
+		return nil, utils.NewConfigValidationError(path, fmt.Errorf("unknown heading_control %q", cfg.HeadingControl))
+	}
+
+	if cfg.OptimizerStopVal < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("optimizer_stop_val has to be positive"))
+	}
+
+	if cfg.OptimizerMaxTimeSec < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("optimizer_max_time_sec has to be positive"))
+	}
+
+	if cfg.linearWeight() < 0 || cfg.angularWeight() < 0 || (cfg.LateralWeight != nil && *cfg.LateralWeight < 0) {
+		return nil, utils.NewConfigValidationError(path, errors.New("linear_weight, lateral_weight, and angular_weight can't be negative"))
+	}
+
+	if cfg.MaxLinearVelocityMMPerSec < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("max_linear_velocity_mm_per_sec can't be negative"))
+	}
+
+	if cfg.MaxAngularVelocityDegPerSec < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("max_angular_velocity_degs_per_sec can't be negative"))
+	}
+
+	if cfg.OpenLoopLinearMMPerSec < 0 || cfg.OpenLoopAngularDegPerSec < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("open loop velocities can't be negative"))
+	}
+
+	if cfg.MaxLinearAccelMMPerSec2 < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("max_linear_accel_mm_per_sec2 can't be negative"))
+	}
+
+	if cfg.MaxAngularAccelDegPerSec2 < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("max_angular_accel_degs_per_sec2 can't be negative"))
+	}
+
+	if cfg.MaxLinearJerkMMPerSec3 < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("max_linear_jerk_mm_per_sec3 can't be negative"))
+	}
+
+	if cfg.SpinToleranceDeg < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("spin_tolerance_deg can't be negative"))
+	}
+
+	if cfg.headingDeadband() < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("heading_deadband_deg can't be negative"))
+	}
+
+	if cfg.headingDeadband() >= cfg.headingRamp() {
+		return nil, utils.NewConfigValidationError(path, errors.New("heading_deadband_deg has to be less than heading_ramp_deg"))
+	}
+
+	if cfg.SpinPollMs < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("spin_poll_ms can't be negative"))
+	}
+
+	if cfg.MoveStraightStallSec < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("move_straight_stall_sec can't be negative"))
+	}
+
+	if cfg.SpinHeadingRetries != nil && *cfg.SpinHeadingRetries < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("spin_heading_retries can't be negative"))
+	}
+
+	if cfg.SpinTimeoutSec < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("spin_timeout_sec can't be negative"))
+	}
+
+	if cfg.StopRampMs < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("stop_ramp_ms can't be negative"))
+	}
+
+	if cfg.PowerSlewPerSec < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("power_slew_per_sec can't be negative"))
+	}
+
+	if cfg.MovingLinearMMPerSec < 0 || cfg.MovingAngularDegPerSec < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("moving thresholds can't be negative"))
+	}
+
+	if cfg.SpinUpStaggerMs < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("spin_up_stagger_ms can't be negative"))
+	}
+
+	if cfg.MotorKeepAliveMs < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("motor_keep_alive_ms can't be negative"))
+	}
+
+	if cfg.SensorTimeoutSec < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("sensor_timeout_sec can't be negative"))
+	}
+
+	if cfg.DeadReckoningSec < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("dead_reckoning_sec can't be negative"))
+	}
+
+	if cfg.BiasLearnRate < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("bias_learn_rate can't be negative"))
+	}
+
+	if cfg.ControlLoopMs < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("control_loop_ms has to be positive"))
+	}
+
+	if cfg.PowerSaturation != "" && cfg.PowerSaturation != powerSaturationOptimize && cfg.PowerSaturation != powerSaturationScale {
+		return nil, utils.NewConfigValidationError(path, fmt.Errorf("unknown power_saturation %q", cfg.PowerSaturation))
+	}
+
+	if cfg.MaxTotalPower < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("max_total_power can't be negative"))
+	}
+
+	if err := cfg.validateStartupMode(); err != nil {
+		return nil, utils.NewConfigValidationError(path, err)
+	}
+
+	if cfg.IdleStopSec < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("idle_stop_sec can't be negative"))
+	}
+
 	var deps []string
 
-	if cfg.MovementSensor != "" {
-		deps = append(deps, cfg.MovementSensor)
+	for _, name := range []string{cfg.MovementSensor, cfg.HeadingSensor, cfg.AngularVelocitySensor, cfg.LinearVelocitySensor} {
+		if name != "" {
+			deps = append(deps, name)
+		}
 	}
 
-	for _, m := range cfg.Motors {
+	if cfg.NominalVoltage < 0 || cfg.MinVoltage < 0 {
+		return nil, utils.NewConfigValidationError(path, errors.New("nominal_voltage and min_voltage can't be negative"))
+	}
+
+	if cfg.PowerSensor != "" {
+		deps = append(deps, cfg.PowerSensor)
+	}
+
+	if len(cfg.Geofence) > 0 && len(cfg.Geofence) < 3 {
+		return nil, utils.NewConfigValidationError(path, errors.New("geofence needs at least 3 points"))
+	}
+	if len(cfg.Geofence) > 0 && cfg.MovementSensor == "" {
+		return nil, utils.NewConfigValidationError(path, errors.New("geofence needs a movement_sensor that supports position"))
+	}
+
+	names := map[string]bool{}
+	for idx, m := range cfg.Motors {
+		if err := m.Validate(fmt.Sprintf("%s.motors.%d", path, idx)); err != nil {
+			return nil, err
+		}
+		if names[m.Name] {
+			return nil, utils.NewConfigValidationError(fmt.Sprintf("%s.motors.%d", path, idx), fmt.Errorf("motor %q is listed twice", m.Name))
+		}
+		names[m.Name] = true
 		deps = append(deps, m.Name)
 	}
 
+	if err := cfg.validateControllable(); err != nil {
+		return nil, utils.NewConfigValidationError(path+".motors", err)
+	}
+
 	return deps, nil
 }
 
+// boats don't have to be able to move sideways, but they do need to be able to go forward
+// and turn independently, otherwise some velocities can never be reached.
+const maxControlConditionNumber = 1e6
+
+// validateControllable checks that the motors can make forward and angular thrust independently
+func (cfg *Config) validateControllable() error {
+	if len(cfg.Motors) == 0 {
+		return nil
+	}
+
+	weights := cfg.weightsAsMatrix()
+	_, cols := weights.Dims()
+	forwardAndAngular := mat.NewDense(2, cols, nil)
+	forwardAndAngular.SetRow(0, mat.Row(nil, 1, weights))
+	forwardAndAngular.SetRow(1, mat.Row(nil, 2, weights))
+
+	if mat.Norm(forwardAndAngular.RowView(0), 2) == 0 {
+		return errors.New("no motor can push the boat forward or back")
+	}
+	if mat.Norm(forwardAndAngular.RowView(1), 2) == 0 {
+		return errors.New("no motor can turn the boat, they're all pushing through the center")
+	}
+
+	if cols < 2 {
+		return errors.New("one motor can't go forward and turn independently")
+	}
+
+	var svd mat.SVD
+	if !svd.Factorize(forwardAndAngular, mat.SVDNone) {
+		return errors.New("can't analyze motor layout")
+	}
+	if c := svd.Cond(); c > maxControlConditionNumber {
+		return fmt.Errorf("motors can't go forward and turn independently (condition number %v)", c)
+	}
+
+	return nil
+}
+
+func (cfg *Config) controlLoopTime() time.Duration {
+	if cfg.ControlLoopMs <= 0 {
+		return pidLoopTime
+	}
+	return time.Duration(cfg.ControlLoopMs * float64(time.Millisecond))
+}
+
+// anything slower than this isn't moving, for IsMoving
+const (
+	defaultMovingLinearMMPerSec   = 50
+	defaultMovingAngularDegPerSec = 2
+)
+
+func (cfg *Config) movingThresholds() (linear, angular float64) {
+	linear, angular = cfg.MovingLinearMMPerSec, cfg.MovingAngularDegPerSec
+	if linear <= 0 {
+		linear = defaultMovingLinearMMPerSec
+	}
+	if angular <= 0 {
+		angular = defaultMovingAngularDegPerSec
+	}
+	return linear, angular
+}
+
+func (cfg *Config) moveStraightStallTime() time.Duration {
+	if cfg.MoveStraightStallSec <= 0 {
+		return defaultMoveStraightStall
+	}
+	return time.Duration(cfg.MoveStraightStallSec * float64(time.Second))
+}
+
+func (cfg *Config) spinHeadingRetries() int {
+	if cfg.SpinHeadingRetries == nil {
+		return defaultSpinHeadingRetries
+	}
+	return *cfg.SpinHeadingRetries
+}
+
+func (cfg *Config) spinTolerance() float64 {
+	if cfg.SpinToleranceDeg <= 0 {
+		return 1
+	}
+	return cfg.SpinToleranceDeg
+}
+
+func (cfg *Config) spinPollTime() time.Duration {
+	if cfg.SpinPollMs <= 0 {
+		return defaultSpinPollTime
+	}
+	return time.Duration(cfg.SpinPollMs * float64(time.Millisecond))
+}
+
+func (cfg *Config) optimizerStopVal() float64 {
+	if cfg.OptimizerStopVal > 0 {
+		return cfg.OptimizerStopVal
+	}
+	return .002
+}
+
+func (cfg *Config) optimizerMaxTime() float64 {
+	if cfg.OptimizerMaxTimeSec > 0 {
+		return cfg.OptimizerMaxTimeSec
+	}
+	return .25
+}
+
+func (cfg *Config) linearWeight() float64 {
+	if cfg.LinearWeight == nil {
+		return 1
+	}
+	return *cfg.LinearWeight
+}
+
+func (cfg *Config) angularWeight() float64 {
+	if cfg.AngularWeight == nil {
+		return 1
+	}
+	return *cfg.AngularWeight
+}
+
+// objectiveScale is how much a miss on each axis counts, from linear_weight, lateral_weight, and
+// angular_weight, and divided by what the motors can do on that axis with normalize_objective
+func (cfg *Config) objectiveScale() motorWeights {
+	scale := motorWeights{linearX: cfg.linearWeight(), linearY: cfg.linearWeight(), angular: cfg.angularWeight()}
+	if cfg.LateralWeight != nil {
+		scale.linearX = *cfg.LateralWeight
+	}
+
+	if cfg.NormalizeObjective {
+		// an axis nothing pushes on can't be missed by any less, so it's left alone
+		max := cfg.maxWeights()
+		if max.linearX > 0 {
+			scale.linearX /= max.linearX
+		}
+		if max.linearY > 0 {
+			scale.linearY /= max.linearY
+		}
+		if max.angular > 0 {
+			scale.angular /= max.angular
+		}
+	}
+	return scale
+}
+
+func (cfg *Config) headingDeadband() float64 {
+	if cfg.HeadingDeadbandDeg == nil {
+		return 1
+	}
+	return *cfg.HeadingDeadbandDeg
+}
+
+func (cfg *Config) headingRamp() float64 {
+	if cfg.HeadingRampDeg == nil {
+		return 5
+	}
+	return *cfg.HeadingRampDeg
+}
+
+// clampLinearVelocity scales linear down to MaxLinearVelocityMMPerSec, keeping its direction.
+// the bool is true if it had to be clamped.
+func (cfg *Config) clampLinearVelocity(linear r3.Vector) (r3.Vector, bool) {
+	if cfg.MaxLinearVelocityMMPerSec <= 0 {
+		return linear, false
+	}
+	n := linear.Norm()
+	if n <= cfg.MaxLinearVelocityMMPerSec {
+		return linear, false
+	}
+	return linear.Mul(cfg.MaxLinearVelocityMMPerSec / n), true
+}
+
+// clampAngularVelocity limits degsPerSec to MaxAngularVelocityDegPerSec, keeping its sign.
+// the bool is true if it had to be clamped.
+func (cfg *Config) clampAngularVelocity(degsPerSec float64) (float64, bool) {
+	if cfg.MaxAngularVelocityDegPerSec <= 0 || math.Abs(degsPerSec) <= cfg.MaxAngularVelocityDegPerSec {
+		return degsPerSec, false
+	}
+	return math.Copysign(cfg.MaxAngularVelocityDegPerSec, degsPerSec), true
+}
+
+// clampPowerInput limits SetPower's linear and angular to -1..1, or less if the max velocities
+// are below the open loop full power speeds, so full power can't go faster than them. linear is
+// scaled down as a whole to keep its direction. the bool is true if either had to be clamped.
+func (cfg *Config) clampPowerInput(linear, angular r3.Vector) (r3.Vector, r3.Vector, bool) {
+	maxLinear, maxAngular := 1.0, 1.0
+	fullLinear, fullAngular := cfg.openLoopSpeeds()
+	if cfg.MaxLinearVelocityMMPerSec > 0 {
+		maxLinear = math.Min(1, cfg.MaxLinearVelocityMMPerSec/fullLinear)
+	}
+	if cfg.MaxAngularVelocityDegPerSec > 0 {
+		maxAngular = math.Min(1, cfg.MaxAngularVelocityDegPerSec/fullAngular)
+	}
+
+	clamped := false
+	if n := math.Max(math.Abs(linear.X), math.Abs(linear.Y)); n > maxLinear {
+		linear.X *= maxLinear / n
+		linear.Y *= maxLinear / n
+		clamped = true
+	}
+	if math.Abs(angular.Z) > maxAngular {
+		angular.Z = math.Copysign(maxAngular, angular.Z)
+		clamped = true
+	}
+	return linear, angular, clamped
+}
+
 func (cfg *Config) maxWeights() motorWeights {
+	if cfg.fullMaxWeights != nil {
+		return *cfg.fullMaxWeights
+	}
+
 	var max motorWeights
 	for _, mc := range cfg.Motors {
 		w := mc.computeWeights(math.Hypot(cfg.WidthMM, cfg.LengthMM))
@@ -52,6 +622,36 @@ func (cfg *Config) maxWeights() motorWeights {
 	return max
 }
 
+// outputRange is the most the motors can push along each axis in each direction, taking
+// power limits and reverse thrust into account, as a fraction of maxWeights. With no
+// limits that's -1 to 1 on every axis.
+func (cfg *Config) outputRange() (min, max motorWeights) {
+	total := cfg.maxWeights()
+	for _, mc := range cfg.Motors {
+		w := mc.computeWeights(math.Hypot(cfg.WidthMM, cfg.LengthMM))
+		low, high := mc.effectivePower(mc.minPower()), mc.effectivePower(mc.maxPower())
+
+		add := func(weight float64, min, max *float64) {
+			a, b := weight*low, weight*high
+			*min += math.Min(a, b)
+			*max += math.Max(a, b)
+		}
+		add(w.linearX, &min.linearX, &max.linearX)
+		add(w.linearY, &min.linearY, &max.linearY)
+		add(w.angular, &min.angular, &max.angular)
+	}
+
+	scale := func(v, total float64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return v / total
+	}
+	min = motorWeights{scale(min.linearX, total.linearX), scale(min.linearY, total.linearY), scale(min.angular, total.angular)}
+	max = motorWeights{scale(max.linearX, total.linearX), scale(max.linearY, total.linearY), scale(max.angular, total.angular)}
+	return min, max
+}
+
 // examples:
 //    currentVal=2 otherVal=1, currentGoal=1, otherGoal=1 = 1
 //    currentVal=-2 otherVal=1, currentGoal=1, otherGoal=1 = -1
@@ -72,7 +672,30 @@ func goalScale(currentVal, otherVal, currentGoal, otherGoal float64) float64 {
 	return currentVal
 }
 
+// how much sideways thrust all the motors together need before the boat counts as able to move sideways
+const lateralEpsilon = 1e-9
+
+// lateralPID is the config for the lateral pid, the linear one unless it's set
+func (cfg *Config) lateralPID() *PIDConfig {
+	if cfg.LateralPID != nil {
+		return cfg.LateralPID
+	}
+	return cfg.LinearPID
+}
+
+// lateralEnabled is true if the boat should push sideways, which needs a motor that can
+// and disable_lateral not set
+func (cfg *Config) lateralEnabled() bool {
+	return !cfg.DisableLateral && cfg.maxWeights().linearX > lateralEpsilon
+}
+
 func (cfg *Config) computeGoal(linear, angular r3.Vector) motorWeights {
+	// otherwise asking for some sideways a boat can't do would scale forward down to nothing
+	// to keep the ratio
+	if !cfg.lateralEnabled() {
+		linear.X = 0
+	}
+
 	w := cfg.maxWeights()
 	w.linearX *= linear.X
 	w.linearY *= linear.Y
@@ -107,25 +730,32 @@ func (cfg *Config) weightsAsMatrix() *mat.Dense {
 	return m
 }
 
-func (cfg *Config) ComputePowerOutputAsMatrix(powers []float64) mat.Dense {
+func (cfg *Config) ComputePowerOutputAsMatrix(powers []float64) (mat.Dense, error) {
+	var out mat.Dense
 	if len(powers) != len(cfg.Motors) {
-		panic(fmt.Errorf("powers wrong length got: %d should be: %d", len(powers), len(cfg.Motors)))
+		return out, fmt.Errorf("powers wrong length got: %d should be: %d", len(powers), len(cfg.Motors))
+	}
+	effective := make([]float64, len(powers))
+	for idx, mc := range cfg.Motors {
+		effective[idx] = mc.effectivePower(powers[idx])
 	}
-	var out mat.Dense
 
-	out.Mul(cfg.weightsAsMatrix(), mat.NewDense(len(powers), 1, powers))
+	out.Mul(cfg.weightsAsMatrix(), mat.NewDense(len(powers), 1, effective))
 
-	return out
+	return out, nil
 }
 
-func (cfg *Config) ComputePowerOutput(powers []float64) motorWeights {
-	out := cfg.ComputePowerOutputAsMatrix(powers)
+func (cfg *Config) ComputePowerOutput(powers []float64) (motorWeights, error) {
+	out, err := cfg.ComputePowerOutputAsMatrix(powers)
+	if err != nil {
+		return motorWeights{}, err
+	}
 
 	return motorWeights{
 		linearX: out.At(0, 0),
 		linearY: out.At(1, 0),
 		angular: out.At(2, 0),
-	}
+	}, nil
 }
 
 // returns an array of power for each motors
@@ -137,46 +767,359 @@ func (cfg *Config) ComputePowerOutput(powers []float64) motorWeights {
 //
 //	note only z is relevant here
 func (cfg *Config) ComputePower(linear, angular r3.Vector) ([]float64, error) {
-	goal := cfg.computeGoal(linear, angular)
-	numMotrs := uint(len(cfg.Motors))
-	opt, err := nlopt.NewNLopt(nlopt.GN_DIRECT, numMotrs)
+	return cfg.computePower(linear, angular, nil)
+}
+
+// ComputePowerWithResidual is ComputePower, also returning how far what the motors will do is from
+// what was asked for, in the same units the optimizer uses. near 0 means the goal can be met.
+func (cfg *Config) ComputePowerWithResidual(linear, angular r3.Vector) ([]float64, float64, error) {
+	powers, err := cfg.ComputePower(linear, angular)
+	if err != nil {
+		return nil, 0, err
+	}
+	residual, err := cfg.residual(linear, angular, powers)
+	if err != nil {
+		return nil, 0, err
+	}
+	return powers, residual, nil
+}
+
+// residual is the optimizer objective for powers, the weighted miss between their output and the goal
+func (cfg *Config) residual(linear, angular r3.Vector, powers []float64) (float64, error) {
+	out, err := cfg.ComputePowerOutput(powers)
+	if err != nil {
+		return 0, err
+	}
+	return out.weightedDiff(cfg.computeGoal(linear, angular), cfg.objectiveScale()), nil
+}
+
+// ComputePowerByName is ComputePower, but keyed by motor name instead of position in the config
+func (cfg *Config) ComputePowerByName(linear, angular r3.Vector) (map[string]float64, error) {
+	powers, err := cfg.ComputePower(linear, angular)
 	if err != nil {
 		return nil, err
 	}
-	defer opt.Destroy()
+	return cfg.powerByName(powers), nil
+}
+
+// powerByName keys powers, which are in config order, by motor name
+func (cfg *Config) powerByName(powers []float64) map[string]float64 {
+	res := make(map[string]float64, len(powers))
+	for idx, p := range powers {
+		res[cfg.Motors[idx].Name] = p
+	}
+	return res
+}
+
+// motorConfig is the config for the motor called name, or nil if there is no such motor
+func (cfg *Config) motorConfig(name string) *MotorConfig {
+	for idx := range cfg.Motors {
+		if cfg.Motors[idx].Name == name {
+			return &cfg.Motors[idx]
+		}
+	}
+	return nil
+}
+
+// computePower is ComputePower, but solved by solver.
+// If solver is nil, a new optimizer is created and destroyed for this call.
+func (cfg *Config) computePower(linear, angular r3.Vector, solver PowerSolver) ([]float64, error) {
+	if solver == nil {
+		var po powerOptimizer
+		defer po.Close()
+		solver = &po
+	}
+	powers, err := solver.Solve(cfg, linear, angular)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.limitTotalPower(powers), nil
+}
+
+// limitTotalPower scales powers down together so they add up to no more than max_total_power
+func (cfg *Config) limitTotalPower(powers []float64) []float64 {
+	if cfg.MaxTotalPower <= 0 {
+		return powers
+	}
+
+	total := 0.0
+	for _, p := range powers {
+		total += math.Abs(p)
+	}
+	if total <= cfg.MaxTotalPower {
+		return powers
+	}
+
+	scale := cfg.MaxTotalPower / total
+	for idx := range powers {
+		powers[idx] *= scale
+	}
+	return powers
+}
+
+// limitTotalOutput is limitTotalPower on what's sent to each motor by name. the battery scale,
+// trim, deadband, and quantum can all add to the total, and the cap wins over them, even if that
+// leaves a motor under its deadband or between steps.
+func (cfg *Config) limitTotalOutput(out map[string]float64) {
+	if cfg.MaxTotalPower <= 0 {
+		return
+	}
+
+	total := 0.0
+	for _, p := range out {
+		total += math.Abs(p)
+	}
+	if total <= cfg.MaxTotalPower {
+		return
+	}
+
+	scale := cfg.MaxTotalPower / total
+	for name := range out {
+		out[name] *= scale
+	}
+}
+
+// how much clamping the analytic solution can change a motor's power before we fall back to the optimizer
+const analyticClampTolerance = .001
+
+// computePowerAnalytic solves for the minimum norm powers that produce goal using the pseudoinverse
+// of the weight matrix. The bool is false if that solution doesn't fit within the motor limits,
+// in which case the caller should use the optimizer instead.
+func (cfg *Config) computePowerAnalytic(goal motorWeights) ([]float64, bool) {
+	if len(cfg.Motors) == 0 {
+		return nil, false
+	}
+
+	x, ok := cfg.solveWithReverseThrust(goal)
+	if !ok {
+		return nil, false
+	}
+
+	powers := make([]float64, len(cfg.Motors))
+	for idx, mc := range cfg.Motors {
+		p := x.AtVec(idx)
+		clamped := mc.clampPower(p)
+		if math.Abs(clamped-p) > analyticClampTolerance {
+			return nil, false
+		}
+		powers[idx] = clamped
+	}
+
+	return powers, true
+}
+
+// solveWithReverseThrust is the pseudoinverse solution for goal, unclamped, with the motors that
+// are weaker in reverse scaled down by reverse_thrust_scale where they reverse. the bool is false
+// if there's no solution, or if scaling them makes one switch direction, since then neither
+// solution is right.
+func (cfg *Config) solveWithReverseThrust(goal motorWeights) (*mat.VecDense, bool) {
+	weights := cfg.weightsAsMatrix()
+	x, ok := solvePseudoInverse(weights, goal)
+	if !ok {
+		return nil, false
+	}
+
+	// motors that are weaker in reverse are only linear for one sign, so solve again
+	// with the reversing motors scaled down, and make sure no motor switched direction
+	needsResolve := false
+	for idx, mc := range cfg.Motors {
+		if x.AtVec(idx) < 0 && mc.reverseThrustScale() != 1 {
+			needsResolve = true
+			for r := 0; r < 3; r++ {
+				weights.Set(r, idx, weights.At(r, idx)*mc.reverseThrustScale())
+			}
+		}
+	}
+
+	if needsResolve {
+		reversing := x
+		x, ok = solvePseudoInverse(weights, goal)
+		if !ok {
+			return nil, false
+		}
+		for idx, mc := range cfg.Motors {
+			if mc.reverseThrustScale() != 1 && (reversing.AtVec(idx) < 0) != (x.AtVec(idx) < 0) {
+				return nil, false
+			}
+		}
+	}
+
+	return x, true
+}
+
+// computePowerSaturated is the analytic solution for when some motors can't give what the
+// pseudoinverse asks for. those motors are held at their limit and the rest are solved again to
+// make up for them, until none of the rest are over. the bool is false if it can't be solved.
+func (cfg *Config) computePowerSaturated(goal motorWeights) ([]float64, bool) {
+	if len(cfg.Motors) == 0 {
+		return nil, false
+	}
+
+	all := cfg.weights()
+	scale := cfg.objectiveScale()
+
+	powers := make([]float64, len(cfg.Motors))
+	fixed := make([]bool, len(cfg.Motors))
+
+	for {
+		// what's left of the goal after the motors at their limits
+		left := goal
+		free := []int{}
+		for idx, mc := range cfg.Motors {
+			if !fixed[idx] {
+				free = append(free, idx)
+				continue
+			}
+			p := mc.effectivePower(powers[idx])
+			left.linearX -= all[idx].linearX * p
+			left.linearY -= all[idx].linearY * p
+			left.angular -= all[idx].angular * p
+		}
+		if len(free) == 0 {
+			return powers, true
+		}
+
+		// weighted the same way the optimizer weighs misses, so it gives up on the same things
+		weights := mat.NewDense(3, len(free), nil)
+		for col, idx := range free {
+			weights.Set(0, col, scale.linearX*all[idx].linearX)
+			weights.Set(1, col, scale.linearY*all[idx].linearY)
+			weights.Set(2, col, scale.angular*all[idx].angular)
+		}
+		left = motorWeights{scale.linearX * left.linearX, scale.linearY * left.linearY, scale.angular * left.angular}
+
+		x, ok := solvePseudoInverse(weights, left)
+		if !ok {
+			return nil, false
+		}
+
+		saturated := false
+		for col, idx := range free {
+			mc := &cfg.Motors[idx]
+			p := x.AtVec(col)
+			powers[idx] = mc.clampPower(p)
+			if p < mc.minPower() || p > mc.maxPower() {
+				fixed[idx] = true
+				saturated = true
+			}
+		}
+		if !saturated {
+			return powers, true
+		}
+	}
+}
+
+func solvePseudoInverse(weights *mat.Dense, goal motorWeights) (*mat.VecDense, bool) {
+	var svd mat.SVD
+	if !svd.Factorize(weights, mat.SVDThin) {
+		return nil, false
+	}
+
+	rank := svd.Rank(1e-9)
+	if rank == 0 {
+		return nil, false
+	}
+
+	var x mat.VecDense
+	svd.SolveVecTo(&x, mat.NewVecDense(3, []float64{goal.linearX, goal.linearY, goal.angular}), rank)
+	return &x, true
+}
+
+func (cfg *Config) computePowerOptimizer(goal motorWeights) ([]float64, error) {
+	var po powerOptimizer
+	defer po.Close()
+	return po.optimize(cfg, goal)
+}
+
+// powerOptimizer holds on to an nlopt optimizer between calls, since creating and destroying
+// one every control loop is expensive. It is rebuilt if the number of motors changes.
+type powerOptimizer struct {
+	mu        sync.Mutex
+	opt       *nlopt.NLopt
+	numMotors uint
+
+	// what the objective is currently solving for, only valid while mu is held
+	cfg  *Config
+	goal motorWeights
+}
+
+func (po *powerOptimizer) optimize(cfg *Config, goal motorWeights) ([]float64, error) {
+	po.mu.Lock()
+	defer po.mu.Unlock()
+
+	numMotrs := uint(len(cfg.Motors))
+	if po.opt == nil || po.numMotors != numMotrs {
+		po.closeInLock()
+
+		opt, err := nlopt.NewNLopt(nlopt.GN_DIRECT, numMotrs)
+		if err != nil {
+			return nil, err
+		}
+
+		// the objective is only set once, since every call registers a new callback with nlopt
+		myfunc := func(x, gradient []float64) float64 {
+			total, err := po.cfg.ComputePowerOutput(x)
+			if err != nil {
+				// can't happen, nlopt always gives us one power per motor
+				return math.MaxFloat64
+			}
+			return total.weightedDiff(po.goal, po.cfg.objectiveScale())
+		}
+
+		err = opt.SetMinObjective(myfunc)
+		if err != nil {
+			opt.Destroy()
+			return nil, err
+		}
+
+		po.opt = opt
+		po.numMotors = numMotrs
+	}
+
+	po.cfg = cfg
+	po.goal = goal
 
 	mins := []float64{}
 	maxs := []float64{}
 
-	for range cfg.Motors {
-		mins = append(mins, -1)
-		maxs = append(maxs, 1)
+	for _, mc := range cfg.Motors {
+		mins = append(mins, mc.minPower())
+		maxs = append(maxs, mc.maxPower())
 	}
 
-	err = multierr.Combine(
-		opt.SetLowerBounds(mins),
-		opt.SetUpperBounds(maxs),
+	err := multierr.Combine(
+		po.opt.SetLowerBounds(mins),
+		po.opt.SetUpperBounds(maxs),
 
-		opt.SetStopVal(.002),
-		opt.SetMaxTime(.25),
+		po.opt.SetStopVal(cfg.optimizerStopVal()),
+		po.opt.SetMaxTime(cfg.optimizerMaxTime()),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	myfunc := func(x, gradient []float64) float64 {
-		total := cfg.ComputePowerOutput(x)
-		return total.diff(goal)
+	start := make([]float64, numMotrs)
+	for idx, mc := range cfg.Motors {
+		start[idx] = mc.clampPower(0)
 	}
 
-	err = opt.SetMinObjective(myfunc)
-	if err != nil {
-		return nil, err
-	}
-	powers, _, err := opt.Optimize(make([]float64, numMotrs))
+	powers, _, err := po.opt.Optimize(start)
 	if err != nil {
 		return nil, err
 	}
 
 	return powers, nil
 }
+
+func (po *powerOptimizer) Close() {
+	po.mu.Lock()
+	defer po.mu.Unlock()
+	po.closeInLock()
+}
+
+func (po *powerOptimizer) closeInLock() {
+	if po.opt != nil {
+		po.opt.Destroy()
+		po.opt = nil
+	}
+}
@@ -3,7 +3,9 @@ package viamboatbase
 import (
 	"encoding/json"
 	"io/ioutil"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/golang/geo/r3"
 	"go.viam.com/test"
@@ -18,6 +20,14 @@ var testMotorConfig = []MotorConfig{
 	{Name: "port-lateral", XOffsetMM: -450, YOffsetMM: 0, AngleDegrees: -90, Weight: 1},
 }
 
+// powerOutput is ComputePowerOutput for powers that are known to be the right length
+func powerOutput(t *testing.T, cfg *Config, powers []float64) motorWeights {
+	t.Helper()
+	out, err := cfg.ComputePowerOutput(powers)
+	test.That(t, err, test.ShouldBeNil)
+	return out
+}
+
 func TestBoatConfig(t *testing.T) {
 	cfg := Config{
 		Motors:   testMotorConfig,
@@ -83,7 +93,8 @@ func TestBoatConfig(t *testing.T) {
 	test.That(t, powers[5], test.ShouldAlmostEqual, 0, testTheta)
 
 	t.Run("matrix-base", func(t *testing.T) {
-		m := cfg.ComputePowerOutputAsMatrix([]float64{0, 0, 0, 0, 0, 0})
+		m, err := cfg.ComputePowerOutputAsMatrix([]float64{0, 0, 0, 0, 0, 0})
+		test.That(t, err, test.ShouldBeNil)
 		r, c := m.Dims()
 		test.That(t, 3, test.ShouldEqual, r)
 		test.That(t, 1, test.ShouldEqual, c)
@@ -91,7 +102,7 @@ func TestBoatConfig(t *testing.T) {
 		for idx, w := range cfg.weights() {
 			powers := make([]float64, 6)
 			powers[idx] = 1
-			out := cfg.ComputePowerOutput(powers)
+			out := powerOutput(t, &cfg, powers)
 			test.That(t, w, test.ShouldResemble, out)
 		}
 	})
@@ -99,44 +110,44 @@ func TestBoatConfig(t *testing.T) {
 	l, a := r3.Vector{1, 0, 0}, r3.Vector{}
 	powers, err = cfg.ComputePower(l, a)
 	test.That(t, err, test.ShouldBeNil)
-	test.That(t, cfg.ComputePowerOutput(powers), weightsAlmostEqual, cfg.computeGoal(l, a))
+	test.That(t, powerOutput(t, &cfg, powers), weightsAlmostEqual, cfg.computeGoal(l, a))
 
 	l, a = r3.Vector{0, 1, 0}, r3.Vector{}
 	powers, err = cfg.ComputePower(l, a)
 	test.That(t, err, test.ShouldBeNil)
-	test.That(t, cfg.ComputePowerOutput(powers), weightsAlmostEqual, cfg.computeGoal(l, a))
+	test.That(t, powerOutput(t, &cfg, powers), weightsAlmostEqual, cfg.computeGoal(l, a))
 
 	l, a = r3.Vector{-.5, 1, 0}, r3.Vector{}
 	powers, err = cfg.ComputePower(l, a)
 	test.That(t, err, test.ShouldBeNil)
-	test.That(t, cfg.ComputePowerOutput(powers), weightsAlmostEqual, cfg.computeGoal(l, a))
+	test.That(t, powerOutput(t, &cfg, powers), weightsAlmostEqual, cfg.computeGoal(l, a))
 
 	l, a = r3.Vector{}, r3.Vector{Z: .125}
 	powers, err = cfg.ComputePower(l, a)
 	test.That(t, err, test.ShouldBeNil)
-	test.That(t, cfg.ComputePowerOutput(powers), weightsAlmostEqual, cfg.computeGoal(l, a))
+	test.That(t, powerOutput(t, &cfg, powers), weightsAlmostEqual, cfg.computeGoal(l, a))
 
 	l, a = r3.Vector{X: 1, Y: 1}, r3.Vector{}
 	powers, err = cfg.ComputePower(l, a)
 	test.That(t, err, test.ShouldBeNil)
-	test.That(t, cfg.ComputePowerOutput(powers), weightsAlmostEqual, cfg.computeGoal(l, a))
+	test.That(t, powerOutput(t, &cfg, powers), weightsAlmostEqual, cfg.computeGoal(l, a))
 	test.That(t, powers[0]+powers[1]+powers[2]+-1*powers[3], test.ShouldAlmostEqual, powers[4]+-1*powers[5], .01)
 
 	l, a = r3.Vector{X: .2, Y: 1}, r3.Vector{}
 	powers, err = cfg.ComputePower(l, a)
 	test.That(t, err, test.ShouldBeNil)
-	test.That(t, cfg.ComputePowerOutput(powers), weightsAlmostEqual, cfg.computeGoal(l, a))
+	test.That(t, powerOutput(t, &cfg, powers), weightsAlmostEqual, cfg.computeGoal(l, a))
 
 	l, a = r3.Vector{X: -1, Y: -1}, r3.Vector{}
 	powers, err = cfg.ComputePower(l, a)
 	test.That(t, err, test.ShouldBeNil)
-	test.That(t, cfg.ComputePowerOutput(powers), weightsAlmostEqual, cfg.computeGoal(l, a))
+	test.That(t, powerOutput(t, &cfg, powers), weightsAlmostEqual, cfg.computeGoal(l, a))
 	test.That(t, powers[0]+powers[1]+powers[2]+-1*powers[3], test.ShouldAlmostEqual, powers[4]+-1*powers[5], .01)
 
 	l, a = r3.Vector{X: -.9, Y: -.9}, r3.Vector{}
 	powers, err = cfg.ComputePower(l, a)
 	test.That(t, err, test.ShouldBeNil)
-	test.That(t, cfg.ComputePowerOutput(powers), weightsAlmostEqual, cfg.computeGoal(l, a))
+	test.That(t, powerOutput(t, &cfg, powers), weightsAlmostEqual, cfg.computeGoal(l, a))
 	test.That(t, powers[0]+powers[1]+powers[2]+-1*powers[3], test.ShouldAlmostEqual, powers[4]+-1*powers[5], .01)
 
 	l, a = r3.Vector{X: 0, Y: 1}, r3.Vector{Z: .05}
@@ -205,3 +216,554 @@ func TestRoboat4(t *testing.T) {
 	test.That(t, powers[1], test.ShouldAlmostEqual, -1, .02)
 
 }
+
+func TestConfigValidatePID(t *testing.T) {
+	file, err := ioutil.ReadFile("examples/roboat4.json")
+	test.That(t, err, test.ShouldBeNil)
+
+	config := Config{}
+	err = json.Unmarshal([]byte(file), &config)
+	test.That(t, err, test.ShouldBeNil)
+
+	_, err = config.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	err = json.Unmarshal([]byte(`{"angular_pid": {"p": 0.2, "d": -1}}`), &config)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, *config.AngularPID.P, test.ShouldEqual, .2)
+
+	_, err = config.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestLateralPIDConfig(t *testing.T) {
+	p, lateralP := .01, .02
+	cfg := &Config{Motors: testMotorConfig, LengthMM: 500, WidthMM: 500, LinearPID: &PIDConfig{P: &p}}
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	// goes with linear until it's set
+	var state boatState
+	state.configure(cfg)
+	test.That(t, state.lateral, test.ShouldBeTrue)
+	test.That(t, state.lateralPID.config(), test.ShouldResemble, state.linearPID.config())
+
+	cfg.LateralPID = &PIDConfig{P: &lateralP}
+	state.configure(cfg)
+	test.That(t, *state.lateralPID.config().P, test.ShouldEqual, .02)
+	test.That(t, *state.linearPID.config().P, test.ShouldEqual, .01)
+
+	// a boat that can't go sideways doesn't run it
+	state.configure(&Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100})
+	test.That(t, state.lateral, test.ShouldBeFalse)
+
+	bad := -1.0
+	cfg.LateralPID = &PIDConfig{D: &bad}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestComputePowerAnalytic(t *testing.T) {
+	file, err := ioutil.ReadFile("examples/roboat4.json")
+	test.That(t, err, test.ShouldBeNil)
+
+	roboat4 := Config{}
+	err = json.Unmarshal([]byte(file), &roboat4)
+	test.That(t, err, test.ShouldBeNil)
+
+	configs := []Config{
+		{Motors: testMotorConfig, LengthMM: 500, WidthMM: 500},
+		roboat4,
+	}
+
+	commands := [][2]r3.Vector{
+		{{Y: 1}, {}},
+		{{Y: -1}, {}},
+		{{Y: .5}, {}},
+		{{}, {Z: 1}},
+		{{}, {Z: -.3}},
+		{{X: .2, Y: .5}, {}},
+		{{Y: .5}, {Z: .2}},
+	}
+
+	for _, cfg := range configs {
+		for _, c := range commands {
+			goal := cfg.computeGoal(c[0], c[1])
+
+			analytic, ok := cfg.computePowerAnalytic(goal)
+			if !ok {
+				continue
+			}
+			test.That(t, len(analytic), test.ShouldEqual, len(cfg.Motors))
+
+			optimized, err := cfg.computePowerOptimizer(goal)
+			test.That(t, err, test.ShouldBeNil)
+
+			optimizedOutput := powerOutput(t, &cfg, optimized)
+			analyticOutput := powerOutput(t, &cfg, analytic)
+			test.That(t, analyticOutput, weightsAlmostEqual, optimizedOutput)
+			test.That(t, analyticOutput.diff(goal), test.ShouldBeLessThanOrEqualTo, optimizedOutput.diff(goal)+testTheta)
+		}
+	}
+
+	// full forward is exactly solvable
+	cfg := configs[0]
+	powers, ok := cfg.computePowerAnalytic(cfg.computeGoal(r3.Vector{Y: 1}, r3.Vector{}))
+	test.That(t, ok, test.ShouldBeTrue)
+	for idx, p := range []float64{1, 1, 1, -1, 0, 0} {
+		test.That(t, powers[idx], test.ShouldAlmostEqual, p)
+	}
+
+	// more than the motors can do needs the optimizer
+	_, ok = cfg.computePowerAnalytic(motorWeights{linearY: 10})
+	test.That(t, ok, test.ShouldBeFalse)
+}
+
+func TestComputePowerSaturated(t *testing.T) {
+	// the forward motor is limited, so going forward has to lean on the rotation motors more
+	limit := .2
+	motors := append([]MotorConfig{}, testMotorConfig...)
+	motors[2].MaxPower = &limit
+	cfg := Config{Motors: motors, LengthMM: 500, WidthMM: 500}
+
+	goal := cfg.computeGoal(r3.Vector{Y: .5}, r3.Vector{})
+	_, ok := cfg.computePowerAnalytic(goal)
+	test.That(t, ok, test.ShouldBeFalse)
+
+	// just clamping the unlimited solution misses
+	x, ok := solvePseudoInverse(cfg.weightsAsMatrix(), goal)
+	test.That(t, ok, test.ShouldBeTrue)
+	clamped := make([]float64, len(cfg.Motors))
+	for idx := range cfg.Motors {
+		clamped[idx] = cfg.Motors[idx].clampPower(x.AtVec(idx))
+	}
+	test.That(t, clamped[0], test.ShouldAlmostEqual, .5)
+	clampedOutput := powerOutput(t, &cfg, clamped)
+	test.That(t, clampedOutput.diff(goal), test.ShouldBeGreaterThan, .1)
+
+	powers, ok := cfg.computePowerSaturated(goal)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, powers[2], test.ShouldAlmostEqual, .2)
+	test.That(t, powers[0], test.ShouldBeGreaterThan, .5)
+	test.That(t, powers[1], test.ShouldAlmostEqual, powers[0])
+	for idx, mc := range cfg.Motors {
+		test.That(t, powers[idx], test.ShouldBeBetweenOrEqual, mc.minPower(), mc.maxPower())
+	}
+	test.That(t, powerOutput(t, &cfg, powers), weightsAlmostEqual, goal)
+
+	// and that's what the boat uses
+	var po powerOptimizer
+	defer po.Close()
+	solved, err := po.Solve(&cfg, r3.Vector{Y: .5}, r3.Vector{})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, solved, test.ShouldResemble, powers)
+
+	// asking for more than the motors can do at all still stays in the limits
+	powers, ok = cfg.computePowerSaturated(motorWeights{linearY: 10})
+	test.That(t, ok, test.ShouldBeTrue)
+	for idx, mc := range cfg.Motors {
+		test.That(t, powers[idx], test.ShouldBeBetweenOrEqual, mc.minPower(), mc.maxPower())
+	}
+}
+
+func TestPowerOptimizerReuse(t *testing.T) {
+	cfg := Config{
+		Motors:   testMotorConfig,
+		LengthMM: 500,
+		WidthMM:  500,
+	}
+
+	var po powerOptimizer
+	defer po.Close()
+
+	for _, l := range []r3.Vector{{X: 1, Y: 1}, {X: -1, Y: -1}} {
+		goal := cfg.computeGoal(l, r3.Vector{})
+		powers, err := po.optimize(&cfg, goal)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, powerOutput(t, &cfg, powers), weightsAlmostEqual, goal)
+	}
+
+	// a different number of motors gets a new optimizer
+	small := Config{Motors: testMotorConfig[:2], LengthMM: 500, WidthMM: 500}
+	powers, err := po.optimize(&small, motorWeights{linearY: 2})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(powers), test.ShouldEqual, 2)
+	test.That(t, po.numMotors, test.ShouldEqual, 2)
+}
+
+func BenchmarkComputePowerOptimizer(b *testing.B) {
+	cfg := Config{
+		Motors:   testMotorConfig,
+		LengthMM: 500,
+		WidthMM:  500,
+	}
+	goal := cfg.computeGoal(r3.Vector{X: 1, Y: 1}, r3.Vector{})
+
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			cfg.computePowerOptimizer(goal)
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		var po powerOptimizer
+		defer po.Close()
+
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			po.optimize(&cfg, goal)
+		}
+	})
+}
+
+func TestOptimizerConfig(t *testing.T) {
+	cfg := Config{LengthMM: 500, WidthMM: 500}
+	test.That(t, cfg.optimizerStopVal(), test.ShouldEqual, .002)
+	test.That(t, cfg.optimizerMaxTime(), test.ShouldEqual, .25)
+
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	cfg.OptimizerStopVal = .01
+	cfg.OptimizerMaxTimeSec = .05
+	test.That(t, cfg.optimizerStopVal(), test.ShouldEqual, .01)
+	test.That(t, cfg.optimizerMaxTime(), test.ShouldEqual, .05)
+
+	cfg.OptimizerStopVal = -1
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg.OptimizerStopVal = 0
+	cfg.OptimizerMaxTimeSec = -1
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestControlLoopConfig(t *testing.T) {
+	cfg := Config{LengthMM: 500, WidthMM: 500}
+	test.That(t, cfg.controlLoopTime(), test.ShouldEqual, pidLoopTime)
+
+	cfg.ControlLoopMs = 100
+	test.That(t, cfg.controlLoopTime(), test.ShouldEqual, 100*time.Millisecond)
+
+	cfg.ControlLoopMs = -1
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestComputePowerMotorLimits(t *testing.T) {
+	min, max := -.3, .5
+	motors := append([]MotorConfig{}, testMotorConfig...)
+	motors[2].MaxPower = &max
+	motors[3].MinPower = &min
+
+	cfg := Config{
+		Motors:   motors,
+		LengthMM: 500,
+		WidthMM:  500,
+	}
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	for _, l := range []r3.Vector{{Y: 1}, {Y: .5}, {X: 1, Y: 1}} {
+		powers, err := cfg.ComputePower(l, r3.Vector{})
+		test.That(t, err, test.ShouldBeNil)
+		for idx, mc := range cfg.Motors {
+			test.That(t, powers[idx], test.ShouldBeBetweenOrEqual, mc.minPower(), mc.maxPower())
+		}
+	}
+
+	powers, err := cfg.ComputePower(r3.Vector{Y: 1}, r3.Vector{})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, powers[2], test.ShouldAlmostEqual, .5, testTheta)
+	test.That(t, powers[3], test.ShouldAlmostEqual, -.3, testTheta)
+}
+
+func TestComputePowerReverseThrustScale(t *testing.T) {
+	scale := .6
+	cfg := Config{
+		Motors: []MotorConfig{
+			{Name: "port", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1, ReverseThrustScale: &scale},
+			{Name: "starboard", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1},
+		},
+		LengthMM: 3048,
+		WidthMM:  1100,
+	}
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	// forward is unchanged
+	out := powerOutput(t, &cfg, []float64{1, 1})
+	test.That(t, out.linearY, test.ShouldAlmostEqual, 2)
+	test.That(t, out.angular, test.ShouldAlmostEqual, 0)
+
+	// in reverse the port motor is weaker, so we'd turn
+	out = powerOutput(t, &cfg, []float64{-1, -1})
+	test.That(t, out.linearY, test.ShouldAlmostEqual, -1.6)
+	test.That(t, out.angular, test.ShouldNotAlmostEqual, 0)
+
+	// but the allocation makes up for it
+	powers, err := cfg.ComputePower(r3.Vector{Y: -.5}, r3.Vector{})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, powers[0], test.ShouldBeLessThan, powers[1])
+	out = powerOutput(t, &cfg, powers)
+	test.That(t, out.linearY, test.ShouldAlmostEqual, -1, testTheta)
+	test.That(t, out.angular, test.ShouldAlmostEqual, 0, testTheta)
+
+	bad := 1.5
+	cfg.Motors[1].ReverseThrustScale = &bad
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestClampVelocity(t *testing.T) {
+	cfg := Config{}
+
+	l, clamped := cfg.clampLinearVelocity(r3.Vector{Y: 10000})
+	test.That(t, clamped, test.ShouldBeFalse)
+	test.That(t, l, test.ShouldResemble, r3.Vector{Y: 10000})
+
+	a, clamped := cfg.clampAngularVelocity(1000)
+	test.That(t, clamped, test.ShouldBeFalse)
+	test.That(t, a, test.ShouldEqual, 1000)
+
+	cfg.MaxLinearVelocityMMPerSec = 500
+	cfg.MaxAngularVelocityDegPerSec = 30
+
+	l, clamped = cfg.clampLinearVelocity(r3.Vector{X: 300, Y: 400})
+	test.That(t, clamped, test.ShouldBeFalse)
+	test.That(t, l, test.ShouldResemble, r3.Vector{X: 300, Y: 400})
+
+	l, clamped = cfg.clampLinearVelocity(r3.Vector{X: 600, Y: 800})
+	test.That(t, clamped, test.ShouldBeTrue)
+	test.That(t, l.X, test.ShouldAlmostEqual, 300)
+	test.That(t, l.Y, test.ShouldAlmostEqual, 400)
+
+	a, clamped = cfg.clampAngularVelocity(-90)
+	test.That(t, clamped, test.ShouldBeTrue)
+	test.That(t, a, test.ShouldEqual, -30)
+
+	cfg.MaxAngularVelocityDegPerSec = -1
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestConfigValidateControllable(t *testing.T) {
+	cfg := Config{Motors: testMotorConfig, LengthMM: 500, WidthMM: 500}
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	cfg.Motors = []MotorConfig{
+		{Name: "port", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1},
+		{Name: "starboard", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1},
+	}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	// a single motor on the center line can't turn
+	cfg.Motors = []MotorConfig{{Name: "stern", XOffsetMM: 0, YOffsetMM: -1500, Weight: 1}}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "turn")
+
+	// two motors on the center line can't either
+	cfg.Motors = []MotorConfig{
+		{Name: "stern", XOffsetMM: 0, YOffsetMM: -1500, Weight: 1},
+		{Name: "bow", XOffsetMM: 0, YOffsetMM: 1500, Weight: 1},
+	}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// a single motor off the center line turns whenever it pushes, so it can't do either alone
+	cfg.Motors = []MotorConfig{{Name: "port", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1}}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "independently")
+
+	// only lateral thrusters, can't go forward
+	cfg.Motors = []MotorConfig{
+		{Name: "bow", XOffsetMM: 0, YOffsetMM: 1500, AngleDegrees: 90, Weight: 1},
+		{Name: "stern", XOffsetMM: 0, YOffsetMM: -1500, AngleDegrees: 90, Weight: 1},
+	}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "forward")
+}
+
+func TestComputePowerWeights(t *testing.T) {
+	cfg := Config{
+		Motors: []MotorConfig{
+			{Name: "port", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1},
+			{Name: "starboard", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1},
+		},
+		LengthMM: 3048,
+		WidthMM:  1100,
+	}
+
+	// full speed ahead and a hard turn can't both be had with two motors
+	goal := cfg.computeGoal(r3.Vector{Y: 1}, r3.Vector{Z: 1})
+	misses := func() (float64, float64) {
+		powers, err := cfg.computePowerOptimizer(goal)
+		test.That(t, err, test.ShouldBeNil)
+		out := powerOutput(t, &cfg, powers)
+		return math.Abs(out.linearY - goal.linearY), math.Abs(out.angular - goal.angular)
+	}
+
+	linearEven, angularEven := misses()
+
+	ten := 10.0
+	cfg.AngularWeight = &ten
+	linearHeading, angularHeading := misses()
+
+	test.That(t, angularHeading, test.ShouldBeLessThan, angularEven)
+	test.That(t, linearHeading, test.ShouldBeGreaterThan, linearEven)
+
+	neg := -1.0
+	cfg.AngularWeight = &neg
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestObjectiveScale(t *testing.T) {
+	cfg := Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	test.That(t, cfg.objectiveScale(), test.ShouldResemble, motorWeights{1, 1, 1})
+
+	two, half := 2.0, .5
+	cfg.LinearWeight = &two
+	cfg.LateralWeight = &half
+	test.That(t, cfg.objectiveScale(), test.ShouldResemble, motorWeights{.5, 2, 1})
+
+	// normalized, each is per what the motors can do on that axis. nothing pushes sideways, so
+	// that's left as is.
+	cfg.NormalizeObjective = true
+	max := cfg.maxWeights()
+	test.That(t, max.linearX, test.ShouldEqual, 0)
+	scale := cfg.objectiveScale()
+	test.That(t, scale.linearX, test.ShouldEqual, .5)
+	test.That(t, scale.linearY, test.ShouldAlmostEqual, 2/max.linearY)
+	test.That(t, scale.angular, test.ShouldAlmostEqual, 1/max.angular)
+
+	// in raw thrust a miss on turning is tiny next to one going forward, so the optimizer gives
+	// up the turn. normalized, half of each is as bad as the other and it splits the difference.
+	cfg.LinearWeight, cfg.LateralWeight = nil, nil
+	goal := cfg.computeGoal(r3.Vector{Y: 1}, r3.Vector{Z: 1})
+	misses := func() (float64, float64) {
+		powers, err := cfg.computePowerOptimizer(goal)
+		test.That(t, err, test.ShouldBeNil)
+		out := powerOutput(t, &cfg, powers)
+		return math.Abs(out.linearY-goal.linearY) / max.linearY, math.Abs(out.angular-goal.angular) / max.angular
+	}
+
+	cfg.NormalizeObjective = false
+	linearRaw, angularRaw := misses()
+	cfg.NormalizeObjective = true
+	linearNormalized, angularNormalized := misses()
+
+	test.That(t, angularNormalized, test.ShouldBeLessThan, angularRaw)
+	test.That(t, linearNormalized, test.ShouldBeGreaterThan, linearRaw)
+	test.That(t, linearNormalized, test.ShouldAlmostEqual, angularNormalized, .05)
+
+	neg := -1.0
+	cfg.LateralWeight = &neg
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestComputePowerOutputWrongLength(t *testing.T) {
+	cfg := Config{Motors: testMotorConfig, LengthMM: 500, WidthMM: 500}
+
+	_, err := cfg.ComputePowerOutput([]float64{1, 2})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "wrong length")
+
+	_, err = cfg.ComputePowerOutputAsMatrix(nil)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestHeadingRampConfig(t *testing.T) {
+	cfg := Config{Motors: testMotorConfig, LengthMM: 500, WidthMM: 500}
+	test.That(t, cfg.headingDeadband(), test.ShouldEqual, 1)
+	test.That(t, cfg.headingRamp(), test.ShouldEqual, 5)
+
+	deadband, ramp := 2.0, 10.0
+	cfg.HeadingDeadbandDeg = &deadband
+	cfg.HeadingRampDeg = &ramp
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	// the deadband has to be inside the ramp
+	deadband = 10
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	deadband = 6
+	cfg.HeadingRampDeg = nil
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	deadband = -1
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestComputePowerByName(t *testing.T) {
+	cfg := Config{Motors: testMotorConfig, LengthMM: 500, WidthMM: 500}
+	powers, err := cfg.ComputePower(r3.Vector{X: .3, Y: .5}, r3.Vector{Z: .2})
+	test.That(t, err, test.ShouldBeNil)
+	byName, err := cfg.ComputePowerByName(r3.Vector{X: .3, Y: .5}, r3.Vector{Z: .2})
+	test.That(t, err, test.ShouldBeNil)
+
+	test.That(t, len(byName), test.ShouldEqual, len(testMotorConfig))
+	for idx, mc := range testMotorConfig {
+		test.That(t, byName[mc.Name], test.ShouldAlmostEqual, powers[idx], testTheta)
+	}
+}
+
+func TestComputePowerWithResidual(t *testing.T) {
+	cfg := Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+
+	powers, residual, err := cfg.ComputePowerWithResidual(r3.Vector{Y: .5}, r3.Vector{Z: .25})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(powers), test.ShouldEqual, 2)
+	test.That(t, residual, test.ShouldAlmostEqual, 0, testTheta)
+
+	// full forward and full turn at once can't be done, both motors would need more than 1
+	_, residual, err = cfg.ComputePowerWithResidual(r3.Vector{Y: 1}, r3.Vector{Z: 1})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, residual, test.ShouldBeGreaterThan, .1)
+}
+
+func TestDuplicateMotorNames(t *testing.T) {
+	cfg := Config{Motors: []MotorConfig{testTwoMotorConfig[0], testTwoMotorConfig[0]}, LengthMM: 3048, WidthMM: 1100}
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestMaxTotalPower(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	unlimited, err := cfg.computePower(r3.Vector{Y: .8}, r3.Vector{Z: .1}, PseudoInverseSolver{})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, math.Abs(unlimited[0])+math.Abs(unlimited[1]), test.ShouldAlmostEqual, 1.6, 1e-9)
+
+	// over the budget, everything's scaled down by the same amount
+	cfg.MaxTotalPower = 1.2
+	limited, err := cfg.computePower(r3.Vector{Y: .8}, r3.Vector{Z: .1}, PseudoInverseSolver{})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, math.Abs(limited[0])+math.Abs(limited[1]), test.ShouldAlmostEqual, 1.2, 1e-9)
+	for idx := range limited {
+		test.That(t, limited[idx], test.ShouldAlmostEqual, unlimited[idx]*.75, 1e-9)
+	}
+
+	// and under it nothing changes
+	under, err := cfg.computePower(r3.Vector{Y: .5}, r3.Vector{}, PseudoInverseSolver{})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, under[0], test.ShouldAlmostEqual, .5, 1e-9)
+	test.That(t, under[1], test.ShouldAlmostEqual, .5, 1e-9)
+
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	cfg.MaxTotalPower = -1
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
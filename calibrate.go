@@ -0,0 +1,163 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.uber.org/multierr"
+	"go.viam.com/utils"
+
+	rdkutils "go.viam.com/rdk/utils"
+)
+
+// how hard and how long calibrate_motor runs a motor unless told otherwise
+const (
+	defaultCalibratePower       = .3
+	defaultCalibrateDurationSec = 3
+)
+
+// calibrateMotor runs one motor on its own for a while and looks at how the boat moved to
+// suggest its MotorConfig. arg is {"name": ..., "power": .3, "duration_sec": 3}, and the boat
+// should be in open water with room to move.
+func (b *boat) calibrateMotor(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	args, ok := arg.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("calibrate_motor needs the name of the motor to calibrate")
+	}
+
+	name, _ := args["name"].(string)
+	mc, m := b.cfg.motorConfig(name), b.motors[name]
+	if mc == nil || m == nil {
+		return nil, fmt.Errorf("no motor named %q", name)
+	}
+
+	if b.linearVelocitySource() == nil || b.angularVelocitySource() == nil {
+		return nil, fmt.Errorf("%w: calibrating a motor needs one", ErrNoMovementSensor)
+	}
+	if b.cfg.DryRun {
+		return nil, errors.New("can't calibrate a motor in a dry run")
+	}
+
+	power := defaultCalibratePower
+	if _, ok := args["power"]; ok {
+		p, ok := floatFromExtra(args, "power")
+		if !ok || p <= 0 || p > 1 {
+			return nil, fmt.Errorf("calibrate_motor power has to be in (0, 1], not %v", args["power"])
+		}
+		power = p
+	}
+
+	durationSec := float64(defaultCalibrateDurationSec)
+	if _, ok := args["duration_sec"]; ok {
+		d, ok := floatFromExtra(args, "duration_sec")
+		if !ok || d <= 0 {
+			return nil, fmt.Errorf("calibrate_motor duration_sec has to be positive, not %v", args["duration_sec"])
+		}
+		durationSec = d
+	}
+
+	if err := b.checkEStop(); err != nil {
+		return nil, err
+	}
+
+	// everything else stops first, so only this motor is pushing
+	if err := b.Stop(ctx, nil); err != nil {
+		return nil, err
+	}
+	ctx, done := b.opMgr.New(ctx)
+	defer done()
+
+	baseLinear, baseAngular, err := b.readVelocities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b.logger.Infof("calibrating motor %q at power %v for %v seconds", name, power, durationSec)
+	err = m.SetPower(ctx, mc.motorPower(power), nil)
+	if err == nil && !utils.SelectContextOrWait(ctx, time.Duration(durationSec*float64(time.Second))) {
+		err = ctx.Err()
+	}
+
+	var linear r3.Vector
+	var angular float64
+	if err == nil {
+		linear, angular, err = b.readVelocities(ctx)
+	}
+	err = multierr.Combine(err, m.Stop(ctx, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	linear = linear.Sub(baseLinear)
+	angular -= baseAngular
+
+	suggested, err := b.cfg.estimateMotorConfig(*mc, power, linear, angular)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"name":                   name,
+		"power":                  power,
+		"linear_x_mm_per_sec":    linear.X,
+		"linear_y_mm_per_sec":    linear.Y,
+		"angular_z_degs_per_sec": angular,
+		"motor": map[string]interface{}{
+			"name":        suggested.Name,
+			"x_offset_mm": suggested.XOffsetMM,
+			"y_offset_mm": suggested.YOffsetMM,
+			"angle_degs":  suggested.AngleDegrees,
+			"weight":      suggested.Weight,
+		},
+	}, nil
+}
+
+// estimateMotorConfig is mc with its angle, weight, and offset changed to match how the boat
+// moved with only that motor at power. speeds are turned into weights the same way open loop
+// control does, as a fraction of the open loop speeds and the rest of the configured motors.
+// the offset along the boat is kept as configured, since where a motor is along its line of
+// thrust can't be seen, and the other offset is solved for to make the turning match.
+func (cfg *Config) estimateMotorConfig(mc MotorConfig, power float64, linear r3.Vector, angularZ float64) (MotorConfig, error) {
+	fullLinear, fullAngular := cfg.openLoopSpeeds()
+	max := cfg.maxWeights()
+
+	// with no lateral thrust configured there's nothing to compare to, so treat it like forward
+	maxX := max.linearX
+	if maxX == 0 {
+		maxX = max.linearY
+	}
+
+	wx := linear.X / fullLinear * maxX / power
+	wy := linear.Y / fullLinear * max.linearY / power
+	wa := angularZ / fullAngular * max.angular / power
+
+	weight := math.Hypot(wx, wy)
+	if weight == 0 || !validFloat(weight) {
+		return mc, fmt.Errorf("motor %q didn't move the boat", mc.Name)
+	}
+
+	mc.Weight = weight
+	mc.AngleDegrees = rdkutils.RadToDeg(math.Atan2(wx, wy))
+
+	// computeWeights works out to angular = -weight/radius * (|y| sin(angle) - sign(y) x cos(angle))
+	radius := math.Hypot(cfg.WidthMM, cfg.LengthMM)
+	sin, cos := math.Sin(rdkutils.DegToRad(mc.AngleDegrees)), math.Cos(rdkutils.DegToRad(mc.AngleDegrees))
+	ySign := 1.0
+	if mc.YOffsetMM < 0 {
+		ySign = -1
+	}
+	turn := wa * radius / weight
+
+	if math.Abs(cos) >= math.Abs(sin) {
+		mc.XOffsetMM = (turn + math.Abs(mc.YOffsetMM)*sin) / (ySign * cos)
+	} else if y := (ySign*mc.XOffsetMM*cos - turn) / sin; y >= 0 {
+		// a sideways thruster turns the boat by how far forward or back it is instead
+		mc.YOffsetMM = ySign * y
+	}
+
+	return mc, nil
+}
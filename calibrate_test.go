@@ -0,0 +1,120 @@
+package viamboatbase
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/spatialmath"
+)
+
+// calibrationResponse is how the boat would move with only mc at power, measured against cfg,
+// the inverse of what estimateMotorConfig does
+func calibrationResponse(cfg *Config, mc MotorConfig, power float64) (r3.Vector, float64) {
+	fullLinear, fullAngular := cfg.openLoopSpeeds()
+	max := cfg.maxWeights()
+	w := mc.computeWeights(math.Hypot(cfg.WidthMM, cfg.LengthMM))
+	return r3.Vector{
+		X: w.linearX * power / max.linearX * fullLinear,
+		Y: w.linearY * power / max.linearY * fullLinear,
+	}, w.angular * power / max.angular * fullAngular
+}
+
+func calibrationConfig() *Config {
+	return &Config{
+		Motors: []MotorConfig{
+			{Name: "port", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1},
+			{Name: "starboard", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1},
+			{Name: "bow", XOffsetMM: 0, YOffsetMM: 1200, AngleDegrees: 90, Weight: 1},
+		},
+		LengthMM:                 3048,
+		WidthMM:                  1100,
+		OpenLoopLinearMMPerSec:   2000,
+		OpenLoopAngularDegPerSec: 45,
+	}
+}
+
+func TestCalibrateMotor(t *testing.T) {
+	cfg := calibrationConfig()
+	fm := newFakeMotors(3)
+	b := newTestBoat(t, cfg, fm)
+
+	// the starboard motor is really further out, a bit weaker, and toed in
+	actual := MotorConfig{Name: "starboard", XOffsetMM: 350, YOffsetMM: -1500, AngleDegrees: -10, Weight: .8}
+	linear, angular := calibrationResponse(cfg, actual, .4)
+
+	// drifting in a current before the motor is even on
+	drift := r3.Vector{X: 30, Y: -20}
+	fs := &fakeSensor{linearVelocity: drift, angularVelocity: spatialmath.AngularVelocity{Z: 1}}
+	b.movementSensor = fs.movementSensor()
+
+	setPower := fm.motors[1].SetPowerFunc
+	fm.motors[1].SetPowerFunc = func(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
+		fs.set(0, drift.Add(linear), spatialmath.AngularVelocity{Z: 1 + angular})
+		return setPower(ctx, powerPct, extra)
+	}
+
+	res, err := b.DoCommand(context.Background(), map[string]interface{}{
+		"calibrate_motor": map[string]interface{}{"name": "starboard", "power": .4, "duration_sec": .01},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["linear_y_mm_per_sec"], test.ShouldAlmostEqual, linear.Y, 1e-6)
+	test.That(t, res["angular_z_degs_per_sec"], test.ShouldAlmostEqual, angular, 1e-6)
+
+	suggested := res["motor"].(map[string]interface{})
+	test.That(t, suggested["name"], test.ShouldEqual, "starboard")
+	test.That(t, suggested["weight"], test.ShouldAlmostEqual, actual.Weight, 1e-6)
+	test.That(t, suggested["angle_degs"], test.ShouldAlmostEqual, actual.AngleDegrees, 1e-6)
+	test.That(t, suggested["x_offset_mm"], test.ShouldAlmostEqual, actual.XOffsetMM, 1e-6)
+	test.That(t, suggested["y_offset_mm"], test.ShouldAlmostEqual, actual.YOffsetMM, 1e-6)
+
+	// only that motor ran, and it's stopped again
+	test.That(t, fm.history[0], test.ShouldBeEmpty)
+	test.That(t, fm.history[1], test.ShouldResemble, []float64{.4})
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0, 0})
+}
+
+func TestEstimateSidewaysMotor(t *testing.T) {
+	cfg := calibrationConfig()
+
+	// the bow thruster is further forward than configured, which only shows up as more turning
+	actual := MotorConfig{Name: "bow", XOffsetMM: 0, YOffsetMM: 1400, AngleDegrees: 90, Weight: 1}
+	linear, angular := calibrationResponse(cfg, actual, .5)
+
+	suggested, err := cfg.estimateMotorConfig(cfg.Motors[2], .5, linear, angular)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, suggested.AngleDegrees, test.ShouldAlmostEqual, 90, 1e-6)
+	test.That(t, suggested.Weight, test.ShouldAlmostEqual, 1, 1e-6)
+	test.That(t, suggested.XOffsetMM, test.ShouldEqual, 0)
+	test.That(t, suggested.YOffsetMM, test.ShouldAlmostEqual, 1400, 1e-6)
+
+	_, err = cfg.estimateMotorConfig(cfg.Motors[2], .5, r3.Vector{}, 0)
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestCalibrateMotorErrors(t *testing.T) {
+	cfg := calibrationConfig()
+	b := newTestBoat(t, cfg, newFakeMotors(3))
+
+	calibrate := func(arg interface{}) error {
+		_, err := b.DoCommand(context.Background(), map[string]interface{}{"calibrate_motor": arg})
+		return err
+	}
+
+	// no movement sensor
+	test.That(t, calibrate(map[string]interface{}{"name": "port"}), test.ShouldNotBeNil)
+
+	b.movementSensor = (&fakeSensor{}).movementSensor()
+	test.That(t, calibrate("port"), test.ShouldNotBeNil)
+	test.That(t, calibrate(map[string]interface{}{"name": "stern"}), test.ShouldNotBeNil)
+	test.That(t, calibrate(map[string]interface{}{"name": "port", "power": 2.0}), test.ShouldNotBeNil)
+	test.That(t, calibrate(map[string]interface{}{"name": "port", "duration_sec": -1.0}), test.ShouldNotBeNil)
+
+	// the boat doesn't move at all
+	err := calibrate(map[string]interface{}{"name": "port", "duration_sec": .01})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "didn't move")
+}
@@ -0,0 +1,219 @@
+package viamboatbase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/geo/r3"
+)
+
+func (b *boat) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	if _, ok := cmd["get_state"]; ok {
+		return b.getState(), nil
+	}
+
+	if _, ok := cmd["status"]; ok {
+		return b.status(ctx), nil
+	}
+
+	if _, ok := cmd["capabilities"]; ok {
+		return b.capabilities(), nil
+	}
+
+	if _, ok := cmd["get_mixing"]; ok {
+		return b.mixing(), nil
+	}
+
+	if _, ok := cmd["dimensions"]; ok {
+		return b.dimensions(), nil
+	}
+
+	if _, ok := cmd["current_heading"]; ok {
+		h, err := b.CurrentHeading(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"heading": h}, nil
+	}
+
+	if _, ok := cmd["current_position"]; ok {
+		p, err := b.CurrentPosition(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"latitude": p.Lat(), "longitude": p.Lng()}, nil
+	}
+
+	if arg, ok := cmd["save_pid"]; ok {
+		path, err := b.gainsPath(arg)
+		if err != nil {
+			return nil, err
+		}
+		return nil, b.saveGains(path)
+	}
+
+	if arg, ok := cmd["load_pid"]; ok {
+		path, err := b.gainsPath(arg)
+		if err != nil {
+			return nil, err
+		}
+		return nil, b.loadGains(path)
+	}
+
+	if estop, ok := cmd["estop"]; ok {
+		if estop == true {
+			return nil, b.emergencyStop(ctx)
+		}
+		b.clearEmergencyStop()
+		return nil, nil
+	}
+
+	if arg, ok := cmd["calibrate_motor"]; ok {
+		return b.calibrateMotor(ctx, arg)
+	}
+
+	if arg, ok := cmd["self_test"]; ok {
+		return b.selfTest(ctx, arg)
+	}
+
+	if arg, ok := cmd["set_heading"]; ok {
+		return nil, b.setHeading(ctx, arg)
+	}
+
+	if hold, ok := cmd["hold_position"]; ok {
+		if hold == true {
+			return nil, b.holdPosition(ctx)
+		}
+		return nil, b.Stop(ctx, nil)
+	}
+
+	return nil, fmt.Errorf("unknown command: %v", cmd)
+}
+
+func (b *boat) getState() map[string]interface{} {
+	s := b.snapshotState()
+
+	return map[string]interface{}{
+		"control_state":         s.controlState.String(),
+		"estopped":              s.estopped,
+		"velocity_linear_goal":  vectorToMap(s.velocityLinearGoal),
+		"velocity_angular_goal": vectorToMap(s.velocityAngularGoal),
+		"compass_goal":          s.compassGoal,
+		"power":                 s.lastPower,
+		"linear_velocity":       vectorToMap(s.lastLinearVelocity),
+		"angular_velocity": vectorToMap(r3.Vector{
+			X: s.lastAngularVelocity.X,
+			Y: s.lastAngularVelocity.Y,
+			Z: s.lastAngularVelocity.Z,
+		}),
+		"compass_heading": s.lastHeading,
+		"voltage":         s.lastVoltage,
+		"residual":        s.lastResidual,
+		"linear_bias":     s.linearBias,
+		"angular_bias":    s.angularBias,
+	}
+}
+
+// status is like getState but flat, so dashboards can show it without digging into nested maps.
+// everything is 0 until the control loop has run. what the motors report is in there too, see
+// motorTelemetry.
+func (b *boat) status(ctx context.Context) map[string]interface{} {
+	s := b.snapshotState()
+	linearSaturated, angularSaturated := s.saturated()
+
+	res := map[string]interface{}{
+		"control_state":         s.controlState.String(),
+		"thread_running":        s.threadStarted,
+		"estopped":              s.estopped,
+		"dry_run":               b.cfg.DryRun,
+		"faulted_motors":        s.faultedMotorNames(),
+		"compass_heading":       s.lastHeading,
+		"compass_goal":          s.compassGoal,
+		"linear_velocity_x":     s.lastLinearVelocity.X,
+		"linear_velocity_y":     s.lastLinearVelocity.Y,
+		"angular_velocity_z":    s.lastAngularVelocity.Z,
+		"linear_velocity_goal":  s.velocityLinearGoal.Y,
+		"angular_velocity_goal": s.velocityAngularGoal.Z,
+		"voltage":               s.lastVoltage,
+		"residual":              s.lastResidual,
+		"spin_heading_error":    s.spinHeadingError,
+		"spin_eta_sec":          s.spinETASec,
+		"linear_saturated":      linearSaturated,
+		"angular_saturated":     angularSaturated,
+		"saturated":             linearSaturated || angularSaturated,
+	}
+
+	for idx, mc := range b.cfg.Motors {
+		p := 0.0
+		if idx < len(s.lastPower) {
+			p = s.lastPower[idx]
+		}
+		res["power_"+mc.Name] = p
+	}
+	for k, v := range b.motorTelemetry(ctx) {
+		res[k] = v
+	}
+
+	return res
+}
+
+// capabilities is the range of SetPower each axis can actually reach with these motors
+func (b *boat) capabilities() map[string]interface{} {
+	min, max := b.cfg.outputRange()
+	axis := func(min, max float64) map[string]interface{} {
+		return map[string]interface{}{"min": min, "max": max}
+	}
+	return map[string]interface{}{
+		"linear_x": axis(min.linearX, max.linearX),
+		"linear_y": axis(min.linearY, max.linearY),
+		"angular":  axis(min.angular, max.angular),
+	}
+}
+
+// dimensions is the size of the hull from the config, in mm and meters
+func (b *boat) dimensions() map[string]interface{} {
+	return map[string]interface{}{
+		"width_mm":      b.cfg.WidthMM,
+		"length_mm":     b.cfg.LengthMM,
+		"width_meters":  b.cfg.WidthMM / 1000,
+		"length_meters": b.cfg.LengthMM / 1000,
+	}
+}
+
+// mixing is how each motor moves the boat at full power, for checking the motor config. "matrix"
+// is weightsAsMatrix as rows of linear x, linear y, and angular, with a column per motor in
+// config order, and "max_weights" is what they add up to.
+func (b *boat) mixing() map[string]interface{} {
+	names := []string{}
+	motors := map[string]interface{}{}
+	for idx, w := range b.cfg.weights() {
+		name := b.cfg.Motors[idx].Name
+		names = append(names, name)
+		motors[name] = weightsToMap(w)
+	}
+
+	m := b.cfg.weightsAsMatrix()
+	rows, cols := m.Dims()
+	matrix := make([][]float64, rows)
+	for r := range matrix {
+		matrix[r] = make([]float64, cols)
+		for c := range matrix[r] {
+			matrix[r][c] = m.At(r, c)
+		}
+	}
+
+	return map[string]interface{}{
+		"motors":      motors,
+		"columns":     names,
+		"matrix":      matrix,
+		"max_weights": weightsToMap(b.cfg.maxWeights()),
+	}
+}
+
+func weightsToMap(w motorWeights) map[string]interface{} {
+	return map[string]interface{}{"linear_x": w.linearX, "linear_y": w.linearY, "angular": w.angular}
+}
+
+func vectorToMap(v r3.Vector) map[string]interface{} {
+	return map[string]interface{}{"x": v.X, "y": v.Y, "z": v.Z}
+}
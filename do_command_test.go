@@ -0,0 +1,157 @@
+package viamboatbase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/test"
+)
+
+func TestDoCommandGetState(t *testing.T) {
+	b := &boat{}
+	b.state.controlState = controlVelocity
+	b.state.velocityLinearGoal = r3.Vector{Y: 100}
+	b.state.compassGoal = 90
+	b.state.lastPower = []float64{.5, -.5}
+	b.state.lastHeading = 45
+
+	res, err := b.DoCommand(context.Background(), map[string]interface{}{"get_state": map[string]interface{}{}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["control_state"], test.ShouldEqual, "velocity")
+	test.That(t, res["velocity_linear_goal"], test.ShouldResemble, map[string]interface{}{"x": 0.0, "y": 100.0, "z": 0.0})
+	test.That(t, res["compass_goal"], test.ShouldEqual, 90)
+	test.That(t, res["power"], test.ShouldResemble, []float64{.5, -.5})
+	test.That(t, res["compass_heading"], test.ShouldEqual, 45)
+
+	_, err = b.DoCommand(context.Background(), map[string]interface{}{"foo": true})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestDoCommandCapabilities(t *testing.T) {
+	half := .5
+	motors := append([]MotorConfig{}, testMotorConfig...)
+	// the forward thruster only makes half the thrust in reverse
+	motors[2].ReverseThrustScale = &half
+	b := &boat{cfg: &Config{Motors: motors, LengthMM: 500, WidthMM: 500}}
+
+	res, err := b.DoCommand(context.Background(), map[string]interface{}{"capabilities": map[string]interface{}{}})
+	test.That(t, err, test.ShouldBeNil)
+
+	x := res["linear_x"].(map[string]interface{})
+	test.That(t, x["min"], test.ShouldAlmostEqual, -1)
+	test.That(t, x["max"], test.ShouldAlmostEqual, 1)
+
+	y := res["linear_y"].(map[string]interface{})
+	test.That(t, y["max"], test.ShouldAlmostEqual, 1)
+	test.That(t, y["min"], test.ShouldAlmostEqual, -.875)
+
+	a := res["angular"].(map[string]interface{})
+	test.That(t, a["min"].(float64), test.ShouldBeLessThan, 0)
+	test.That(t, a["max"].(float64), test.ShouldBeGreaterThan, 0)
+}
+
+func TestDoCommandDimensions(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	b := &boat{cfg: cfg}
+
+	res, err := b.DoCommand(context.Background(), map[string]interface{}{"dimensions": map[string]interface{}{}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldResemble, map[string]interface{}{
+		"width_mm":      1100.0,
+		"length_mm":     3048.0,
+		"width_meters":  1.1,
+		"length_meters": 3.048,
+	})
+
+	length, err := b.Length(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, length, test.ShouldEqual, 3048)
+	width, err := b.Width(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, width, test.ShouldEqual, 1100)
+}
+
+func TestDoCommandGetMixing(t *testing.T) {
+	cfg := &Config{Motors: testMotorConfig, LengthMM: 500, WidthMM: 500}
+	b := &boat{cfg: cfg}
+
+	res, err := b.DoCommand(context.Background(), map[string]interface{}{"get_mixing": map[string]interface{}{}})
+	test.That(t, err, test.ShouldBeNil)
+
+	m := cfg.weightsAsMatrix()
+	matrix := res["matrix"].([][]float64)
+	test.That(t, len(matrix), test.ShouldEqual, 3)
+	for r, row := range matrix {
+		test.That(t, len(row), test.ShouldEqual, len(cfg.Motors))
+		for c, v := range row {
+			test.That(t, v, test.ShouldEqual, m.At(r, c))
+		}
+	}
+
+	columns := res["columns"].([]string)
+	motors := res["motors"].(map[string]interface{})
+	for idx, w := range cfg.weights() {
+		test.That(t, columns[idx], test.ShouldEqual, cfg.Motors[idx].Name)
+		test.That(t, motors[cfg.Motors[idx].Name], test.ShouldResemble, map[string]interface{}{
+			"linear_x": w.linearX, "linear_y": w.linearY, "angular": w.angular,
+		})
+	}
+
+	max := cfg.maxWeights()
+	test.That(t, res["max_weights"], test.ShouldResemble, map[string]interface{}{
+		"linear_x": max.linearX, "linear_y": max.linearY, "angular": max.angular,
+	})
+}
+
+func TestDoCommandStatus(t *testing.T) {
+	b := &boat{cfg: &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}}
+
+	// nothing has run yet
+	res, err := b.DoCommand(context.Background(), map[string]interface{}{"status": map[string]interface{}{}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["control_state"], test.ShouldEqual, "none")
+	test.That(t, res["thread_running"], test.ShouldEqual, false)
+	test.That(t, res["compass_heading"], test.ShouldEqual, 0.0)
+	test.That(t, res["power_port"], test.ShouldEqual, 0.0)
+	test.That(t, res["power_starboard"], test.ShouldEqual, 0.0)
+
+	b.state.controlState = controlHeading
+	b.state.lastHeading = 271
+	b.state.lastLinearVelocity = r3.Vector{Y: 350}
+	b.state.velocityAngularGoal = r3.Vector{Z: -10}
+	b.state.lastPower = []float64{.25, -.25}
+
+	res, err = b.DoCommand(context.Background(), map[string]interface{}{"status": map[string]interface{}{}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["control_state"], test.ShouldEqual, "heading")
+	test.That(t, res["compass_heading"], test.ShouldEqual, 271.0)
+	test.That(t, res["linear_velocity_y"], test.ShouldEqual, 350.0)
+	test.That(t, res["angular_velocity_goal"], test.ShouldEqual, -10.0)
+	test.That(t, res["power_port"], test.ShouldEqual, .25)
+	test.That(t, res["power_starboard"], test.ShouldEqual, -.25)
+
+	// everything is a flat number, string, or bool
+	for k, v := range res {
+		switch v.(type) {
+		case float64, string, bool:
+		default:
+			t.Errorf("%s is a %T", k, v)
+		}
+	}
+}
+
+func TestDoCommandCurrentHeadingAndPosition(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	b.movementSensor = (&fakeSensor{heading: 45, position: geo.NewPoint(40.7, -73.9)}).movementSensor()
+
+	res, err := b.DoCommand(context.Background(), map[string]interface{}{"current_heading": true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldResemble, map[string]interface{}{"heading": 45.0})
+
+	res, err = b.DoCommand(context.Background(), map[string]interface{}{"current_position": true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldResemble, map[string]interface{}{"latitude": 40.7, "longitude": -73.9})
+}
@@ -0,0 +1,37 @@
+package viamboatbase
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errors callers can check for with errors.Is. ErrEStopped, ErrLowBattery, and ErrOutsideGeofence
+// are next to what raises them.
+var (
+	// a command needs a movement sensor, or a reading it doesn't have
+	ErrNoMovementSensor     = errors.New("no movement sensor")
+	ErrPositionNotSupported = errors.New("movement sensor doesn't support position")
+
+	// a motor didn't take the power it was given
+	ErrMotorFault = errors.New("motor fault")
+
+	// there's no motor power that does what was asked
+	ErrInfeasibleCommand = errors.New("can't solve for motor powers")
+
+	// Spin didn't get to the goal in spin_timeout_sec, or a blocking SetVelocity to its velocity
+	// in its timeout_sec
+	ErrSpinTimeout     = errors.New("spin timed out")
+	ErrVelocityTimeout = errors.New("waiting for velocity timed out")
+
+	// MoveStraight didn't get there in time, or stopped getting closer
+	ErrMoveStraightTimeout = errors.New("move straight timed out")
+	ErrNoProgress          = errors.New("not making progress")
+)
+
+// errMotorFaulted means a motor failed and was taken out, so the power has to be solved again
+// without it
+var errMotorFaulted = fmt.Errorf("%w, taking it out", ErrMotorFault)
+
+// errPowerCount means the solver didn't give one power per motor, which is a bug somewhere, so
+// nothing it says can be trusted
+var errPowerCount = fmt.Errorf("%w: wrong number of powers", ErrInfeasibleCommand)
@@ -0,0 +1,72 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+)
+
+func TestErrorsNoMovementSensor(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+
+	_, err := b.CurrentHeading(context.Background())
+	test.That(t, errors.Is(err, ErrNoMovementSensor), test.ShouldBeTrue)
+
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 100}, r3.Vector{}, map[string]interface{}{"hold_heading": 10.0})
+	test.That(t, errors.Is(err, ErrNoMovementSensor), test.ShouldBeTrue)
+
+	_, err = b.DoCommand(context.Background(), map[string]interface{}{"calibrate_motor": map[string]interface{}{"name": "port"}})
+	test.That(t, errors.Is(err, ErrNoMovementSensor), test.ShouldBeTrue)
+
+	_, err = b.CurrentPosition(context.Background())
+	test.That(t, errors.Is(err, ErrPositionNotSupported), test.ShouldBeTrue)
+
+	_, err = b.DoCommand(context.Background(), map[string]interface{}{"hold_position": true})
+	test.That(t, errors.Is(err, ErrPositionNotSupported), test.ShouldBeTrue)
+}
+
+func TestErrorsMotorFault(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	fm.motors[0].SetPowerFunc = func(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
+		return errors.New("overheated")
+	}
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, errors.Is(err, ErrMotorFault), test.ShouldBeTrue)
+	test.That(t, errors.Is(err, errMotorFaulted), test.ShouldBeFalse)
+
+	// with fault tolerance, losing every motor is a fault and leaves nothing to solve with
+	cfg.FaultTolerant = true
+	fm.motors[1].SetPowerFunc = fm.motors[0].SetPowerFunc
+	err = b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, errors.Is(err, ErrMotorFault), test.ShouldBeTrue)
+}
+
+func TestErrorsInfeasibleCommand(t *testing.T) {
+	_, err := (&Config{}).computePower(r3.Vector{Y: 1}, r3.Vector{}, PseudoInverseSolver{})
+	test.That(t, errors.Is(err, ErrInfeasibleCommand), test.ShouldBeTrue)
+
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, FaultTolerant: true}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	b.state.faultedMotors = map[string]bool{"port": true, "starboard": true}
+	err = b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, errors.Is(err, ErrInfeasibleCommand), test.ShouldBeTrue)
+}
+
+func TestErrorsSpinTimeout(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, SpinTimeoutSec: .05, SpinPollMs: 10}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	b.movementSensor = (&fakeSensor{heading: 10}).movementSensor()
+	defer b.Close(context.Background())
+
+	err := b.Spin(context.Background(), 90, 10, nil)
+	test.That(t, errors.Is(err, ErrSpinTimeout), test.ShouldBeTrue)
+	test.That(t, err.Error(), test.ShouldStartWith, "spin timed out")
+}
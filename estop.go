@@ -0,0 +1,66 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+
+	"github.com/golang/geo/r3"
+	"go.uber.org/multierr"
+)
+
+// ErrEStopped is returned for motion commands while the boat is emergency stopped
+var ErrEStopped = errors.New(`boat is emergency stopped, send {"estop": false} to re-enable`)
+
+// checkEStop returns ErrEStopped if an emergency stop is latched
+func (b *boat) checkEStop() error {
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+	if b.state.estopped {
+		return ErrEStopped
+	}
+	return nil
+}
+
+// emergencyStop kills the control loop and any stop ramp and zeros every motor right away, no
+// ramping and no optimizer. the boat then refuses to move until clearEmergencyStop is called.
+func (b *boat) emergencyStop(ctx context.Context) error {
+	b.logger.Warn("emergency stop")
+
+	b.stateMutex.Lock()
+	b.state.estopped = true
+	b.setControlStateInLock(controlNone)
+	b.state.velocityLinearGoal = r3.Vector{}
+	b.state.velocityAngularGoal = r3.Vector{}
+	b.state.rampedLinearGoal = r3.Vector{}
+	b.state.rampedAngularGoal = r3.Vector{}
+	b.state.rampedLinearAccel = r3.Vector{}
+	b.state.lastPower = make([]float64, len(b.cfg.Motors))
+	if b.stopRampCancel != nil {
+		b.stopRampCancel()
+		b.stopRampCancel = nil
+	}
+	b.stateMutex.Unlock()
+
+	b.stopVelocityThread()
+	b.opMgr.CancelRunning(ctx)
+
+	// after any power that's being sent, and sendPower and rampDown won't send more once estopped
+	b.powerMutex.Lock()
+	defer b.powerMutex.Unlock()
+
+	var err error
+	for _, m := range b.motors {
+		err = multierr.Combine(err, m.SetPower(ctx, 0, nil), m.Stop(ctx, nil))
+	}
+	return err
+}
+
+// clearEmergencyStop lets the boat move again, it stays stopped until the next motion command
+func (b *boat) clearEmergencyStop() {
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+	if b.state.estopped {
+		b.logger.Info("emergency stop cleared")
+	}
+	b.state.estopped = false
+}
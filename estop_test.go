@@ -0,0 +1,128 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+)
+
+func TestEmergencyStopLatches(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, StopRampMs: 1000}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	fs := &fakeSensor{}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.snapshotState().threadStarted, test.ShouldBeTrue)
+
+	err = b.SetPower(context.Background(), r3.Vector{Y: 1}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get()[0], test.ShouldAlmostEqual, 1, testTheta)
+
+	// goes straight to 0 even though stop is ramped
+	_, err = b.DoCommand(context.Background(), map[string]interface{}{"estop": true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+
+	st := b.snapshotState()
+	test.That(t, st.estopped, test.ShouldBeTrue)
+	test.That(t, st.threadStarted, test.ShouldBeFalse)
+	test.That(t, st.controlState, test.ShouldEqual, controlNone)
+
+	err = b.SetPower(context.Background(), r3.Vector{Y: 1}, r3.Vector{}, nil)
+	test.That(t, errors.Is(err, ErrEStopped), test.ShouldBeTrue)
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, errors.Is(err, ErrEStopped), test.ShouldBeTrue)
+	err = b.Spin(context.Background(), 90, 10, nil)
+	test.That(t, errors.Is(err, ErrEStopped), test.ShouldBeTrue)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+
+	// a normal stop doesn't clear it
+	err = b.Stop(context.Background(), map[string]interface{}{"emergency": true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.snapshotState().estopped, test.ShouldBeTrue)
+
+	res, err := b.DoCommand(context.Background(), map[string]interface{}{"status": true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["estopped"], test.ShouldBeTrue)
+}
+
+func TestEmergencyStopDuringStopRamp(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, StopRampMs: 1000}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	defer b.Close(context.Background())
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: 1}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- b.Stop(context.Background(), nil)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	test.That(t, fm.get()[0], test.ShouldBeGreaterThan, 0)
+
+	_, err = b.DoCommand(context.Background(), map[string]interface{}{"estop": true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+
+	fm.mu.Lock()
+	sent := len(fm.history[0])
+	fm.mu.Unlock()
+
+	// the rest of the ramp never goes out, and the stop gives up on it
+	time.Sleep(200 * time.Millisecond)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+	fm.mu.Lock()
+	test.That(t, len(fm.history[0]), test.ShouldEqual, sent)
+	fm.mu.Unlock()
+
+	select {
+	case err := <-stopped:
+		test.That(t, err, test.ShouldBeNil)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("stop still ramping after the emergency stop")
+	}
+
+	// and nothing else can send power either
+	err = b.sendPower(context.Background(), []float64{1, 1}, 1)
+	test.That(t, errors.Is(err, ErrEStopped), test.ShouldBeTrue)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+}
+
+func TestEmergencyStopReenable(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	fs := &fakeSensor{}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	_, err := b.DoCommand(context.Background(), map[string]interface{}{"estop": true})
+	test.That(t, err, test.ShouldBeNil)
+
+	// clearing doesn't move anything by itself
+	_, err = b.DoCommand(context.Background(), map[string]interface{}{"estop": false})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.snapshotState().estopped, test.ShouldBeFalse)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+
+	err = b.SetPower(context.Background(), r3.Vector{Y: 1}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get()[0], test.ShouldAlmostEqual, 1, testTheta)
+
+	// and the control thread starts again
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.snapshotState().threadStarted, test.ShouldBeTrue)
+}
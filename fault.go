@@ -0,0 +1,106 @@
+package viamboatbase
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/geo/r3"
+)
+
+// withoutMotors is cfg with the named motors taken out. goals are still scaled by what the full
+// set of motors can do, so the rest work harder to make up for the missing ones.
+func (cfg *Config) withoutMotors(names map[string]bool) *Config {
+	full := cfg.maxWeights()
+
+	reduced := *cfg
+	reduced.fullMaxWeights = &full
+	reduced.Motors = nil
+	for _, mc := range cfg.Motors {
+		if !names[mc.Name] {
+			reduced.Motors = append(reduced.Motors, mc)
+		}
+	}
+	return &reduced
+}
+
+// solvePower computes the power for each motor in config order, leaving out faulted motors
+// which always get 0
+func (b *boat) solvePower(linear, angular r3.Vector) ([]float64, error) {
+	b.stateMutex.Lock()
+	faulted := map[string]bool{}
+	for name := range b.state.faultedMotors {
+		faulted[name] = true
+	}
+	b.stateMutex.Unlock()
+
+	if len(faulted) == 0 {
+		powers, err := b.cfg.computePower(linear, angular, b.powerSolver())
+		if err != nil {
+			return nil, err
+		}
+		return powers, checkPowerCount(powers, b.cfg.Motors)
+	}
+
+	reduced := b.cfg.withoutMotors(faulted)
+	if len(reduced.Motors) == 0 {
+		return nil, fmt.Errorf("%w: every motor has faulted", ErrInfeasibleCommand)
+	}
+
+	powers, err := reduced.computePower(linear, angular, b.powerSolver())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPowerCount(powers, reduced.Motors); err != nil {
+		return nil, err
+	}
+
+	res := make([]float64, len(b.cfg.Motors))
+	next := 0
+	for idx, mc := range b.cfg.Motors {
+		if faulted[mc.Name] {
+			continue
+		}
+		res[idx] = powers[next]
+		next++
+	}
+	return res, nil
+}
+
+// checkPowerCount makes sure there's one power for each motor before anything indexes by them
+func checkPowerCount(powers []float64, motors []MotorConfig) error {
+	if len(powers) != len(motors) {
+		return fmt.Errorf("%w, the solver gave %d for %d motors", errPowerCount, len(powers), len(motors))
+	}
+	return nil
+}
+
+// faultMotors takes the named motors out of the allocation. if that would leave none it doesn't,
+// and returns false.
+func (b *boat) faultMotors(names []string) bool {
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+
+	faulted := map[string]bool{}
+	for name := range b.state.faultedMotors {
+		faulted[name] = true
+	}
+	for _, name := range names {
+		faulted[name] = true
+	}
+	if len(faulted) >= len(b.cfg.Motors) {
+		return false
+	}
+	b.state.faultedMotors = faulted
+	return true
+}
+
+// faultedMotorNames is a sorted, comma separated list of the faulted motors for status
+func (s *boatState) faultedMotorNames() string {
+	names := []string{}
+	for name := range s.faultedMotors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,126 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+)
+
+// two motors on each side, so either side can lose one and still drive straight
+var testDoubledMotorConfig = []MotorConfig{
+	{Name: "port1", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1},
+	{Name: "port2", XOffsetMM: -200, YOffsetMM: -1500, Weight: 1},
+	{Name: "starboard1", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1},
+	{Name: "starboard2", XOffsetMM: 200, YOffsetMM: -1500, Weight: 1},
+}
+
+func TestFaultTolerant(t *testing.T) {
+	cfg := &Config{Motors: testDoubledMotorConfig, LengthMM: 3048, WidthMM: 1100, FaultTolerant: true}
+	fm := newFakeMotors(4)
+	b := newTestBoat(t, cfg, fm)
+	b.solver = PseudoInverseSolver{}
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .25}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	for _, p := range fm.get() {
+		test.That(t, p, test.ShouldAlmostEqual, .25, 1e-9)
+	}
+
+	fm.motors[1].SetPowerFunc = func(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
+		return errors.New("overheated")
+	}
+
+	err = b.SetPower(context.Background(), r3.Vector{Y: .25}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	// the other port motor makes up for the missing one, so it still goes straight at the same speed
+	powers := fm.get()
+	test.That(t, powers[0], test.ShouldAlmostEqual, .5, 1e-9)
+	test.That(t, powers[1], test.ShouldEqual, 0)
+	test.That(t, powers[2], test.ShouldAlmostEqual, .25, 1e-9)
+	test.That(t, powers[3], test.ShouldAlmostEqual, .25, 1e-9)
+
+	s := b.snapshotState()
+	test.That(t, s.lastPower[1], test.ShouldEqual, 0)
+	test.That(t, s.faultedMotors, test.ShouldResemble, map[string]bool{"port2": true})
+
+	res, err := b.DoCommand(context.Background(), map[string]interface{}{"status": true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["faulted_motors"], test.ShouldEqual, "port2")
+
+	// it isn't tried again
+	calls := len(fm.history[0])
+	err = b.SetPower(context.Background(), r3.Vector{Y: .1}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(fm.history[0]), test.ShouldEqual, calls+1)
+	test.That(t, fm.get()[1], test.ShouldEqual, 0)
+}
+
+func TestFaultTolerantAllMotorsFail(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, FaultTolerant: true}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	b.solver = PseudoInverseSolver{}
+
+	for _, m := range fm.motors {
+		m.SetPowerFunc = func(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
+			return errors.New("unplugged")
+		}
+	}
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .25}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "unplugged")
+}
+
+func TestNotFaultTolerantStops(t *testing.T) {
+	cfg := &Config{Motors: testDoubledMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(4)
+	b := newTestBoat(t, cfg, fm)
+
+	fm.motors[1].SetPowerFunc = func(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
+		return errors.New("overheated")
+	}
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .25}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0, 0, 0})
+	test.That(t, b.snapshotState().faultedMotors, test.ShouldBeEmpty)
+}
+
+// shortSolver gives one power too few, like a solver that's been handed the wrong config
+type shortSolver struct{}
+
+func (shortSolver) Solve(cfg *Config, linear, angular r3.Vector) ([]float64, error) {
+	return make([]float64, len(cfg.Motors)-1), nil
+}
+
+func TestPowerCountMismatchStops(t *testing.T) {
+	cfg := &Config{Motors: testDoubledMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(4)
+	b := newTestBoat(t, cfg, fm)
+	b.solver = PseudoInverseSolver{}
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .25}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	b.solver = shortSolver{}
+	err = b.SetPower(context.Background(), r3.Vector{Y: .25}, r3.Vector{}, nil)
+	test.That(t, errors.Is(err, ErrInfeasibleCommand), test.ShouldBeTrue)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "3 for 4 motors")
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0, 0, 0})
+
+	// the same with a motor taken out, where the powers are put back in place by index
+	b.solver = PseudoInverseSolver{}
+	test.That(t, b.SetPower(context.Background(), r3.Vector{Y: .25}, r3.Vector{}, nil), test.ShouldBeNil)
+	test.That(t, b.faultMotors([]string{"port2"}), test.ShouldBeTrue)
+
+	b.solver = shortSolver{}
+	err = b.SetPower(context.Background(), r3.Vector{Y: .25}, r3.Vector{}, nil)
+	test.That(t, errors.Is(err, ErrInfeasibleCommand), test.ShouldBeTrue)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "2 for 3 motors")
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0, 0, 0})
+}
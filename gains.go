@@ -0,0 +1,121 @@
+package viamboatbase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// savedGains is what save_pid writes and load_pid reads. a pid that isn't in the file keeps the
+// gains it has, and anything left out of one that is keeps what's in the module config.
+type savedGains struct {
+	Angular *PIDConfig `json:"angular,omitempty"`
+	Linear  *PIDConfig `json:"linear,omitempty"`
+	Lateral *PIDConfig `json:"lateral,omitempty"`
+	Heading *PIDConfig `json:"heading,omitempty"`
+}
+
+// gainsPath is the path given in a save_pid or load_pid command, or the configured one
+func (b *boat) gainsPath(arg interface{}) (string, error) {
+	if m, ok := arg.(map[string]interface{}); ok {
+		if p, ok := m["path"].(string); ok && p != "" {
+			return p, nil
+		}
+	}
+	if b.cfg.PIDStatePath != "" {
+		return b.cfg.PIDStatePath, nil
+	}
+	return "", errors.New("no path given and no pid_state_path configured")
+}
+
+func (b *boat) saveGains(path string) error {
+	b.stateMutex.Lock()
+	g := savedGains{
+		Angular: b.state.angularPID.config(),
+		Linear:  b.state.linearPID.config(),
+		Lateral: b.state.lateralPID.config(),
+		Heading: b.state.headingPID.config(),
+	}
+	b.stateMutex.Unlock()
+
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write somewhere else first so a crash doesn't leave a half written file
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (b *boat) loadGains(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var g savedGains
+	if err := json.Unmarshal(data, &g); err != nil {
+		return fmt.Errorf("can't parse pid gains in %s: %w", path, err)
+	}
+	configure := (*pidState).configure
+	// anything in neither gets the heading pid's own defaults
+	configureHeading := func(pid *pidState, cfg *PIDConfig) { configureHeadingPID(pid, &Config{HeadingPID: cfg}) }
+
+	loads := []struct {
+		name       string
+		saved      *PIDConfig
+		configured *PIDConfig
+		pid        *pidState
+		configure  func(*pidState, *PIDConfig)
+	}{
+		{"angular", g.Angular, b.cfg.AngularPID, &b.state.angularPID, configure},
+		{"linear", g.Linear, b.cfg.LinearPID, &b.state.linearPID, configure},
+		{"lateral", g.Lateral, b.cfg.lateralPID(), &b.state.lateralPID, configure},
+		{"heading", g.Heading, b.cfg.HeadingPID, &b.state.headingPID, configureHeading},
+	}
+	for idx := range loads {
+		if loads[idx].saved == nil {
+			continue
+		}
+		loads[idx].saved = loads[idx].configured.withOverrides(loads[idx].saved)
+		if err := loads[idx].saved.Validate(loads[idx].name); err != nil {
+			return err
+		}
+	}
+
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+	for _, l := range loads {
+		if l.saved == nil {
+			continue
+		}
+		l.configure(l.pid, l.saved)
+		l.pid.Reset()
+	}
+	return nil
+}
+
+// loadGainsAtStartup loads the configured saved gains, if there are any. a missing or bad
+// file is only logged, since the configured gains still work.
+func (b *boat) loadGainsAtStartup() {
+	if b.cfg.PIDStatePath == "" {
+		return
+	}
+	if err := b.loadGains(b.cfg.PIDStatePath); err != nil {
+		b.logger.Warnf("not using saved pid gains: %v", err)
+	}
+}
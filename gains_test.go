@@ -0,0 +1,114 @@
+package viamboatbase
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestPIDConfigRoundTrip(t *testing.T) {
+	p, tau := .3, .2
+	var pid pidState
+	pid.configure(&PIDConfig{P: &p, DerivativeOnMeasurement: true, DerivativeFilterTauSec: &tau})
+
+	var other pidState
+	other.configure(pid.config())
+	test.That(t, other, test.ShouldResemble, pid)
+}
+
+func TestSaveLoadGains(t *testing.T) {
+	p, i, hp := .5, .01, 2.0
+	cfg := &Config{
+		Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100,
+		AngularPID: &PIDConfig{P: &p, I: &i}, HeadingPID: &PIDConfig{P: &hp},
+	}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+
+	path := filepath.Join(t.TempDir(), "gains.json")
+	_, err := b.DoCommand(context.Background(), map[string]interface{}{"save_pid": map[string]interface{}{"path": path}})
+	test.That(t, err, test.ShouldBeNil)
+
+	// a boat with default gains picks up the saved ones
+	cfg2 := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, PIDStatePath: path}
+	b2 := newTestBoat(t, cfg2, newFakeMotors(2))
+	test.That(t, b2.state.angularPID.proportionalGain, test.ShouldNotEqual, p)
+
+	_, err = b2.DoCommand(context.Background(), map[string]interface{}{"load_pid": map[string]interface{}{}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b2.state.angularPID, test.ShouldResemble, b.state.angularPID)
+	test.That(t, b2.state.linearPID, test.ShouldResemble, b.state.linearPID)
+	test.That(t, b2.state.lateralPID, test.ShouldResemble, b.state.lateralPID)
+	test.That(t, b2.state.headingPID, test.ShouldResemble, b.state.headingPID)
+
+	// missing and corrupt files are errors, and don't change anything
+	_, err = b2.DoCommand(context.Background(), map[string]interface{}{"load_pid": map[string]interface{}{"path": path + ".nope"}})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	test.That(t, os.WriteFile(path, []byte("{not json"), 0o600), test.ShouldBeNil)
+	_, err = b2.DoCommand(context.Background(), map[string]interface{}{"load_pid": map[string]interface{}{}})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, b2.state.angularPID.proportionalGain, test.ShouldEqual, p)
+
+	// no path anywhere
+	_, err = b.DoCommand(context.Background(), map[string]interface{}{"save_pid": map[string]interface{}{}})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestLoadGainsAtStartup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gains.json")
+	test.That(t, os.WriteFile(path, []byte(`{"angular": {"p": 0.7}, "linear": {"i": 0.2}}`), 0o600), test.ShouldBeNil)
+
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, PIDStatePath: path}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	b.loadGainsAtStartup()
+	test.That(t, b.state.angularPID.proportionalGain, test.ShouldEqual, .7)
+	test.That(t, b.state.linearPID.integralGain, test.ShouldEqual, .2)
+
+	// a bad file keeps the configured gains
+	test.That(t, os.WriteFile(path, []byte("garbage"), 0o600), test.ShouldBeNil)
+	b = newTestBoat(t, cfg, newFakeMotors(2))
+	b.loadGainsAtStartup()
+	test.That(t, b.state.angularPID.proportionalGain, test.ShouldEqual, .08)
+}
+
+func TestLoadGainsPartial(t *testing.T) {
+	lp, hp := .3, 2.0
+	cfg := &Config{
+		Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100,
+		LinearPID: &PIDConfig{P: &lp}, HeadingPID: &PIDConfig{P: &hp},
+	}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	linear, heading := b.state.linearPID, b.state.headingPID
+
+	// only angular is in the file, so the rest stay as configured instead of going to defaults
+	path := filepath.Join(t.TempDir(), "gains.json")
+	test.That(t, os.WriteFile(path, []byte(`{"angular": {"p": 0.7}}`), 0o600), test.ShouldBeNil)
+	test.That(t, b.loadGains(path), test.ShouldBeNil)
+	test.That(t, b.state.angularPID.proportionalGain, test.ShouldEqual, .7)
+	test.That(t, b.state.linearPID, test.ShouldResemble, linear)
+	test.That(t, b.state.headingPID, test.ShouldResemble, heading)
+
+	// an entry only changes what it has, the rest is what's configured
+	test.That(t, os.WriteFile(path, []byte(`{"linear": {"i": 0.2}, "heading": {"d": 0.1}}`), 0o600), test.ShouldBeNil)
+	test.That(t, b.loadGains(path), test.ShouldBeNil)
+	test.That(t, b.state.linearPID.integralGain, test.ShouldEqual, .2)
+	test.That(t, b.state.linearPID.proportionalGain, test.ShouldEqual, .3)
+	test.That(t, b.state.headingPID.derivativeGain, test.ShouldEqual, .1)
+	test.That(t, b.state.headingPID.proportionalGain, test.ShouldEqual, 2)
+
+	// and what's in neither gets the usual defaults, which are different for heading
+	test.That(t, b.state.linearPID.derivativeGain, test.ShouldEqual, .0001)
+	test.That(t, b.state.headingPID.integralGain, test.ShouldEqual, 0)
+	test.That(t, b.state.headingPID.maxOutput, test.ShouldEqual, 0)
+
+	// a saved entry that clashes with the config is caught too
+	maxOutput := 5.0
+	cfg.LinearPID = &PIDConfig{P: &lp, MaxOutput: &maxOutput}
+	test.That(t, os.WriteFile(path, []byte(`{"linear": {"min_output": 6}}`), 0o600), test.ShouldBeNil)
+	test.That(t, b.loadGains(path), test.ShouldNotBeNil)
+	test.That(t, b.state.linearPID.integralGain, test.ShouldEqual, .2)
+	test.That(t, b.state.angularPID.proportionalGain, test.ShouldEqual, .7)
+}
@@ -0,0 +1,38 @@
+package viamboatbase
+
+import (
+	"errors"
+
+	geo "github.com/kellydunn/golang-geo"
+)
+
+// ErrOutsideGeofence is what the control loop stops the boat with when it leaves the geofence
+var ErrOutsideGeofence = errors.New("boat is outside the geofence")
+
+// GeoPoint is one corner of the geofence
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// insideGeofence is true if p is inside the polygon. a missing position is never inside.
+// fences are small enough that treating lat/lng as flat is fine, but they can't cross the antimeridian.
+func insideGeofence(p *geo.Point, fence []GeoPoint) bool {
+	if p == nil || len(fence) < 3 {
+		return false
+	}
+
+	// ray casting, count how many edges a line going east from p crosses
+	inside := false
+	lat, lng := p.Lat(), p.Lng()
+	for i, j := 0, len(fence)-1; i < len(fence); j, i = i, i+1 {
+		a, b := fence[i], fence[j]
+		if (a.Latitude > lat) != (b.Latitude > lat) {
+			crossLng := a.Longitude + (lat-a.Latitude)/(b.Latitude-a.Latitude)*(b.Longitude-a.Longitude)
+			if lng < crossLng {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
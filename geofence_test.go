@@ -0,0 +1,168 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/components/movementsensor"
+)
+
+// a square about 1km on a side, with a notch cut out of the east side
+var testGeofence = []GeoPoint{
+	{40.70, -73.91},
+	{40.71, -73.91},
+	{40.71, -73.90},
+	{40.706, -73.90},
+	{40.706, -73.905},
+	{40.704, -73.905},
+	{40.704, -73.90},
+	{40.70, -73.90},
+}
+
+func TestInsideGeofence(t *testing.T) {
+	test.That(t, insideGeofence(geo.NewPoint(40.705, -73.908), testGeofence), test.ShouldBeTrue)
+	test.That(t, insideGeofence(geo.NewPoint(40.709, -73.901), testGeofence), test.ShouldBeTrue)
+
+	// in the notch
+	test.That(t, insideGeofence(geo.NewPoint(40.705, -73.902), testGeofence), test.ShouldBeFalse)
+
+	test.That(t, insideGeofence(geo.NewPoint(40.72, -73.905), testGeofence), test.ShouldBeFalse)
+	test.That(t, insideGeofence(geo.NewPoint(40.705, -73.92), testGeofence), test.ShouldBeFalse)
+	test.That(t, insideGeofence(nil, testGeofence), test.ShouldBeFalse)
+	test.That(t, insideGeofence(geo.NewPoint(40.705, -73.908), testGeofence[:2]), test.ShouldBeFalse)
+}
+
+func TestGeofenceStops(t *testing.T) {
+	// the loop is run by hand, so keep the control thread out of the way
+	cfg := &Config{
+		Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, Geofence: testGeofence, ControlLoopMs: 60000,
+		MovementSensor: "gps",
+	}
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	// heading north 200m every reading, starting 100m from the north edge
+	fs := &fakeSensor{position: geo.NewPoint(40.709, -73.908), positionStepMM: 200 * 1000}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	test.That(t, fm.get()[0], test.ShouldBeGreaterThan, 0)
+
+	err = b.velocityThreadLoop(context.Background())
+	test.That(t, errors.Is(err, ErrOutsideGeofence), test.ShouldBeTrue)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+
+	cfg.Geofence = testGeofence[:2]
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestGeofenceNeedsPosition(t *testing.T) {
+	// separate sensors for everything but position, so there's nothing to check the fence with
+	cfg := &Config{
+		Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, Geofence: testGeofence, ControlLoopMs: 60000,
+		HeadingSensor: "compass", AngularVelocitySensor: "gyro", LinearVelocitySensor: "dvl",
+	}
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "movement_sensor")
+
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	defer b.Close(context.Background())
+
+	fs := &fakeSensor{}
+	b.headingSensor = fs.movementSensor()
+	b.angularVelocitySensor = fs.movementSensor()
+	b.linearVelocitySensor = fs.movementSensor()
+
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	// if it gets this far anyway, the loop stops instead of going on unfenced
+	err = b.velocityThreadLoop(context.Background())
+	test.That(t, errors.Is(err, ErrPositionNotSupported), test.ShouldBeTrue)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+	test.That(t, b.snapshotState().controlState, test.ShouldEqual, controlNone)
+
+	// same for a movement sensor that can't give a position
+	b.movementSensor = fs.movementSensor()
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	err = b.velocityThreadLoop(context.Background())
+	test.That(t, errors.Is(err, ErrPositionNotSupported), test.ShouldBeTrue)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+}
+
+func TestGeofencePropertiesFailure(t *testing.T) {
+	cfg := &Config{
+		Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, Geofence: testGeofence, ControlLoopMs: 60000,
+		MovementSensor: "gps",
+	}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	fs := &fakeSensor{position: geo.NewPoint(40.705, -73.908)}
+	ms := fs.movementSensor()
+	properties := ms.PropertiesFunc
+	var mu sync.Mutex
+	var propertiesErr error
+	hang := make(chan struct{})
+	defer close(hang)
+	hung := false
+	ms.PropertiesFunc = func(ctx context.Context, extra map[string]interface{}) (*movementsensor.Properties, error) {
+		mu.Lock()
+		err, h := propertiesErr, hung
+		mu.Unlock()
+		if h {
+			<-hang
+		}
+		if err != nil {
+			return nil, err
+		}
+		return properties(ctx, extra)
+	}
+	b.movementSensor = concurrentSensor{ms}
+	defer b.Close(context.Background())
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, b.velocityThreadLoop(context.Background()), test.ShouldBeNil)
+	powers := fm.get()
+	test.That(t, powers[0], test.ShouldBeGreaterThan, 0)
+
+	// one bad answer is a failed reading, not a reason to stop
+	mu.Lock()
+	propertiesErr = errors.New("busy")
+	mu.Unlock()
+	err = b.velocityThreadLoop(context.Background())
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, errors.Is(err, ErrPositionNotSupported), test.ShouldBeFalse)
+	test.That(t, b.snapshotState().controlState, test.ShouldEqual, controlVelocity)
+	test.That(t, fm.get(), test.ShouldResemble, powers)
+
+	// and asking gives up with the rest of the reading
+	mu.Lock()
+	propertiesErr, hung = nil, true
+	mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = b.readSensors(ctx, true)
+	test.That(t, errors.Is(err, context.DeadlineExceeded), test.ShouldBeTrue)
+	test.That(t, time.Since(start), test.ShouldBeLessThan, time.Second)
+}
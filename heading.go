@@ -0,0 +1,70 @@
+package viamboatbase
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/golang/geo/r3"
+)
+
+const (
+	headingControlPID  = "pid"
+	headingControlRamp = "ramp"
+)
+
+// configureHeadingPID sets up the heading pid, its output is an angular velocity goal in degs/sec.
+// by default it's proportional only, since the angular pid underneath already has an integral.
+func configureHeadingPID(pid *pidState, cfg *Config) {
+	pid.configure(cfg.HeadingPID)
+
+	if cfg.HeadingPID == nil || cfg.HeadingPID.P == nil {
+		pid.proportionalGain = 1
+	}
+	if cfg.HeadingPID == nil || cfg.HeadingPID.I == nil {
+		pid.integralGain = 0
+	}
+	if cfg.HeadingPID == nil || cfg.HeadingPID.D == nil {
+		pid.derivativeGain = 0
+	}
+
+	// the output is limited to the turn limit of each call, so there's no fixed limit by default
+	if cfg.HeadingPID == nil || cfg.HeadingPID.MinOutput == nil {
+		pid.minOutput = 0
+	}
+	if cfg.HeadingPID == nil || cfg.HeadingPID.MaxOutput == nil {
+		pid.maxOutput = 0
+	}
+}
+
+// updateVelocityGoalForHeadingPID sets the angular velocity goal from the heading error diff
+func updateVelocityGoalForHeadingPID(state *boatState, diff float64) {
+	if math.Abs(diff) <= state.headingDeadband {
+		state.velocityAngularGoal.Z = 0
+		return
+	}
+
+	z := state.headingPID.Control(diff, 0, state.dt())
+	if limit := state.turnLimit(); limit > 0 {
+		z = math.Max(-limit, math.Min(limit, z))
+	}
+	state.velocityAngularGoal.Z = z
+}
+
+// setHeading turns to a heading and keeps holding it until something else is commanded, unlike
+// Spin which returns once it's there. arg is the compass heading in degrees, or
+// {"heading": deg, "degs_per_sec": 10} to also say how fast to turn.
+func (b *boat) setHeading(ctx context.Context, arg interface{}) error {
+	args, ok := arg.(map[string]interface{})
+	if !ok {
+		args = map[string]interface{}{"heading": arg}
+	}
+
+	heading, ok := floatFromExtra(args, "heading")
+	if !ok {
+		return fmt.Errorf("set_heading needs a heading in degrees, not %v", arg)
+	}
+	degsPerSec, _ := floatFromExtra(args, "degs_per_sec")
+
+	return b.SetVelocity(ctx, r3.Vector{}, r3.Vector{Z: degsPerSec}, map[string]interface{}{"hold_heading": heading})
+}
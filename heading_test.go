@@ -0,0 +1,234 @@
+package viamboatbase
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/spatialmath"
+)
+
+// settle turns from heading 0 toward 90, assuming the angular velocity goal is reached right away,
+// and returns how many loops it took to stop turning and the furthest past the goal it went
+func settle(t *testing.T, cfg *Config) (int, float64) {
+	t.Helper()
+	state := &boatState{}
+	state.configure(cfg)
+	state.compassGoal = 90
+	state.spinVelocity = 30
+
+	heading := 0.0
+	overshoot := 0.0
+	for loops := 1; loops < 1000; loops++ {
+		updateVelocityGoalForHeading(state, heading)
+		// negative angular z increases the compass heading
+		heading -= state.velocityAngularGoal.Z * state.dt().Seconds()
+		overshoot = math.Max(overshoot, heading-90)
+		if state.velocityAngularGoal.Z == 0 {
+			return loops, overshoot
+		}
+	}
+	t.Fatalf("never settled, heading: %v", heading)
+	return 0, 0
+}
+
+func TestHeadingPIDSettles(t *testing.T) {
+	pidLoops, pidOvershoot := settle(t, &Config{})
+	rampLoops, rampOvershoot := settle(t, &Config{HeadingControl: "ramp"})
+
+	test.That(t, pidOvershoot, test.ShouldEqual, 0)
+	test.That(t, rampOvershoot, test.ShouldEqual, 0)
+
+	// the pid slows down over a longer distance than the 5 degree ramp, so it takes a bit longer,
+	// but not wildly so
+	test.That(t, pidLoops, test.ShouldBeGreaterThanOrEqualTo, rampLoops)
+	test.That(t, pidLoops, test.ShouldBeLessThan, 3*rampLoops)
+
+	// more gain gets there sooner
+	p := 4.0
+	fastLoops, fastOvershoot := settle(t, &Config{HeadingPID: &PIDConfig{P: &p}})
+	test.That(t, fastLoops, test.ShouldBeLessThan, pidLoops)
+	test.That(t, fastOvershoot, test.ShouldBeLessThan, 1)
+}
+
+func TestHeadingPIDGoal(t *testing.T) {
+	state := &boatState{}
+	state.configure(&Config{})
+	state.spinVelocity = 10
+	state.compassGoal = 0
+
+	// limited to the spin velocity, turning the short way
+	updateVelocityGoalForHeading(state, 30)
+	test.That(t, state.velocityAngularGoal.Z, test.ShouldEqual, 10)
+	updateVelocityGoalForHeading(state, 330)
+	test.That(t, state.velocityAngularGoal.Z, test.ShouldEqual, -10)
+
+	// proportional when close
+	updateVelocityGoalForHeading(state, 4)
+	test.That(t, state.velocityAngularGoal.Z, test.ShouldAlmostEqual, 4)
+	updateVelocityGoalForHeading(state, 357)
+	test.That(t, state.velocityAngularGoal.Z, test.ShouldAlmostEqual, -3)
+
+	// and stopped in the deadband
+	updateVelocityGoalForHeading(state, .5)
+	test.That(t, state.velocityAngularGoal.Z, test.ShouldEqual, 0)
+}
+
+func TestHeadingControlConfig(t *testing.T) {
+	cfg := Config{Motors: testMotorConfig, LengthMM: 500, WidthMM: 500, HeadingControl: "ramp"}
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	cfg.HeadingControl = "bang"
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	neg := -1.0
+	cfg.HeadingControl = ""
+	cfg.HeadingPID = &PIDConfig{P: &neg}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestTurnRateCapped(t *testing.T) {
+	p := 10.0
+	for _, cfg := range []*Config{
+		{HeadingPID: &PIDConfig{P: &p}, MaxAngularVelocityDegPerSec: 15},
+		{HeadingControl: "ramp", MaxAngularVelocityDegPerSec: 15},
+	} {
+		for _, spin := range []float64{20, -20, 0, 5} {
+			state := &boatState{}
+			state.configure(cfg)
+			state.compassGoal = 170
+			state.spinVelocity = spin
+
+			limit := 15.0
+			if spin == 5 {
+				limit = 5
+			}
+
+			heading := 0.0
+			fastest := 0.0
+			for loops := 0; loops < 1000 && heading < 169; loops++ {
+				updateVelocityGoalForHeading(state, heading)
+				z := state.velocityAngularGoal.Z
+				test.That(t, math.Abs(z), test.ShouldBeLessThanOrEqualTo, limit)
+				fastest = math.Max(fastest, math.Abs(z))
+				heading -= z * state.dt().Seconds()
+			}
+			// it does get up to the limit on the way, and gets there
+			test.That(t, fastest, test.ShouldAlmostEqual, limit)
+			test.That(t, heading, test.ShouldBeGreaterThanOrEqualTo, 169)
+		}
+	}
+}
+
+func TestHeadingCounterClockwise(t *testing.T) {
+	// heading 100, holding 120, so it should turn clockwise 20 degrees. read backwards, a
+	// counterclockwise 260 would look like 140 degrees the other way.
+	for _, tc := range []struct {
+		counterClockwise bool
+		reported         float64
+	}{
+		{false, 100},
+		{true, 260},
+	} {
+		cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000,
+			HeadingCounterClockwise: tc.counterClockwise}
+		b := newTestBoat(t, cfg, newFakeMotors(2))
+		b.movementSensor = (&fakeSensor{heading: tc.reported}).movementSensor()
+
+		heading, err := b.CurrentHeading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, heading, test.ShouldAlmostEqual, 100)
+
+		r, err := b.readSensors(context.Background(), false)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, r.heading, test.ShouldAlmostEqual, 100)
+
+		err = b.SetVelocity(context.Background(), r3.Vector{}, r3.Vector{}, map[string]interface{}{"hold_heading": 120.0})
+		test.That(t, err, test.ShouldBeNil)
+
+		s := b.snapshotState()
+		updateVelocityGoalForHeading(&s, r.heading)
+		// negative angular z is clockwise
+		test.That(t, s.velocityAngularGoal.Z, test.ShouldBeLessThan, 0)
+
+		// Spin counts from the corrected heading too
+		b.Close(context.Background())
+		b = newTestBoat(t, cfg, newFakeMotors(2))
+		b.movementSensor = (&fakeSensor{heading: tc.reported}).movementSensor()
+		_ = b.Spin(context.Background(), 30, 20, map[string]interface{}{"timeout_sec": .01})
+		test.That(t, b.snapshotState().compassGoal, test.ShouldAlmostEqual, 130)
+		b.Close(context.Background())
+	}
+}
+
+func TestAngularVelocityClockwise(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, AngularVelocityClockwise: true}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	b.movementSensor = (&fakeSensor{angularVelocity: spatialmath.AngularVelocity{Z: 5}}).movementSensor()
+
+	// turning 5 degs/sec clockwise, which is -5 everywhere else
+	_, av, err := b.readVelocities(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, av, test.ShouldEqual, -5)
+
+	r, err := b.readSensors(context.Background(), false)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, r.angularVelocity.Z, test.ShouldEqual, -5)
+}
+
+func TestSetHeadingHolds(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 20}
+	sim := newFakeBoatSystem(cfg, 200*time.Millisecond)
+	sim.sensor.set(60, r3.Vector{}, spatialmath.AngularVelocity{})
+	sim.start(5 * time.Millisecond)
+	defer sim.stop()
+
+	b := sim.boat(t)
+	defer b.Close(context.Background())
+
+	headingError := func() float64 {
+		h, err := b.CurrentHeading(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+		return math.Abs(angleDiffDeg(100, h))
+	}
+	waitForHeading := func() bool {
+		for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+			if headingError() < 2*cfg.spinTolerance() {
+				return true
+			}
+		}
+		return false
+	}
+
+	_, err := b.DoCommand(context.Background(), map[string]interface{}{
+		"set_heading": map[string]interface{}{"heading": 100.0, "degs_per_sec": 45.0},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, waitForHeading(), test.ShouldBeTrue)
+
+	// a wave knocks it around, and it turns back without being told again
+	sim.sensor.set(140, r3.Vector{}, spatialmath.AngularVelocity{})
+	test.That(t, headingError(), test.ShouldBeGreaterThan, 30)
+	test.That(t, waitForHeading(), test.ShouldBeTrue)
+
+	s := b.snapshotState()
+	test.That(t, s.controlState, test.ShouldEqual, controlHeading)
+	test.That(t, s.compassGoal, test.ShouldEqual, 100)
+
+	// a bare number is the heading, at the default turn rate
+	_, err = b.DoCommand(context.Background(), map[string]interface{}{"set_heading": 90})
+	test.That(t, err, test.ShouldBeNil)
+	s = b.snapshotState()
+	test.That(t, s.compassGoal, test.ShouldEqual, 90)
+	test.That(t, s.spinVelocity, test.ShouldEqual, defaultHoldHeadingDegsPerSec)
+
+	_, err = b.DoCommand(context.Background(), map[string]interface{}{"set_heading": "north"})
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -0,0 +1,66 @@
+package viamboatbase
+
+import (
+	"context"
+	"time"
+
+	"go.viam.com/utils"
+)
+
+// startKeepAlive sends 0 to every motor each MotorKeepAliveMs while the boat is stopped, for
+// ESCs that disarm when they don't hear anything for a while. while moving, the control loop or
+// whoever is setting power keeps them busy.
+func (b *boat) startKeepAlive() {
+	if b.cfg.MotorKeepAliveMs <= 0 || b.cfg.DryRun {
+		return
+	}
+
+	var ctx context.Context
+	ctx, b.keepAliveCancel = context.WithCancel(context.Background())
+	interval := time.Duration(b.cfg.MotorKeepAliveMs * float64(time.Millisecond))
+
+	b.keepAliveWorkers.Add(1)
+	go func() {
+		defer b.keepAliveWorkers.Done()
+		for utils.SelectContextOrWait(ctx, interval) {
+			b.keepAlive(ctx)
+		}
+	}()
+}
+
+func (b *boat) stopKeepAlive() {
+	if b.keepAliveCancel != nil {
+		b.keepAliveCancel()
+	}
+	b.keepAliveWorkers.Wait()
+}
+
+// keepAlive sends 0 to the motors if they're meant to be stopped. powerMutex keeps a command
+// that's sending power right now from being overwritten by it. a Stop that's still ramping down
+// or an operation like calibrate_motor that sets a motor itself isn't stopped yet, even though
+// lastPower is all 0.
+func (b *boat) keepAlive(ctx context.Context) {
+	b.powerMutex.Lock()
+	defer b.powerMutex.Unlock()
+
+	b.stateMutex.Lock()
+	stopped := b.state.controlState == controlNone && b.stopRamps == 0
+	for _, p := range b.state.lastPower {
+		stopped = stopped && p == 0
+	}
+	faulted := b.state.faultedMotors
+	b.stateMutex.Unlock()
+
+	if !stopped || b.opMgr.OpRunning() {
+		return
+	}
+
+	for _, mc := range b.cfg.Motors {
+		if faulted[mc.Name] {
+			continue
+		}
+		if err := b.motors[mc.Name].SetPower(ctx, 0, nil); err != nil && ctx.Err() == nil {
+			b.logger.Warnf("keep alive for motor %q failed: %v", mc.Name, err)
+		}
+	}
+}
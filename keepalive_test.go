@@ -0,0 +1,122 @@
+package viamboatbase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/spatialmath"
+)
+
+func TestMotorKeepAlive(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, MotorKeepAliveMs: 10}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	b.startKeepAlive()
+	defer b.Close(context.Background())
+
+	history := func() [][]float64 {
+		fm.mu.Lock()
+		defer fm.mu.Unlock()
+		return [][]float64{append([]float64{}, fm.history[0]...), append([]float64{}, fm.history[1]...)}
+	}
+
+	// sitting idle, every motor keeps getting 0
+	time.Sleep(100 * time.Millisecond)
+	for _, h := range history() {
+		test.That(t, len(h), test.ShouldBeGreaterThanOrEqualTo, 3)
+		for _, p := range h {
+			test.That(t, p, test.ShouldEqual, 0)
+		}
+	}
+
+	// but not once it's been given power
+	err := b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	before := history()
+	time.Sleep(50 * time.Millisecond)
+	test.That(t, history(), test.ShouldResemble, before)
+	for _, p := range fm.get() {
+		test.That(t, p, test.ShouldAlmostEqual, .5)
+	}
+
+	// and it picks up again after a stop
+	test.That(t, b.Stop(context.Background(), nil), test.ShouldBeNil)
+	time.Sleep(50 * time.Millisecond)
+	test.That(t, len(history()[0]), test.ShouldBeGreaterThan, len(before[0]))
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+}
+
+func TestMotorKeepAliveDuringStopRamp(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, MotorKeepAliveMs: 10, StopRampMs: 200}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	b.startKeepAlive()
+	defer b.Close(context.Background())
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: 1}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	fm.mu.Lock()
+	before := len(fm.history[0])
+	fm.mu.Unlock()
+
+	test.That(t, b.Stop(context.Background(), nil), test.ShouldBeNil)
+
+	// the ramp goes steadily down without any 0s from the keep alive cutting in
+	fm.mu.Lock()
+	ramp := append([]float64{}, fm.history[0][before:]...)
+	fm.mu.Unlock()
+	test.That(t, len(ramp), test.ShouldBeGreaterThan, 2)
+	for idx, p := range ramp {
+		test.That(t, p, test.ShouldBeGreaterThan, 0)
+		if idx > 0 {
+			test.That(t, p, test.ShouldBeLessThan, ramp[idx-1])
+		}
+	}
+}
+
+func TestMotorKeepAliveDuringCalibrate(t *testing.T) {
+	cfg := calibrationConfig()
+	cfg.MotorKeepAliveMs = 10
+	fm := newFakeMotors(3)
+	b := newTestBoat(t, cfg, fm)
+	b.startKeepAlive()
+	defer b.Close(context.Background())
+
+	fs := &fakeSensor{}
+	b.movementSensor = fs.movementSensor()
+	setPower := fm.motors[1].SetPowerFunc
+	fm.motors[1].SetPowerFunc = func(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
+		if powerPct != 0 {
+			fs.set(0, r3.Vector{Y: 200}, spatialmath.AngularVelocity{Z: -5})
+		}
+		return setPower(ctx, powerPct, extra)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.DoCommand(context.Background(), map[string]interface{}{
+			"calibrate_motor": map[string]interface{}{"name": "starboard", "power": .4, "duration_sec": .3},
+		})
+		done <- err
+	}()
+
+	// calibrate sets the motor itself, so the keep alive has to leave it running
+	time.Sleep(150 * time.Millisecond)
+	test.That(t, fm.get()[1], test.ShouldEqual, .4)
+	test.That(t, <-done, test.ShouldBeNil)
+}
+
+func TestMotorKeepAliveOff(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	b.startKeepAlive()
+	defer b.Close(context.Background())
+
+	time.Sleep(30 * time.Millisecond)
+	test.That(t, fm.history, test.ShouldResemble, [][]float64{nil, nil})
+}
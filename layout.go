@@ -0,0 +1,53 @@
+package viamboatbase
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// layoutDifferential is two motors at the stern, both pushing forward, steering by running them at different powers
+const layoutDifferential = "differential"
+
+// applyLayout fills in Motors from Layout, so the common hulls don't need offsets and angles worked
+// out by hand. it's safe to call more than once.
+func (cfg *Config) applyLayout() error {
+	switch cfg.Layout {
+	case "":
+		return nil
+	case layoutDifferential:
+	default:
+		return fmt.Errorf("unknown layout %q", cfg.Layout)
+	}
+
+	if cfg.LeftMotor == "" || cfg.RightMotor == "" {
+		return errors.New("differential layout needs left_motor and right_motor")
+	}
+	if cfg.LeftMotor == cfg.RightMotor {
+		return errors.New("left_motor and right_motor have to be different motors")
+	}
+	if cfg.MotorSpacingMM < 0 {
+		return errors.New("motor_spacing_mm can't be negative")
+	}
+
+	motors := cfg.differentialMotors()
+	if len(cfg.Motors) > 0 && !reflect.DeepEqual(cfg.Motors, motors) {
+		return errors.New("can't set both motors and layout")
+	}
+	cfg.Motors = motors
+	return nil
+}
+
+// differentialMotors puts the left and right motors at the stern, motor_spacing_mm apart,
+// or half the width apart if that isn't set
+func (cfg *Config) differentialMotors() []MotorConfig {
+	spacing := cfg.MotorSpacingMM
+	if spacing == 0 {
+		spacing = cfg.WidthMM / 2
+	}
+
+	return []MotorConfig{
+		{Name: cfg.LeftMotor, XOffsetMM: -spacing / 2, YOffsetMM: -cfg.LengthMM / 2, Weight: 1},
+		{Name: cfg.RightMotor, XOffsetMM: spacing / 2, YOffsetMM: -cfg.LengthMM / 2, Weight: 1},
+	}
+}
@@ -0,0 +1,63 @@
+package viamboatbase
+
+import (
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestDifferentialLayout(t *testing.T) {
+	cfg := &Config{Layout: "differential", LeftMotor: "port", RightMotor: "starboard", LengthMM: 3048, WidthMM: 1100}
+	deps, err := cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"port", "starboard"})
+
+	byHand := &Config{
+		Motors: []MotorConfig{
+			{Name: "port", XOffsetMM: -275, YOffsetMM: -1524, Weight: 1},
+			{Name: "starboard", XOffsetMM: 275, YOffsetMM: -1524, Weight: 1},
+		},
+		LengthMM: 3048,
+		WidthMM:  1100,
+	}
+	test.That(t, cfg.Motors, test.ShouldResemble, byHand.Motors)
+	test.That(t, mat.Equal(cfg.weightsAsMatrix(), byHand.weightsAsMatrix()), test.ShouldBeTrue)
+
+	p1, err := cfg.ComputePower(r3.Vector{Y: .5}, r3.Vector{Z: .3})
+	test.That(t, err, test.ShouldBeNil)
+	p2, err := byHand.ComputePower(r3.Vector{Y: .5}, r3.Vector{Z: .3})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, p1, test.ShouldResemble, p2)
+
+	// validating again is fine
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	cfg = &Config{Layout: "differential", LeftMotor: "l", RightMotor: "r", MotorSpacingMM: 800, LengthMM: 3048, WidthMM: 1100}
+	test.That(t, cfg.applyLayout(), test.ShouldBeNil)
+	test.That(t, cfg.Motors[0].XOffsetMM, test.ShouldEqual, -400)
+	test.That(t, cfg.Motors[1].XOffsetMM, test.ShouldEqual, 400)
+}
+
+func TestDifferentialLayoutInvalid(t *testing.T) {
+	cfg := &Config{Layout: "differential", LeftMotor: "port", LengthMM: 3048, WidthMM: 1100}
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg = &Config{Layout: "differential", LeftMotor: "port", RightMotor: "port", LengthMM: 3048, WidthMM: 1100}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg = &Config{Layout: "quad", LeftMotor: "port", RightMotor: "starboard", LengthMM: 3048, WidthMM: 1100}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg = &Config{
+		Layout: "differential", LeftMotor: "port", RightMotor: "starboard", LengthMM: 3048, WidthMM: 1100,
+		Motors: testTwoMotorConfig,
+	}
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
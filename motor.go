@@ -1,9 +1,11 @@
 package viamboatbase
 
 import (
+	"errors"
 	"math"
 
 	"go.viam.com/rdk/utils"
+	goutils "go.viam.com/utils"
 )
 
 type motorWeights struct {
@@ -13,9 +15,14 @@ type motorWeights struct {
 }
 
 func (mw *motorWeights) diff(other motorWeights) float64 {
-	return math.Sqrt(math.Pow(mw.linearX-other.linearX, 2) +
-		math.Pow(mw.linearY-other.linearY, 2) +
-		math.Pow(mw.angular-other.angular, 2))
+	return mw.weightedDiff(other, motorWeights{1, 1, 1})
+}
+
+// weightedDiff is diff, with the error on each axis multiplied by scale's, for how much it matters
+func (mw *motorWeights) weightedDiff(other, scale motorWeights) float64 {
+	return math.Sqrt(math.Pow(scale.linearX*(mw.linearX-other.linearX), 2) +
+		math.Pow(scale.linearY*(mw.linearY-other.linearY), 2) +
+		math.Pow(scale.angular*(mw.angular-other.angular), 2))
 }
 
 type MotorConfig struct {
@@ -24,6 +31,194 @@ type MotorConfig struct {
 	YOffsetMM    float64 `json:"y_offset_mm"`
 	AngleDegrees float64 `json:"angle_degs"` // 0 is thrusting forward, 90 is thrusting to starboard, or positive x
 	Weight       float64
+
+	// limits on the power sent to this motor, default to -1 and 1
+	MinPower *float64 `json:"min_power,omitempty"`
+	MaxPower *float64 `json:"max_power,omitempty"`
+
+	// Reversed is for a motor that's mounted backwards, so positive power pushes opposite AngleDegrees.
+	// all the mixing is done in terms of thrust along AngleDegrees, and the power is only flipped
+	// right before it's sent to the motor.
+	Reversed bool `json:"reversed,omitempty"`
+
+	// how much thrust the motor makes in reverse compared to forward, in (0, 1]. default 1.
+	ReverseThrustScale *float64 `json:"reverse_thrust_scale,omitempty"`
+
+	// ThrustCurve is measured thrust at a few powers, in any units, sorted by power. the mixing
+	// works in terms of thrust, and this is used to find the power that makes it. if every point
+	// has power >= 0, the curve is mirrored for reverse. with no curve, thrust is linear in power.
+	ThrustCurve []ThrustPoint `json:"thrust_curve,omitempty"`
+
+	// the motor doesn't turn below this power, so anything smaller but not 0 is raised to it
+	DeadbandPower float64 `json:"deadband_power,omitempty"`
+
+	// PowerQuantum is the smallest step the driver can tell apart, and the power sent is rounded to
+	// the nearest multiple of it. 0 doesn't round.
+	PowerQuantum float64 `json:"power_quantum,omitempty"`
+
+	// Trim is added to the power for a motor that pushes a little off even when it's mounted right,
+	// so it shifts the zero point to the power that really makes no thrust. it's in terms of thrust
+	// along AngleDegrees like the rest, and 0 is still sent as 0 so a stopped motor is off.
+	Trim float64 `json:"trim,omitempty"`
+}
+
+type ThrustPoint struct {
+	Power  float64 `json:"power"`
+	Thrust float64 `json:"thrust"`
+}
+
+func (mc *MotorConfig) Validate(path string) error {
+	if mc.minPower() < -1 || mc.maxPower() > 1 {
+		return goutils.NewConfigValidationError(path, errors.New("min_power and max_power have to be in [-1, 1]"))
+	}
+	if mc.minPower() >= mc.maxPower() {
+		return goutils.NewConfigValidationError(path, errors.New("min_power has to be less than max_power"))
+	}
+	if s := mc.reverseThrustScale(); s <= 0 || s > 1 {
+		return goutils.NewConfigValidationError(path, errors.New("reverse_thrust_scale has to be in (0, 1]"))
+	}
+	if mc.DeadbandPower < 0 || mc.DeadbandPower >= 1 {
+		return goutils.NewConfigValidationError(path, errors.New("deadband_power has to be in [0, 1)"))
+	}
+	if mc.Trim <= -1 || mc.Trim >= 1 {
+		return goutils.NewConfigValidationError(path, errors.New("trim has to be in (-1, 1)"))
+	}
+	if mc.PowerQuantum < 0 || mc.PowerQuantum >= 1 {
+		return goutils.NewConfigValidationError(path, errors.New("power_quantum has to be in [0, 1)"))
+	}
+	if len(mc.ThrustCurve) == 1 {
+		return goutils.NewConfigValidationError(path, errors.New("thrust_curve needs at least 2 points"))
+	}
+	for idx := 1; idx < len(mc.ThrustCurve); idx++ {
+		prev, cur := mc.ThrustCurve[idx-1], mc.ThrustCurve[idx]
+		if cur.Power <= prev.Power || cur.Thrust <= prev.Thrust {
+			return goutils.NewConfigValidationError(path, errors.New("thrust_curve has to be increasing in both power and thrust"))
+		}
+	}
+	return nil
+}
+
+// powerForThrust inverts the thrust curve. thrust is a fraction of the most the curve can
+// push, and the result is the power to send to get it.
+func (mc *MotorConfig) powerForThrust(thrust float64) float64 {
+	curve := mc.ThrustCurve
+	if len(curve) < 2 {
+		return thrust
+	}
+
+	if curve[0].Power >= 0 && thrust < 0 {
+		return -1 * mc.powerForThrust(-1*thrust)
+	}
+
+	maxThrust := math.Max(math.Abs(curve[0].Thrust), math.Abs(curve[len(curve)-1].Thrust))
+	if curve[0].Power >= 0 {
+		maxThrust = math.Abs(curve[len(curve)-1].Thrust)
+	}
+	want := thrust * maxThrust
+
+	if want <= curve[0].Thrust {
+		return curve[0].Power
+	}
+	for idx := 1; idx < len(curve); idx++ {
+		prev, cur := curve[idx-1], curve[idx]
+		if want <= cur.Thrust {
+			return prev.Power + (want-prev.Thrust)/(cur.Thrust-prev.Thrust)*(cur.Power-prev.Power)
+		}
+	}
+	return curve[len(curve)-1].Power
+}
+
+func (mc *MotorConfig) reverseThrustScale() float64 {
+	if mc.ReverseThrustScale == nil {
+		return 1
+	}
+	return *mc.ReverseThrustScale
+}
+
+// effectivePower is how much of the motor's forward thrust a power actually produces
+func (mc *MotorConfig) effectivePower(p float64) float64 {
+	if p < 0 {
+		return p * mc.reverseThrustScale()
+	}
+	return p
+}
+
+func (mc *MotorConfig) minPower() float64 {
+	if mc.MinPower == nil {
+		return -1
+	}
+	return *mc.MinPower
+}
+
+func (mc *MotorConfig) maxPower() float64 {
+	if mc.MaxPower == nil {
+		return 1
+	}
+	return *mc.MaxPower
+}
+
+func (mc *MotorConfig) clampPower(p float64) float64 {
+	return math.Max(mc.minPower(), math.Min(mc.maxPower(), p))
+}
+
+// anything smaller than this is treated as 0, so rounding noise from the solver doesn't get raised to the deadband
+const zeroPower = 1e-6
+
+func (mc *MotorConfig) applyDeadband(p float64) float64 {
+	if math.Abs(p) < zeroPower {
+		return 0
+	}
+	if math.Abs(p) < mc.DeadbandPower {
+		return math.Copysign(mc.DeadbandPower, p)
+	}
+	return p
+}
+
+// applyTrim adds Trim to anything but 0, kept within min_power and max_power
+func (mc *MotorConfig) applyTrim(p float64) float64 {
+	if mc.Trim == 0 || math.Abs(p) < zeroPower {
+		return p
+	}
+	return mc.clampPower(p + mc.Trim)
+}
+
+// quantize rounds p to the nearest PowerQuantum. 0 stays 0, anything else isn't rounded below
+// the deadband, and nothing is rounded past min_power or max_power.
+func (mc *MotorConfig) quantize(p float64) float64 {
+	q := mc.PowerQuantum
+	if q <= 0 || p == 0 {
+		return p
+	}
+
+	// a little slack so a limit that's already a multiple doesn't land a step off
+	const slack = 1e-9
+
+	steps := math.Round(math.Abs(p) / q)
+	if mc.DeadbandPower > 0 && steps*q < mc.DeadbandPower {
+		steps = math.Ceil(mc.DeadbandPower/q - slack)
+	}
+
+	limit := mc.maxPower()
+	if p < 0 {
+		limit = -1 * mc.minPower()
+	}
+	if steps*q > limit {
+		steps = math.Max(0, math.Floor(limit/q+slack))
+	}
+
+	return math.Copysign(steps*q, p)
+}
+
+// motorPower converts a power in terms of thrust along AngleDegrees to what to send the motor
+func (mc *MotorConfig) motorPower(p float64) float64 {
+	if len(mc.ThrustCurve) > 0 {
+		p = mc.clampPower(mc.powerForThrust(p))
+	}
+	p = mc.quantize(mc.applyDeadband(mc.applyTrim(p)))
+	if mc.Reversed {
+		return -1 * p
+	}
+	return p
 }
 
 // percentDistanceFromCenterOfMass: if the boat is a circle with a radius of 5m,
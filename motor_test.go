@@ -79,3 +79,165 @@ func TestMotorWeights(t *testing.T) {
 		})
 	}
 }
+
+func TestMotorPowerLimits(t *testing.T) {
+	mc := MotorConfig{}
+	test.That(t, mc.Validate(""), test.ShouldBeNil)
+	test.That(t, mc.clampPower(2), test.ShouldEqual, 1)
+	test.That(t, mc.clampPower(-2), test.ShouldEqual, -1)
+
+	min, max := -.25, .5
+	mc = MotorConfig{MinPower: &min, MaxPower: &max}
+	test.That(t, mc.Validate(""), test.ShouldBeNil)
+	test.That(t, mc.clampPower(1), test.ShouldEqual, .5)
+	test.That(t, mc.clampPower(-1), test.ShouldEqual, -.25)
+	test.That(t, mc.clampPower(.1), test.ShouldEqual, .1)
+
+	mc = MotorConfig{MinPower: &max, MaxPower: &min}
+	test.That(t, mc.Validate(""), test.ShouldNotBeNil)
+
+	tooBig := 1.5
+	mc = MotorConfig{MaxPower: &tooBig}
+	test.That(t, mc.Validate(""), test.ShouldNotBeNil)
+}
+
+func TestMotorReversed(t *testing.T) {
+	mc := MotorConfig{}
+	test.That(t, mc.motorPower(.5), test.ShouldEqual, .5)
+
+	mc.Reversed = true
+	test.That(t, mc.motorPower(.5), test.ShouldEqual, -.5)
+
+	// the weights don't change, since mixing is done in thrust space
+	normal := MotorConfig{}
+	test.That(t, mc.computeWeights(10), test.ShouldResemble, normal.computeWeights(10))
+}
+
+func TestThrustCurve(t *testing.T) {
+	// a typical thruster, barely pushing at half power
+	curve := []ThrustPoint{{0, 0}, {.2, .1}, {.5, 1}, {.8, 3}, {1, 5}}
+	mc := MotorConfig{Weight: 1, ThrustCurve: curve}
+	test.That(t, mc.Validate(""), test.ShouldBeNil)
+
+	test.That(t, mc.powerForThrust(0), test.ShouldAlmostEqual, 0)
+	test.That(t, mc.powerForThrust(1), test.ShouldAlmostEqual, 1)
+	test.That(t, mc.powerForThrust(.2), test.ShouldAlmostEqual, .5)
+	test.That(t, mc.powerForThrust(.4), test.ShouldAlmostEqual, .65)
+	test.That(t, mc.powerForThrust(-.2), test.ShouldAlmostEqual, -.5)
+	test.That(t, mc.powerForThrust(2), test.ShouldAlmostEqual, 1)
+
+	thrustAt := func(p float64) float64 {
+		sign := 1.0
+		if p < 0 {
+			sign, p = -1, -p
+		}
+		for idx := 1; idx < len(curve); idx++ {
+			if p <= curve[idx].Power {
+				prev, cur := curve[idx-1], curve[idx]
+				return sign * (prev.Thrust + (p-prev.Power)/(cur.Power-prev.Power)*(cur.Thrust-prev.Thrust)) / 5
+			}
+		}
+		return sign
+	}
+
+	// asking for a thrust gets that thrust
+	for _, want := range []float64{-1, -.7, -.1, .05, .3, .5, .9} {
+		test.That(t, thrustAt(mc.motorPower(want)), test.ShouldAlmostEqual, want)
+	}
+
+	// a curve covering reverse too, where reverse is weaker
+	mc.ThrustCurve = []ThrustPoint{{-1, -2}, {0, 0}, {1, 4}}
+	test.That(t, mc.Validate(""), test.ShouldBeNil)
+	test.That(t, mc.powerForThrust(.5), test.ShouldAlmostEqual, .5)
+	test.That(t, mc.powerForThrust(-.25), test.ShouldAlmostEqual, -.5)
+	test.That(t, mc.powerForThrust(-1), test.ShouldAlmostEqual, -1)
+
+	// the motor's limits still apply to what's sent
+	max := .6
+	mc.MaxPower = &max
+	test.That(t, mc.motorPower(1), test.ShouldAlmostEqual, .6)
+
+	mc = MotorConfig{ThrustCurve: []ThrustPoint{{0, 0}}}
+	test.That(t, mc.Validate(""), test.ShouldNotBeNil)
+	mc = MotorConfig{ThrustCurve: []ThrustPoint{{0, 0}, {.5, 1}, {1, 1}}}
+	test.That(t, mc.Validate(""), test.ShouldNotBeNil)
+}
+
+func TestDeadband(t *testing.T) {
+	mc := MotorConfig{Weight: 1, DeadbandPower: .15}
+	test.That(t, mc.Validate(""), test.ShouldBeNil)
+
+	test.That(t, mc.motorPower(0), test.ShouldEqual, 0)
+	test.That(t, mc.motorPower(1e-12), test.ShouldEqual, 0)
+	test.That(t, mc.motorPower(.05), test.ShouldEqual, .15)
+	test.That(t, mc.motorPower(-.05), test.ShouldEqual, -.15)
+	test.That(t, mc.motorPower(.5), test.ShouldEqual, .5)
+
+	mc.Reversed = true
+	test.That(t, mc.motorPower(.05), test.ShouldEqual, -.15)
+
+	mc.DeadbandPower = -.1
+	test.That(t, mc.Validate(""), test.ShouldNotBeNil)
+	mc.DeadbandPower = 1
+	test.That(t, mc.Validate(""), test.ShouldNotBeNil)
+}
+
+func TestPowerQuantum(t *testing.T) {
+	mc := MotorConfig{Weight: 1, PowerQuantum: .1}
+	test.That(t, mc.Validate(""), test.ShouldBeNil)
+
+	test.That(t, mc.motorPower(0), test.ShouldEqual, 0)
+	test.That(t, mc.motorPower(.4173), test.ShouldAlmostEqual, .4, 1e-9)
+	test.That(t, mc.motorPower(.46), test.ShouldAlmostEqual, .5, 1e-9)
+	test.That(t, mc.motorPower(-.46), test.ShouldAlmostEqual, -.5, 1e-9)
+	test.That(t, mc.motorPower(.04), test.ShouldEqual, 0)
+	test.That(t, mc.motorPower(1), test.ShouldAlmostEqual, 1, 1e-9)
+
+	// never below the deadband
+	mc.DeadbandPower = .15
+	test.That(t, mc.motorPower(.01), test.ShouldAlmostEqual, .2, 1e-9)
+	test.That(t, mc.motorPower(-.16), test.ShouldAlmostEqual, -.2, 1e-9)
+	test.That(t, mc.motorPower(1e-12), test.ShouldEqual, 0)
+
+	// a deadband that's already a step isn't bumped up past it
+	mc.DeadbandPower = .3
+	test.That(t, mc.motorPower(.01), test.ShouldAlmostEqual, .3, 1e-9)
+
+	// or past the limits
+	max := .95
+	mc.MaxPower = &max
+	test.That(t, mc.motorPower(.95), test.ShouldAlmostEqual, .9, 1e-9)
+
+	mc.Reversed = true
+	test.That(t, mc.motorPower(.4173), test.ShouldAlmostEqual, -.4, 1e-9)
+
+	mc.PowerQuantum = -.1
+	test.That(t, mc.Validate(""), test.ShouldNotBeNil)
+	mc.PowerQuantum = 1
+	test.That(t, mc.Validate(""), test.ShouldNotBeNil)
+}
+
+func TestTrim(t *testing.T) {
+	mc := MotorConfig{Weight: 1, Trim: .05}
+	test.That(t, mc.Validate(""), test.ShouldBeNil)
+
+	test.That(t, mc.motorPower(0), test.ShouldEqual, 0)
+	test.That(t, mc.motorPower(.5), test.ShouldAlmostEqual, .55, 1e-9)
+	test.That(t, mc.motorPower(-.5), test.ShouldAlmostEqual, -.45, 1e-9)
+
+	// still within the limits
+	test.That(t, mc.motorPower(1), test.ShouldEqual, 1)
+	max := .5
+	mc.MaxPower = &max
+	test.That(t, mc.motorPower(.48), test.ShouldEqual, .5)
+
+	// it's along AngleDegrees, so a reversed motor gets it flipped too
+	mc.MaxPower = nil
+	mc.Reversed = true
+	test.That(t, mc.motorPower(.5), test.ShouldAlmostEqual, -.55, 1e-9)
+
+	mc.Trim = 1
+	test.That(t, mc.Validate(""), test.ShouldNotBeNil)
+	mc.Trim = -1
+	test.That(t, mc.Validate(""), test.ShouldNotBeNil)
+}
@@ -0,0 +1,103 @@
+package viamboatbase
+
+import (
+	"time"
+
+	"github.com/golang/geo/r3"
+
+	"go.viam.com/rdk/spatialmath"
+)
+
+// how many samples can be waiting for a slow observer before new ones are dropped
+const controlSampleBuffer = 100
+
+// ControlSample is what one run of the control loop saw and did
+type ControlSample struct {
+	Time         time.Time
+	Dt           time.Duration
+	ControlState string
+
+	// the readings, Estimated is true if they were dead reckoned
+	LinearVelocity  r3.Vector
+	AngularVelocity spatialmath.AngularVelocity
+	Heading         float64
+	Estimated       bool
+
+	// the goals, and what the pids were actually aiming for after acceleration limits
+	LinearGoal, AngularGoal                 r3.Vector
+	RampedLinearGoal, RampedAngularGoal     r3.Vector
+	CompassGoal                             float64
+	LinearError, AngularError, HeadingError float64
+
+	// what the pids asked for, the power each motor ended up at in config order, and how far
+	// that is from what was asked for
+	LinearPower, AngularPower r3.Vector
+	Power                     []float64
+	Residual                  float64
+	Err                       error
+}
+
+// SetControlObserver has fn called with a ControlSample after every control loop that's
+// controlling the motors, for recording tuning sessions. fn is called from its own goroutine so a
+// slow observer can't hold up the loop, and if it falls too far behind samples are dropped.
+// nil removes the observer.
+func (b *boat) SetControlObserver(fn func(ControlSample)) {
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+
+	if b.observer != nil {
+		close(b.observer)
+		b.observer = nil
+	}
+
+	if fn == nil {
+		return
+	}
+
+	samples := make(chan ControlSample, controlSampleBuffer)
+	b.observer = samples
+	go func() {
+		for s := range samples {
+			fn(s)
+		}
+	}()
+}
+
+// observe hands sample to the observer if there is one, without waiting
+func (b *boat) observe(sample ControlSample) {
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+
+	if b.observer == nil {
+		return
+	}
+
+	sample.Power = append([]float64{}, b.state.lastPower...)
+	sample.Residual = b.state.lastResidual
+	select {
+	case b.observer <- sample:
+	default:
+	}
+}
+
+// newControlSampleInLock fills in everything but the outputs from the current state
+func (b *boat) newControlSampleInLock(now time.Time, estimated bool) ControlSample {
+	s := &b.state
+	return ControlSample{
+		Time:              now,
+		Dt:                s.dt(),
+		ControlState:      s.controlState.String(),
+		LinearVelocity:    s.lastLinearVelocity,
+		AngularVelocity:   s.lastAngularVelocity,
+		Heading:           s.lastHeading,
+		Estimated:         estimated,
+		LinearGoal:        s.velocityLinearGoal,
+		AngularGoal:       s.velocityAngularGoal,
+		RampedLinearGoal:  s.rampedLinearGoal,
+		RampedAngularGoal: s.rampedAngularGoal,
+		CompassGoal:       s.compassGoal,
+		LinearError:       s.rampedLinearGoal.Y - s.lastLinearVelocity.Y,
+		AngularError:      s.rampedAngularGoal.Z - s.lastAngularVelocity.Z,
+		HeadingError:      angleDiffDeg(s.lastHeading, s.compassGoal),
+	}
+}
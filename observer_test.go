@@ -0,0 +1,87 @@
+package viamboatbase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/spatialmath"
+)
+
+func TestControlObserver(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	fs := &fakeSensor{heading: 80, linearVelocity: r3.Vector{Y: 100}, angularVelocity: spatialmath.AngularVelocity{Z: 2}}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	samples := make(chan ControlSample, 10)
+	b.SetControlObserver(func(s ControlSample) { samples <- s })
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{Z: 10}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	err = b.velocityThreadLoop(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+
+	var s ControlSample
+	select {
+	case s = <-samples:
+	case <-time.After(time.Second):
+		t.Fatal("observer didn't get a sample")
+	}
+
+	test.That(t, s.Time.IsZero(), test.ShouldBeFalse)
+	test.That(t, s.Dt, test.ShouldBeGreaterThan, 0)
+	test.That(t, s.ControlState, test.ShouldEqual, "velocity")
+	test.That(t, s.Estimated, test.ShouldBeFalse)
+	test.That(t, s.LinearVelocity, test.ShouldResemble, r3.Vector{Y: 100})
+	test.That(t, s.AngularVelocity.Z, test.ShouldEqual, 2)
+	test.That(t, s.Heading, test.ShouldEqual, 80)
+	test.That(t, s.LinearGoal, test.ShouldResemble, r3.Vector{Y: 500})
+	test.That(t, s.AngularGoal, test.ShouldResemble, r3.Vector{Z: 10})
+	test.That(t, s.LinearError, test.ShouldEqual, 400)
+	test.That(t, s.AngularError, test.ShouldEqual, 8)
+	test.That(t, s.LinearPower.Y, test.ShouldBeGreaterThan, 0)
+	test.That(t, s.Power, test.ShouldResemble, b.snapshotState().lastPower)
+	test.That(t, s.Err, test.ShouldBeNil)
+
+	// nothing while we're not controlling the motors
+	err = b.Stop(context.Background(), nil)
+	test.That(t, err, test.ShouldBeNil)
+	err = b.velocityThreadLoop(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	select {
+	case s = <-samples:
+		t.Fatalf("unexpected sample: %v", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestControlObserverDoesntBlock(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	b.movementSensor = (&fakeSensor{}).movementSensor()
+	defer b.Close(context.Background())
+
+	// an observer that never returns
+	stuck := make(chan struct{})
+	defer close(stuck)
+	b.SetControlObserver(func(s ControlSample) { <-stuck })
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	start := time.Now()
+	for i := 0; i < 2*controlSampleBuffer; i++ {
+		err = b.velocityThreadLoop(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+	}
+	test.That(t, time.Since(start), test.ShouldBeLessThan, 5*time.Second)
+}
@@ -0,0 +1,96 @@
+package viamboatbase
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/golang/geo/r3"
+
+	"go.viam.com/utils"
+)
+
+// full power speeds used for open loop control when nothing else is configured
+const (
+	defaultOpenLoopLinearMMPerSec   = 1000
+	defaultOpenLoopAngularDegPerSec = 90
+)
+
+// openLoopSpeeds are how fast the boat is assumed to go and turn at full power
+func (cfg *Config) openLoopSpeeds() (linear, angular float64) {
+	linear, angular = cfg.OpenLoopLinearMMPerSec, cfg.OpenLoopAngularDegPerSec
+	if linear <= 0 {
+		linear = cfg.MaxLinearVelocityMMPerSec
+	}
+	if linear <= 0 {
+		linear = defaultOpenLoopLinearMMPerSec
+	}
+	if angular <= 0 {
+		angular = cfg.MaxAngularVelocityDegPerSec
+	}
+	if angular <= 0 {
+		angular = defaultOpenLoopAngularDegPerSec
+	}
+	return linear, angular
+}
+
+// openLoopPower is the SetPower input for a velocity, as a fraction of the full power speeds.
+// SetPower is already a fraction of maxWeights on each axis, so this is all the mapping there is.
+func (cfg *Config) openLoopPower(linear, angular r3.Vector) (r3.Vector, r3.Vector) {
+	fullLinear, fullAngular := cfg.openLoopSpeeds()
+	clamp := func(f float64) float64 {
+		return math.Max(-1, math.Min(1, f))
+	}
+	return r3.Vector{X: clamp(linear.X / fullLinear), Y: clamp(linear.Y / fullLinear)},
+		r3.Vector{Z: clamp(angular.Z / fullAngular)}
+}
+
+// openLoop is true if there are no sensors to close the loop with, so velocities are mapped
+// straight to power
+func (b *boat) openLoop() bool {
+	return b.headingSource() == nil && b.angularVelocitySource() == nil && b.linearVelocitySource() == nil
+}
+
+func (b *boat) setVelocityOpenLoop(ctx context.Context, linear, angular r3.Vector) error {
+	lp, ap := b.cfg.openLoopPower(linear, angular)
+	b.logger.Debugf("SetVelocity open loop %v %v -> power %v %v", linear, angular, lp, ap)
+
+	ctx, done := b.opMgr.New(ctx)
+	defer done()
+
+	b.stateMutex.Lock()
+	b.setControlStateInLock(controlNone)
+	b.stateMutex.Unlock()
+
+	return b.setPowerInternal(ctx, lp, ap, true)
+}
+
+// spinOpenLoop turns at degsPerSec for as long as it should take to turn angleDeg, then stops
+func (b *boat) spinOpenLoop(ctx context.Context, angleDeg, degsPerSec float64) error {
+	if angleDeg == 0 || degsPerSec == 0 {
+		return b.Stop(ctx, nil)
+	}
+
+	// a positive angle is clockwise, which is negative angular z
+	_, ap := b.cfg.openLoopPower(r3.Vector{}, r3.Vector{Z: -math.Copysign(degsPerSec, angleDeg)})
+	duration := time.Duration(math.Abs(angleDeg/degsPerSec) * float64(time.Second))
+	b.logger.Infof("Spin open loop angleDeg: %v degsPerSec: %v for %v", angleDeg, degsPerSec, duration)
+
+	opCtx, done := b.opMgr.New(ctx)
+	defer done()
+
+	b.stateMutex.Lock()
+	b.setControlStateInLock(controlNone)
+	b.stateMutex.Unlock()
+
+	err := b.setPowerInternal(opCtx, r3.Vector{}, ap, true)
+	if err != nil {
+		return err
+	}
+
+	// if something else took over, leave the motors to it
+	if !utils.SelectContextOrWait(opCtx, duration) {
+		return opCtx.Err()
+	}
+	return b.Stop(ctx, nil)
+}
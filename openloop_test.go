@@ -0,0 +1,79 @@
+package viamboatbase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+)
+
+func TestSetVelocityOpenLoop(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	defer b.Close(context.Background())
+
+	// half the default full power speed is half power
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	powers := fm.get()
+	test.That(t, powers[0], test.ShouldAlmostEqual, .5, testTheta)
+	test.That(t, powers[1], test.ShouldAlmostEqual, .5, testTheta)
+	test.That(t, b.snapshotState().threadStarted, test.ShouldBeFalse)
+
+	// turning the same way closed loop would, negative z makes the starboard motor stronger
+	err = b.SetVelocity(context.Background(), r3.Vector{}, r3.Vector{Z: -45}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	powers = fm.get()
+	test.That(t, powers[1], test.ShouldBeGreaterThan, 0)
+	test.That(t, powers[0], test.ShouldAlmostEqual, -powers[1], testTheta)
+
+	// faster than full power is just full power
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 5000}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fm.get()[0], test.ShouldAlmostEqual, 1, testTheta)
+
+	// there's no heading to hold
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, map[string]interface{}{"hold_heading": 90.0})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestOpenLoopSpeeds(t *testing.T) {
+	cfg := &Config{}
+	l, a := cfg.openLoopSpeeds()
+	test.That(t, l, test.ShouldEqual, defaultOpenLoopLinearMMPerSec)
+	test.That(t, a, test.ShouldEqual, defaultOpenLoopAngularDegPerSec)
+
+	cfg.MaxLinearVelocityMMPerSec = 2000
+	cfg.MaxAngularVelocityDegPerSec = 30
+	lp, ap := cfg.openLoopPower(r3.Vector{Y: 1000}, r3.Vector{Z: -15})
+	test.That(t, lp, test.ShouldResemble, r3.Vector{Y: .5})
+	test.That(t, ap, test.ShouldResemble, r3.Vector{Z: -.5})
+
+	cfg.OpenLoopLinearMMPerSec = 4000
+	cfg.OpenLoopAngularDegPerSec = 60
+	lp, ap = cfg.openLoopPower(r3.Vector{Y: 1000}, r3.Vector{Z: -15})
+	test.That(t, lp, test.ShouldResemble, r3.Vector{Y: .25})
+	test.That(t, ap, test.ShouldResemble, r3.Vector{Z: -.25})
+}
+
+func TestSpinOpenLoop(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	defer b.Close(context.Background())
+
+	start := time.Now()
+	err := b.Spin(context.Background(), 9, 90, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, time.Since(start), test.ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+
+	// turned clockwise at full default speed, then stopped
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	test.That(t, fm.history[0][0], test.ShouldAlmostEqual, -1, testTheta)
+	test.That(t, fm.history[1][0], test.ShouldAlmostEqual, 1, testTheta)
+}
@@ -1,20 +1,143 @@
 package viamboatbase
 
 import (
+	"errors"
+	"math"
 	"time"
+
+	"go.viam.com/utils"
+)
+
+// which terms a pid uses, by Mode. the gains for the others are kept but not used.
+const (
+	pidModePID = "pid"
+	pidModePI  = "pi"
+	pidModePD  = "pd"
+	pidModeP   = "p"
 )
 
+// PIDConfig overrides the default gains for one of the boat's pid loops.
+// Any field left out keeps its default.
+type PIDConfig struct {
+	P         *float64 `json:"p,omitempty"`
+	I         *float64 `json:"i,omitempty"`
+	D         *float64 `json:"d,omitempty"`
+	FF        *float64 `json:"ff,omitempty"`
+	MinOutput *float64 `json:"min_output,omitempty"`
+	MaxOutput *float64 `json:"max_output,omitempty"`
+
+	// bounds on the accumulated integral and on the derivative term, independent of the output limits
+	MaxIntegral   *float64 `json:"max_integral,omitempty"`
+	MaxDerivative *float64 `json:"max_derivative,omitempty"`
+
+	DerivativeOnMeasurement bool `json:"derivative_on_measurement,omitempty"`
+
+	// time constant of the low pass filter on the derivative term, 0 means no filtering
+	DerivativeFilterTauSec *float64 `json:"derivative_filter_tau_sec,omitempty"`
+
+	// Mode turns off terms without losing their gains, one of pid, pi, pd or p. default pid.
+	Mode string `json:"mode,omitempty"`
+}
+
+func (cfg *PIDConfig) Validate(path string) error {
+	if cfg == nil {
+		return nil
+	}
+
+	for _, g := range []*float64{cfg.P, cfg.I, cfg.D, cfg.FF, cfg.MaxIntegral, cfg.MaxDerivative, cfg.DerivativeFilterTauSec} {
+		if g != nil && *g < 0 {
+			return utils.NewConfigValidationError(path, errors.New("pid gains cannot be negative"))
+		}
+	}
+
+	// an output limit of 0 is no limit, like the heading pid's
+	if cfg.MinOutput != nil && cfg.MaxOutput != nil && *cfg.MinOutput != 0 && *cfg.MaxOutput != 0 &&
+		*cfg.MinOutput >= *cfg.MaxOutput {
+		return utils.NewConfigValidationError(path, errors.New("min_output has to be less than max_output"))
+	}
+
+	switch cfg.Mode {
+	case "", pidModePID, pidModePI, pidModePD, pidModeP:
+	default:
+		return utils.NewConfigValidationError(path, errors.New("mode has to be pid, pi, pd or p"))
+	}
+
+	return nil
+}
+
+// withOverrides is cfg with anything set in over replacing it. derivative_on_measurement can
+// only be turned on this way, since false and left out look the same.
+func (cfg *PIDConfig) withOverrides(over *PIDConfig) *PIDConfig {
+	var res PIDConfig
+	if cfg != nil {
+		res = *cfg
+	}
+	if over == nil {
+		return &res
+	}
+
+	set := func(dest **float64, v *float64) {
+		if v != nil {
+			*dest = v
+		}
+	}
+	set(&res.P, over.P)
+	set(&res.I, over.I)
+	set(&res.D, over.D)
+	set(&res.FF, over.FF)
+	set(&res.MinOutput, over.MinOutput)
+	set(&res.MaxOutput, over.MaxOutput)
+	set(&res.MaxIntegral, over.MaxIntegral)
+	set(&res.MaxDerivative, over.MaxDerivative)
+	set(&res.DerivativeFilterTauSec, over.DerivativeFilterTauSec)
+	res.DerivativeOnMeasurement = res.DerivativeOnMeasurement || over.DerivativeOnMeasurement
+	if over.Mode != "" {
+		res.Mode = over.Mode
+	}
+	return &res
+}
+
 type pidState struct {
 	// config
 	proportionalGain float64
 	integralGain     float64
 	derivativeGain   float64
 
+	// added as feedForwardGain * target, for when the target maps roughly linearly to output
+	feedForwardGain float64
+
 	minOutput, maxOutput float64
 
+	// if non-zero, the integral is kept in [-maxIntegral, maxIntegral]
+	maxIntegral float64
+
+	// if non-zero, the derivative term is kept in [-maxDerivative, maxDerivative] before it's
+	// filtered and added in, so a noisy reading can't kick the output
+	maxDerivative float64
+
+	// compute the derivative from the measurement rather than the error,
+	// so a change in target doesn't cause a spike
+	derivativeOnMeasurement bool
+
+	// if non-zero, the derivative term is passed through a first order low pass filter with this time constant
+	derivativeFilterTau time.Duration
+
+	// terms left out by the mode. without the integral it doesn't accumulate either, so turning it
+	// back on doesn't start out wound up.
+	noIntegral, noDerivative bool
+
 	// state
-	integral      float64
-	previousError float64
+	integral            float64
+	previousError       float64
+	previousMeasurement float64
+	filteredDerivative  float64
+
+	// whether the last output was clamped to minOutput or maxOutput
+	saturated bool
+
+	// the last output, and whether the next Control should pick up from it, see Transfer
+	output       float64
+	transferring bool
 }
 
 func (pid *pidState) setDefaults() {
@@ -24,28 +147,193 @@ func (pid *pidState) setDefaults() {
 
 	pid.minOutput = -1
 	pid.maxOutput = 1
+
+	pid.noIntegral = false
+	pid.noDerivative = false
+}
+
+// configure sets the defaults, and then overrides anything specified in cfg
+func (pid *pidState) configure(cfg *PIDConfig) {
+	pid.setDefaults()
+	if cfg == nil {
+		return
+	}
+
+	if cfg.P != nil {
+		pid.proportionalGain = *cfg.P
+	}
+	if cfg.I != nil {
+		pid.integralGain = *cfg.I
+	}
+	if cfg.D != nil {
+		pid.derivativeGain = *cfg.D
+	}
+	if cfg.FF != nil {
+		pid.feedForwardGain = *cfg.FF
+	}
+	if cfg.MinOutput != nil {
+		pid.minOutput = *cfg.MinOutput
+	}
+	if cfg.MaxOutput != nil {
+		pid.maxOutput = *cfg.MaxOutput
+	}
+	if cfg.MaxIntegral != nil {
+		pid.maxIntegral = *cfg.MaxIntegral
+	}
+	if cfg.MaxDerivative != nil {
+		pid.maxDerivative = *cfg.MaxDerivative
+	}
+	pid.derivativeOnMeasurement = cfg.DerivativeOnMeasurement
+	if cfg.DerivativeFilterTauSec != nil {
+		pid.derivativeFilterTau = time.Duration(*cfg.DerivativeFilterTauSec * float64(time.Second))
+	}
+	pid.noIntegral = cfg.Mode == pidModePD || cfg.Mode == pidModeP
+	pid.noDerivative = cfg.Mode == pidModePI || cfg.Mode == pidModeP
+}
+
+// mode is the Mode for the terms that are on
+func (pid *pidState) mode() string {
+	switch {
+	case pid.noIntegral && pid.noDerivative:
+		return pidModeP
+	case pid.noIntegral:
+		return pidModePD
+	case pid.noDerivative:
+		return pidModePI
+	default:
+		return pidModePID
+	}
+}
+
+// config is the current gains and limits, such that configure(config()) changes nothing
+func (pid *pidState) config() *PIDConfig {
+	f := func(v float64) *float64 { return &v }
+	return &PIDConfig{
+		P:                       f(pid.proportionalGain),
+		I:                       f(pid.integralGain),
+		D:                       f(pid.derivativeGain),
+		FF:                      f(pid.feedForwardGain),
+		MinOutput:               f(pid.minOutput),
+		MaxOutput:               f(pid.maxOutput),
+		MaxIntegral:             f(pid.maxIntegral),
+		MaxDerivative:           f(pid.maxDerivative),
+		DerivativeOnMeasurement: pid.derivativeOnMeasurement,
+		DerivativeFilterTauSec:  f(pid.derivativeFilterTau.Seconds()),
+		Mode:                    pid.mode(),
+	}
+}
+
+// Reset clears the accumulated state, but keeps the config
+func (pid *pidState) Reset() {
+	pid.integral = 0
+	pid.previousError = 0
+	pid.previousMeasurement = 0
+	pid.filteredDerivative = 0
+	pid.saturated = false
+	pid.output = 0
+	pid.transferring = false
+}
+
+// Transfer is Reset for when the goal changes out from under a running loop. the next Control
+// sets the integral to whatever makes its output the same as the last one, and the derivative
+// starts from there, so the output doesn't jump. without an integral it's just Reset.
+func (pid *pidState) Transfer() {
+	output := pid.output
+	pid.Reset()
+	pid.output = output
+	pid.transferring = true
 }
 
 func (pid *pidState) Control(target, current float64, timeSinceLastCall time.Duration) float64 {
+	n, _, _, _ := pid.ControlDebug(target, current, timeSinceLastCall)
+	return n
+}
 
+// Saturated is whether the last Control had to clamp its output, so it's asking for all it can get
+func (pid *pidState) Saturated() bool {
+	return pid.saturated
+}
+
+// ControlDebug is Control, but also returns each term's contribution to the (clamped) output
+func (pid *pidState) ControlDebug(target, current float64, timeSinceLastCall time.Duration) (output, p, i, d float64) {
 	error := target - current
 
-	p := pid.proportionalGain * error
+	p = pid.proportionalGain * error
+	ff := pid.feedForwardGain * target
+
+	if timeSinceLastCall <= 0 {
+		// no time has passed, so there is nothing to integrate or differentiate
+		n := pid.clampOutput(p + ff)
+		pid.saturated = n != p+ff
+		if !pid.transferring {
+			pid.output = n
+		}
+		return n, p, 0, 0
+	}
+
+	if pid.transferring {
+		pid.transferring = false
+		pid.previousError = error
+		pid.previousMeasurement = current
+		if !pid.noIntegral && pid.integralGain != 0 {
+			// less this step's, which is added below
+			pid.integral = (pid.output-p-ff)/pid.integralGain - error*timeSinceLastCall.Seconds()
+		}
+	}
 
-	pid.integral += error * timeSinceLastCall.Seconds()
-	i := pid.integralGain * pid.integral
+	previousIntegral := pid.integral
+	if pid.noIntegral {
+		pid.integral = 0
+	} else {
+		pid.integral += error * timeSinceLastCall.Seconds()
+	}
+	if pid.maxIntegral != 0 {
+		pid.integral = math.Max(-pid.maxIntegral, math.Min(pid.maxIntegral, pid.integral))
+	}
+	i = pid.integralGain * pid.integral
 
-	d := pid.derivativeGain * (error - pid.previousError) / timeSinceLastCall.Seconds()
+	if pid.derivativeOnMeasurement {
+		d = -1 * pid.derivativeGain * (current - pid.previousMeasurement) / timeSinceLastCall.Seconds()
+	} else {
+		d = pid.derivativeGain * (error - pid.previousError) / timeSinceLastCall.Seconds()
+	}
+	if pid.maxDerivative != 0 {
+		d = math.Max(-pid.maxDerivative, math.Min(pid.maxDerivative, d))
+	}
 	pid.previousError = error
+	pid.previousMeasurement = current
+
+	if pid.derivativeFilterTau > 0 {
+		alpha := timeSinceLastCall.Seconds() / (pid.derivativeFilterTau.Seconds() + timeSinceLastCall.Seconds())
+		pid.filteredDerivative += alpha * (d - pid.filteredDerivative)
+		d = pid.filteredDerivative
+	}
+	if pid.noDerivative {
+		d = 0
+	}
 
-	n := p + i + d
+	raw := p + i + d + ff
+	n := pid.clampOutput(raw)
+	pid.saturated = n != raw
+
+	// anti-windup: when we're saturated, don't let the integral keep growing in the direction we're stuck
+	if n > raw && error < 0 {
+		pid.integral = math.Max(pid.integral, previousIntegral)
+	} else if n < raw && error > 0 {
+		pid.integral = math.Min(pid.integral, previousIntegral)
+	}
+
+	pid.output = n
+	return n, p, i, d
+}
 
+func (pid *pidState) clampOutput(n float64) float64 {
 	if pid.minOutput != 0 && n < pid.minOutput {
-		n = pid.minOutput
+		return pid.minOutput
 	}
 
 	if pid.maxOutput != 0 && n > pid.maxOutput {
-		n = pid.maxOutput
+		return pid.maxOutput
 	}
 
 	return n
@@ -1,6 +1,7 @@
 package viamboatbase
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -27,3 +28,394 @@ func TestPID1(t *testing.T) {
 	}
 
 }
+
+func TestPIDConfigure(t *testing.T) {
+	pid := pidState{}
+	pid.configure(nil)
+	test.That(t, pid.proportionalGain, test.ShouldEqual, .08)
+	test.That(t, pid.maxOutput, test.ShouldEqual, 1)
+
+	p := .5
+	max := .75
+	pid.configure(&PIDConfig{P: &p, MaxOutput: &max})
+	test.That(t, pid.proportionalGain, test.ShouldEqual, .5)
+	test.That(t, pid.integralGain, test.ShouldEqual, .075)
+	test.That(t, pid.minOutput, test.ShouldEqual, -1)
+	test.That(t, pid.maxOutput, test.ShouldEqual, .75)
+}
+
+func TestPIDConfigValidate(t *testing.T) {
+	var cfg *PIDConfig
+	test.That(t, cfg.Validate("x"), test.ShouldBeNil)
+
+	bad := -.1
+	cfg = &PIDConfig{I: &bad}
+	test.That(t, cfg.Validate("x"), test.ShouldNotBeNil)
+
+	min, max := .5, -.5
+	cfg = &PIDConfig{MinOutput: &min, MaxOutput: &max}
+	test.That(t, cfg.Validate("x"), test.ShouldNotBeNil)
+
+	// both 0 is no limit at all
+	none := 0.0
+	cfg = &PIDConfig{MinOutput: &none, MaxOutput: &none}
+	test.That(t, cfg.Validate("x"), test.ShouldBeNil)
+
+	good := .1
+	cfg = &PIDConfig{P: &good, I: &good, D: &good}
+	test.That(t, cfg.Validate("x"), test.ShouldBeNil)
+}
+
+func TestPIDAntiWindup(t *testing.T) {
+	pid := pidState{}
+	pid.setDefaults()
+	pid.maxIntegral = 20
+
+	dt := time.Millisecond * 100
+
+	// the plant tops out at 10, so a goal of 20 keeps us saturated the whole time
+	currentSpeed := 0.0
+	for i := 0; i < 1000; i++ {
+		motorPower := pid.Control(20, currentSpeed, dt)
+		currentSpeed = motorPower * 10
+		test.That(t, pid.integral, test.ShouldBeBetweenOrEqual, -pid.maxIntegral, pid.maxIntegral)
+	}
+	test.That(t, currentSpeed, test.ShouldAlmostEqual, 10)
+
+	// now drop to something we can reach, a wound up integral would keep us pinned at full power
+	targetSpeed := 5.0
+	maxSpeed := 0.0
+	for i := 0; i < 1000; i++ {
+		motorPower := pid.Control(targetSpeed, currentSpeed, dt)
+		currentSpeed = motorPower * 10
+		maxSpeed = math.Max(maxSpeed, currentSpeed)
+	}
+	test.That(t, currentSpeed, test.ShouldAlmostEqual, targetSpeed, .01)
+	test.That(t, maxSpeed-targetSpeed, test.ShouldBeLessThan, 4)
+}
+
+func TestPIDSaturated(t *testing.T) {
+	pid := pidState{}
+	pid.setDefaults()
+
+	dt := time.Millisecond * 100
+
+	// way short of the goal, so it's asking for everything
+	test.That(t, pid.Control(100, 0, dt), test.ShouldEqual, 1)
+	test.That(t, pid.Saturated(), test.ShouldBeTrue)
+	test.That(t, pid.Control(-100, 0, dt), test.ShouldEqual, -1)
+	test.That(t, pid.Saturated(), test.ShouldBeTrue)
+	test.That(t, pid.Control(100, 0, 0), test.ShouldEqual, 1)
+	test.That(t, pid.Saturated(), test.ShouldBeTrue)
+
+	pid.Reset()
+	test.That(t, pid.Saturated(), test.ShouldBeFalse)
+
+	// and a small error isn't
+	pid.Control(1, 0, dt)
+	test.That(t, pid.Saturated(), test.ShouldBeFalse)
+}
+
+func TestPIDReset(t *testing.T) {
+	pid := pidState{}
+	pid.setDefaults()
+
+	dt := time.Millisecond * 100
+
+	currentSpeed := 0.0
+	for i := 0; i < 1000; i++ {
+		currentSpeed = pid.Control(5, currentSpeed, dt) * 10
+	}
+	test.That(t, pid.integral, test.ShouldNotEqual, 0)
+	// leave it with an error for the derivative to carry over
+	pid.Control(10, currentSpeed, dt)
+
+	pid.Reset()
+	test.That(t, pid.integral, test.ShouldEqual, 0)
+	test.That(t, pid.previousError, test.ShouldEqual, 0)
+	test.That(t, pid.proportionalGain, test.ShouldEqual, .08)
+
+	// nothing left over: the integral is just this step's and the derivative starts from 0 error
+	_, p, i, d := pid.ControlDebug(2, 0, dt)
+	test.That(t, p, test.ShouldAlmostEqual, pid.proportionalGain*2)
+	test.That(t, i, test.ShouldAlmostEqual, pid.integralGain*2*dt.Seconds())
+	test.That(t, d, test.ShouldAlmostEqual, pid.derivativeGain*2/dt.Seconds())
+
+	// and with no time passed there's only the proportional term
+	pid.Reset()
+	_, p, i, d = pid.ControlDebug(2, 0, 0)
+	test.That(t, p, test.ShouldAlmostEqual, pid.proportionalGain*2)
+	test.That(t, i, test.ShouldEqual, 0)
+	test.That(t, d, test.ShouldEqual, 0)
+	test.That(t, pid.integral, test.ShouldEqual, 0)
+}
+
+func TestPIDDerivativeOnMeasurement(t *testing.T) {
+	dt := time.Millisecond * 100
+
+	stepResponse := func(onMeasurement bool) float64 {
+		pid := pidState{}
+		pid.setDefaults()
+		pid.derivativeGain = .01
+		pid.maxOutput = 100
+		pid.minOutput = -100
+		pid.derivativeOnMeasurement = onMeasurement
+
+		for i := 0; i < 10; i++ {
+			pid.Control(0, 0, dt)
+		}
+		return pid.Control(10, 0, dt)
+	}
+
+	// p = .8, i = .075, d = .01 * 10 / .1 = 1
+	test.That(t, stepResponse(false), test.ShouldAlmostEqual, 1.875)
+	test.That(t, stepResponse(true), test.ShouldAlmostEqual, .875)
+
+	// when the measurement moves, derivative opposes the motion
+	pid := pidState{}
+	pid.setDefaults()
+	pid.derivativeOnMeasurement = true
+	pid.Control(0, 0, dt)
+	pid.Control(0, 1, dt)
+	test.That(t, pid.previousMeasurement, test.ShouldEqual, 1)
+
+	pid.Reset()
+	test.That(t, pid.previousMeasurement, test.ShouldEqual, 0)
+}
+
+func TestPIDZeroDt(t *testing.T) {
+	pid := pidState{}
+	pid.setDefaults()
+
+	for _, dt := range []time.Duration{0, -1 * time.Millisecond} {
+		n := pid.Control(5, 0, dt)
+		test.That(t, math.IsNaN(n), test.ShouldBeFalse)
+		test.That(t, math.IsInf(n, 0), test.ShouldBeFalse)
+		test.That(t, n, test.ShouldAlmostEqual, .4)
+		test.That(t, pid.integral, test.ShouldEqual, 0)
+		test.That(t, pid.previousError, test.ShouldEqual, 0)
+	}
+}
+
+func TestPIDDerivativeFilter(t *testing.T) {
+	dt := time.Millisecond * 100
+
+	outputVariance := func(tau time.Duration) float64 {
+		pid := pidState{}
+		pid.setDefaults()
+		pid.integralGain = 0
+		pid.derivativeGain = .05
+		pid.derivativeFilterTau = tau
+
+		var outputs []float64
+		for i := 0; i < 200; i++ {
+			noise := .5
+			if i%2 == 0 {
+				noise = -.5
+			}
+			outputs = append(outputs, pid.Control(5, 5+noise, dt))
+		}
+
+		mean := 0.0
+		for _, o := range outputs {
+			mean += o
+		}
+		mean /= float64(len(outputs))
+
+		v := 0.0
+		for _, o := range outputs {
+			v += math.Pow(o-mean, 2)
+		}
+		return v / float64(len(outputs))
+	}
+
+	unfiltered := outputVariance(0)
+	filtered := outputVariance(time.Second)
+	test.That(t, filtered, test.ShouldBeLessThan, unfiltered/2)
+}
+
+func TestPIDFeedForward(t *testing.T) {
+	dt := time.Millisecond * 100
+
+	iterationsToConverge := func(ff float64) int {
+		targetSpeed := 5.0
+		currentSpeed := 0.0
+
+		pid := pidState{}
+		pid.setDefaults()
+		pid.feedForwardGain = ff
+
+		for i := 0; i < 1000; i++ {
+			currentSpeed = pid.Control(targetSpeed, currentSpeed, dt) * 10
+			if math.Abs(currentSpeed-targetSpeed) < .01 {
+				return i
+			}
+		}
+		return 1000
+	}
+
+	without := iterationsToConverge(0)
+	with := iterationsToConverge(.1)
+	test.That(t, without, test.ShouldBeLessThan, 1000)
+	test.That(t, with, test.ShouldBeLessThan, without/2)
+}
+
+func TestPIDControlDebug(t *testing.T) {
+	pid := pidState{}
+	pid.setDefaults()
+
+	dt := time.Millisecond * 100
+
+	n, p, i, d := pid.ControlDebug(5, 0, dt)
+	test.That(t, p, test.ShouldAlmostEqual, .4)
+	test.That(t, i, test.ShouldAlmostEqual, .0375)
+	test.That(t, d, test.ShouldAlmostEqual, .005)
+	test.That(t, n, test.ShouldAlmostEqual, p+i+d)
+
+	// output is clamped, but the terms are not
+	pid.Reset()
+	n, p, _, _ = pid.ControlDebug(50, 0, dt)
+	test.That(t, n, test.ShouldEqual, 1)
+	test.That(t, p, test.ShouldAlmostEqual, 4)
+}
+
+func TestPIDIntegralAndDerivativeClamps(t *testing.T) {
+	dt := time.Millisecond * 100
+
+	// a big step makes a big derivative, but with a small steady error the integral stays small
+	derivative := pidState{}
+	derivative.setDefaults()
+	derivative.derivativeGain = 1
+	derivative.maxDerivative = .5
+	derivative.minOutput, derivative.maxOutput = -100, 100
+
+	_, _, i, d := derivative.ControlDebug(10, 0, dt)
+	test.That(t, d, test.ShouldEqual, .5)
+	test.That(t, derivative.integral, test.ShouldAlmostEqual, 1)
+	test.That(t, i, test.ShouldAlmostEqual, .075)
+
+	// the other way too
+	_, _, _, d = derivative.ControlDebug(-10, 0, dt)
+	test.That(t, d, test.ShouldEqual, -.5)
+
+	// a steady error winds up the integral, but the derivative is ~0 so nothing else is clamped
+	integral := pidState{}
+	integral.setDefaults()
+	integral.maxIntegral = 2
+	integral.maxDerivative = .5
+	integral.minOutput, integral.maxOutput = -100, 100
+	var n, p float64
+	for k := 0; k < 100; k++ {
+		n, p, i, d = integral.ControlDebug(5, 0, dt)
+	}
+	test.That(t, integral.integral, test.ShouldEqual, 2)
+	test.That(t, d, test.ShouldAlmostEqual, 0)
+	test.That(t, n, test.ShouldAlmostEqual, p+i+d)
+
+	// neither set means neither clamped
+	unbounded := pidState{}
+	unbounded.setDefaults()
+	unbounded.derivativeGain = 1
+	unbounded.minOutput, unbounded.maxOutput = -1000, 1000
+	_, _, _, d = unbounded.ControlDebug(10, 0, dt)
+	test.That(t, d, test.ShouldAlmostEqual, 100)
+	for k := 0; k < 100; k++ {
+		unbounded.ControlDebug(5, 5, dt)
+	}
+	test.That(t, unbounded.integral, test.ShouldAlmostEqual, 1)
+
+	// and it makes it through configure
+	max := .25
+	configured := pidState{}
+	configured.configure(&PIDConfig{MaxDerivative: &max})
+	test.That(t, configured.maxDerivative, test.ShouldEqual, .25)
+	test.That(t, *configured.config().MaxDerivative, test.ShouldEqual, .25)
+
+	neg := -1.0
+	test.That(t, (&PIDConfig{MaxDerivative: &neg}).Validate("x"), test.ShouldNotBeNil)
+}
+
+func TestPIDModes(t *testing.T) {
+	dt := time.Millisecond * 100
+
+	for _, tc := range []struct {
+		mode                 string
+		integral, derivative bool
+	}{
+		{"", true, true},
+		{"pid", true, true},
+		{"pi", true, false},
+		{"pd", false, true},
+		{"p", false, false},
+	} {
+		tc := tc
+		t.Run(tc.mode, func(t *testing.T) {
+			pid := pidState{}
+			pid.configure(&PIDConfig{Mode: tc.mode})
+			test.That(t, (&PIDConfig{Mode: tc.mode}).Validate("x"), test.ShouldBeNil)
+
+			// a goal it can't reach, so a running integral would keep growing
+			for k := 0; k < 10; k++ {
+				n, p, i, d := pid.ControlDebug(5, float64(k)/10, dt)
+				test.That(t, p, test.ShouldBeGreaterThan, 0)
+				test.That(t, i != 0, test.ShouldEqual, tc.integral)
+				test.That(t, d != 0, test.ShouldEqual, tc.derivative)
+				test.That(t, n, test.ShouldAlmostEqual, p+i+d)
+			}
+			test.That(t, pid.integral != 0, test.ShouldEqual, tc.integral)
+
+			// the gains are still there for when the terms come back
+			test.That(t, pid.integralGain, test.ShouldEqual, .075)
+			test.That(t, pid.derivativeGain, test.ShouldEqual, .0001)
+
+			var other pidState
+			other.configure(pid.config())
+			test.That(t, other.config(), test.ShouldResemble, pid.config())
+
+			// and turning the integral back on starts it from nothing
+			pid.configure(nil)
+			_, _, i, _ := pid.ControlDebug(5, 0, dt)
+			if tc.integral {
+				test.That(t, i, test.ShouldBeGreaterThan, .075*5*dt.Seconds())
+			} else {
+				test.That(t, i, test.ShouldAlmostEqual, .075*5*dt.Seconds())
+			}
+		})
+	}
+
+	test.That(t, (&PIDConfig{Mode: "id"}).Validate("x"), test.ShouldNotBeNil)
+}
+
+func TestPIDTransfer(t *testing.T) {
+	dt := time.Millisecond * 100
+
+	pid := pidState{}
+	pid.setDefaults()
+	currentSpeed := 0.0
+	for i := 0; i < 100; i++ {
+		currentSpeed = pid.Control(5, currentSpeed, dt) * 10
+	}
+	before := pid.Control(5, currentSpeed, dt)
+
+	// a new goal picks up from the same output, and goes on from there
+	pid.Transfer()
+	n, p, i, d := pid.ControlDebug(3, currentSpeed, dt)
+	test.That(t, n, test.ShouldAlmostEqual, before)
+	test.That(t, p, test.ShouldBeLessThan, 0)
+	test.That(t, i, test.ShouldAlmostEqual, before-p)
+	test.That(t, d, test.ShouldEqual, 0)
+	test.That(t, pid.Control(3, currentSpeed, dt), test.ShouldBeLessThan, before)
+
+	for i := 0; i < 1000; i++ {
+		currentSpeed = pid.Control(3, currentSpeed, dt) * 10
+	}
+	test.That(t, currentSpeed, test.ShouldAlmostEqual, 3, .01)
+
+	// and with no integral there's nothing to carry it
+	pd := pidState{}
+	pd.configure(&PIDConfig{Mode: pidModePD})
+	pd.Control(5, 0, dt)
+	pd.Transfer()
+	_, _, i, _ = pd.ControlDebug(5, 0, dt)
+	test.That(t, i, test.ShouldEqual, 0)
+}
@@ -0,0 +1,106 @@
+package viamboatbase
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+)
+
+// default top speed when correcting position if there's no max linear velocity configured
+const defaultHoldPositionMMPerSec = 1000
+
+// configurePositionPID sets up one of the position pids, its output is a velocity goal in mm/s
+func configurePositionPID(pid *pidState, cfg *Config) {
+	pid.configure(cfg.PositionPID)
+
+	if cfg.PositionPID == nil || cfg.PositionPID.P == nil {
+		pid.proportionalGain = .5
+	}
+	if cfg.PositionPID == nil || cfg.PositionPID.I == nil {
+		pid.integralGain = .01
+	}
+	if cfg.PositionPID == nil || cfg.PositionPID.D == nil {
+		pid.derivativeGain = 0
+	}
+
+	maxSpeed := cfg.MaxLinearVelocityMMPerSec
+	if maxSpeed <= 0 {
+		maxSpeed = defaultHoldPositionMMPerSec
+	}
+	if cfg.PositionPID == nil || cfg.PositionPID.MinOutput == nil {
+		pid.minOutput = -maxSpeed
+	}
+	if cfg.PositionPID == nil || cfg.PositionPID.MaxOutput == nil {
+		pid.maxOutput = maxSpeed
+	}
+}
+
+// holdPosition keeps the boat where it is now until told to do something else
+func (b *boat) holdPosition(ctx context.Context) error {
+	if !b.positionSupported(ctx) {
+		return fmt.Errorf("%w: holding position needs it", ErrPositionNotSupported)
+	}
+
+	if err := b.checkEStop(); err != nil {
+		return err
+	}
+
+	if _, err := b.checkBattery(ctx); err != nil {
+		return err
+	}
+
+	p, err := b.CurrentPosition(ctx)
+	if err != nil {
+		return err
+	}
+
+	b.logger.Infof("holding position at %v", p)
+
+	opCtx, done := b.opMgr.New(ctx)
+	defer done()
+
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+
+	// superseded before we got the lock
+	if opCtx.Err() != nil {
+		return opCtx.Err()
+	}
+
+	err = b.startVelocityThreadInLock()
+	if err != nil {
+		return err
+	}
+
+	b.setControlStateInLock(controlPosition)
+	b.setRampLimitsInLock(nil)
+	b.state.holdPoint = p
+	b.state.velocityLinearGoal = r3.Vector{}
+	b.state.velocityAngularGoal = r3.Vector{}
+
+	return nil
+}
+
+// updateVelocityGoalForPosition sets the linear velocity goal to move back toward the hold point.
+// the pids work on the north/east error, and the result is rotated into the boat's frame. the
+// sideways part goes to the lateral pid, so it only does anything on boats that can move sideways.
+func updateVelocityGoalForPosition(state *boatState, position *geo.Point, heading float64) {
+	distance := kmToMM(position.GreatCircleDistance(state.holdPoint))
+	bearing := position.BearingTo(state.holdPoint) * math.Pi / 180
+
+	northError := distance * math.Cos(bearing)
+	eastError := distance * math.Sin(bearing)
+
+	north := state.northPID.Control(northError, 0, state.dt())
+	east := state.eastPID.Control(eastError, 0, state.dt())
+
+	h := heading * math.Pi / 180
+	state.velocityLinearGoal = r3.Vector{
+		X: east*math.Cos(h) - north*math.Sin(h),
+		Y: north*math.Cos(h) + east*math.Sin(h),
+	}
+	state.velocityAngularGoal = r3.Vector{}
+}
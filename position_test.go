@@ -0,0 +1,103 @@
+package viamboatbase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/test"
+)
+
+func TestUpdateVelocityGoalForPosition(t *testing.T) {
+	state := &boatState{}
+	state.configure(&Config{})
+	state.holdPoint = geo.NewPoint(40.7, -73.9)
+
+	// drifted 2 meters south while facing north, so go forward
+	south := state.holdPoint.PointAtDistanceAndBearing(.002, 180)
+	updateVelocityGoalForPosition(state, south, 0)
+	test.That(t, state.velocityLinearGoal.Y, test.ShouldBeGreaterThan, 500)
+	test.That(t, state.velocityLinearGoal.X, test.ShouldAlmostEqual, 0, 1)
+
+	// same drift while facing south, so back up
+	state.configure(&Config{})
+	updateVelocityGoalForPosition(state, south, 180)
+	test.That(t, state.velocityLinearGoal.Y, test.ShouldBeLessThan, -500)
+
+	// facing east, the hold point is off to the left
+	state.configure(&Config{})
+	updateVelocityGoalForPosition(state, south, 90)
+	test.That(t, state.velocityLinearGoal.X, test.ShouldBeLessThan, -500)
+	test.That(t, state.velocityLinearGoal.Y, test.ShouldAlmostEqual, 0, 1)
+
+	// correction is limited by the max velocity
+	state.configure(&Config{MaxLinearVelocityMMPerSec: 300})
+	updateVelocityGoalForPosition(state, south, 0)
+	test.That(t, state.velocityLinearGoal.Y, test.ShouldAlmostEqual, 300)
+}
+
+func TestHoldPositionDoCommand(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	// drifting north 100mm every read
+	fs := &fakeSensor{position: geo.NewPoint(40.7, -73.9), positionStepMM: 100}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	_, err := b.DoCommand(context.Background(), map[string]interface{}{"hold_position": true})
+	test.That(t, err, test.ShouldBeNil)
+
+	for i := 0; i < 5; i++ {
+		err = b.velocityThreadLoop(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+	}
+
+	st := b.snapshotState()
+	test.That(t, st.controlState, test.ShouldEqual, controlPosition)
+	goal := st.velocityLinearGoal
+
+	// facing north, so heading back south is backward
+	test.That(t, goal.Y, test.ShouldBeLessThan, 0)
+	powers := fm.get()
+	test.That(t, powers[0]+powers[1], test.ShouldBeLessThan, 0)
+
+	_, err = b.DoCommand(context.Background(), map[string]interface{}{"hold_position": false})
+	test.That(t, err, test.ShouldBeNil)
+	st = b.snapshotState()
+	test.That(t, st.controlState, test.ShouldEqual, controlNone)
+	test.That(t, st.velocityLinearGoal, test.ShouldResemble, r3.Vector{})
+	test.That(t, fm.get(), test.ShouldResemble, []float64{0, 0})
+}
+
+func TestHoldPositionSideways(t *testing.T) {
+	cfg := &Config{Motors: testMotorConfig, LengthMM: 500, WidthMM: 500, ControlLoopMs: 60000}
+	fm := newFakeMotors(len(cfg.Motors))
+	b := newTestBoat(t, cfg, fm)
+	b.solver = PseudoInverseSolver{}
+
+	// facing east and drifting north 100mm every read, so the hold point ends up to starboard
+	fs := &fakeSensor{heading: 90, position: geo.NewPoint(40.7, -73.9), positionStepMM: 100}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	_, err := b.DoCommand(context.Background(), map[string]interface{}{"hold_position": true})
+	test.That(t, err, test.ShouldBeNil)
+
+	for i := 0; i < 5; i++ {
+		err = b.velocityThreadLoop(context.Background())
+		test.That(t, err, test.ShouldBeNil)
+	}
+
+	goal := b.snapshotState().velocityLinearGoal
+	test.That(t, goal.X, test.ShouldBeGreaterThan, 0)
+	test.That(t, goal.Y, test.ShouldAlmostEqual, 0, 1)
+
+	// and the motors actually push that way, not just forward or back
+	out, err := cfg.ComputePowerOutput(fm.get())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, out.linearX, test.ShouldBeGreaterThan, .01)
+	test.That(t, out.linearY, test.ShouldAlmostEqual, 0, 1e-3)
+}
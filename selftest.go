@@ -0,0 +1,135 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+
+	"go.viam.com/rdk/components/movementsensor"
+)
+
+// how long self_test gives each component to answer unless told otherwise
+const defaultSelfTestTimeoutSec = 2
+
+// selfTest checks every motor and sensor answers, without moving anything. arg is
+// {"timeout_sec": 2}, how long each one gets. motors are asked IsPowered and their properties,
+// sensors their properties and whatever readings they say they have. the result is a map from
+// each component to {"healthy": ..., "error": ...}, with the motors under "motors", and
+// "healthy" on top if everything is.
+func (b *boat) selfTest(ctx context.Context, arg interface{}) (map[string]interface{}, error) {
+	args, _ := arg.(map[string]interface{})
+
+	timeoutSec := float64(defaultSelfTestTimeoutSec)
+	if _, ok := args["timeout_sec"]; ok {
+		t, ok := floatFromExtra(args, "timeout_sec")
+		if !ok || t <= 0 {
+			return nil, fmt.Errorf("self_test timeout_sec has to be positive, not %v", args["timeout_sec"])
+		}
+		timeoutSec = t
+	}
+	timeout := time.Duration(timeoutSec * float64(time.Second))
+
+	faulted := b.snapshotState().faultedMotors
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	healthy := true
+	check := func(results map[string]interface{}, key string, f func(ctx context.Context) (map[string]interface{}, error)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			res, err := f(ctx)
+			if res == nil {
+				res = map[string]interface{}{}
+			}
+			res["healthy"] = err == nil
+			if err != nil {
+				res["error"] = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[key] = res
+			healthy = healthy && err == nil
+		}()
+	}
+
+	motors := map[string]interface{}{}
+	for _, mc := range b.cfg.Motors {
+		name, m := mc.Name, b.motors[mc.Name]
+		check(motors, name, func(ctx context.Context) (map[string]interface{}, error) {
+			if faulted[name] {
+				return map[string]interface{}{"faulted": true}, errors.New("motor has faulted")
+			}
+			powered, _, err := m.IsPowered(ctx, nil)
+			if err != nil {
+				return nil, err
+			}
+			_, err = m.Properties(ctx, nil)
+			return map[string]interface{}{"powered": powered}, err
+		})
+	}
+
+	sensors := map[string]interface{}{}
+	for key, ms := range map[string]movementsensor.MovementSensor{
+		"movement_sensor":         b.movementSensor,
+		"heading_sensor":          b.headingSensor,
+		"angular_velocity_sensor": b.angularVelocitySensor,
+		"linear_velocity_sensor":  b.linearVelocitySensor,
+	} {
+		if ms == nil {
+			continue
+		}
+		ms := ms
+		check(sensors, key, func(ctx context.Context) (map[string]interface{}, error) {
+			return nil, selfTestMovementSensor(ctx, ms)
+		})
+	}
+	if b.powerSensor != nil {
+		check(sensors, "power_sensor", func(ctx context.Context) (map[string]interface{}, error) {
+			_, err := b.powerSensor.Readings(ctx, nil)
+			return nil, err
+		})
+	}
+
+	wg.Wait()
+
+	res := map[string]interface{}{"healthy": healthy, "motors": motors}
+	for key, r := range sensors {
+		res[key] = r
+	}
+	return res, nil
+}
+
+// selfTestMovementSensor reads everything ms says it can do that the boat uses
+func selfTestMovementSensor(ctx context.Context, ms movementsensor.MovementSensor) error {
+	props, err := ms.Properties(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if props.CompassHeadingSupported {
+		_, e := ms.CompassHeading(ctx, nil)
+		err = multierr.Combine(err, e)
+	}
+	if props.LinearVelocitySupported {
+		_, e := ms.LinearVelocity(ctx, nil)
+		err = multierr.Combine(err, e)
+	}
+	if props.AngularVelocitySupported {
+		_, e := ms.AngularVelocity(ctx, nil)
+		err = multierr.Combine(err, e)
+	}
+	if props.PositionSupported {
+		_, _, e := ms.Position(ctx, nil)
+		err = multierr.Combine(err, e)
+	}
+	return err
+}
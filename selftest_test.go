@@ -0,0 +1,46 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestSelfTest(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	b.movementSensor = (&fakeSensor{}).movementSensor()
+
+	res, err := b.DoCommand(context.Background(), map[string]interface{}{"self_test": map[string]interface{}{}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["healthy"], test.ShouldBeTrue)
+	test.That(t, res["movement_sensor"], test.ShouldResemble, map[string]interface{}{"healthy": true})
+	test.That(t, res["motors"], test.ShouldResemble, map[string]interface{}{
+		"port":      map[string]interface{}{"healthy": true, "powered": false},
+		"starboard": map[string]interface{}{"healthy": true, "powered": false},
+	})
+
+	// the starboard motor's controller stops answering
+	fm.motors[1].IsPoweredFunc = func(ctx context.Context, extra map[string]interface{}) (bool, float64, error) {
+		return false, 0, errors.New("no response from controller")
+	}
+
+	res, err = b.DoCommand(context.Background(), map[string]interface{}{"self_test": map[string]interface{}{}})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["healthy"], test.ShouldBeFalse)
+	motors := res["motors"].(map[string]interface{})
+	test.That(t, motors["port"].(map[string]interface{})["healthy"], test.ShouldBeTrue)
+	starboard := motors["starboard"].(map[string]interface{})
+	test.That(t, starboard["healthy"], test.ShouldBeFalse)
+	test.That(t, starboard["error"], test.ShouldContainSubstring, "no response")
+	test.That(t, res["movement_sensor"].(map[string]interface{})["healthy"], test.ShouldBeTrue)
+
+	// nothing was ever powered
+	test.That(t, fm.history, test.ShouldResemble, [][]float64{nil, nil})
+
+	_, err = b.DoCommand(context.Background(), map[string]interface{}{"self_test": map[string]interface{}{"timeout_sec": -1.0}})
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -0,0 +1,171 @@
+package viamboatbase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/spatialmath"
+	rdkutils "go.viam.com/rdk/utils"
+)
+
+// fakeBoatSystem is a boat on a pretend lake. the fake sensor's velocity follows what the fake
+// motors are pushing with a first order lag, so full power on an axis ends up at the open loop
+// speed for it, and the heading turns with the angular velocity.
+type fakeBoatSystem struct {
+	cfg    *Config
+	motors *fakeMotors
+	sensor *fakeSensor
+
+	// how long the velocity takes to get ~63% of the way to what the motors are pushing
+	lag time.Duration
+
+	// if set, the sensor reports positive angular z clockwise
+	clockwise bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newFakeBoatSystem(cfg *Config, lag time.Duration) *fakeBoatSystem {
+	return &fakeBoatSystem{
+		cfg:    cfg,
+		motors: newFakeMotors(len(cfg.Motors)),
+		sensor: &fakeSensor{},
+		lag:    lag,
+	}
+}
+
+// start steps the plant every step until stop
+func (s *fakeBoatSystem) start(step time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		last := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(step):
+			}
+			now := time.Now()
+			s.step(now.Sub(last))
+			last = now
+		}
+	}()
+}
+
+func (s *fakeBoatSystem) stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// step moves the boat dt along. negative angular z turns clockwise, so the heading goes up.
+func (s *fakeBoatSystem) step(dt time.Duration) {
+	out, err := s.cfg.ComputePowerOutput(s.motors.get())
+	if err != nil {
+		panic(err)
+	}
+	max := s.cfg.maxWeights()
+	fullLinear, fullAngular := s.cfg.openLoopSpeeds()
+
+	target := r3.Vector{Y: out.linearY / max.linearY * fullLinear}
+	if max.linearX > lateralEpsilon {
+		target.X = out.linearX / max.linearX * fullLinear
+	}
+	targetAngular := out.angular / max.angular * fullAngular
+
+	alpha := 1 - math.Exp(-dt.Seconds()/s.lag.Seconds())
+
+	sign := 1.0
+	if s.clockwise {
+		sign = -1
+	}
+
+	s.sensor.mu.Lock()
+	lv, av := s.sensor.linearVelocity, sign*s.sensor.angularVelocity.Z
+	heading := s.sensor.heading
+	s.sensor.mu.Unlock()
+
+	lv = lv.Add(target.Sub(lv).Mul(alpha))
+	av += (targetAngular - av) * alpha
+	heading = rdkutils.ModAngDeg(heading - av*dt.Seconds())
+
+	s.sensor.set(heading, lv, spatialmath.AngularVelocity{Z: sign * av})
+}
+
+// boat is a test boat driving the fake motors and reading the fake sensor
+func (s *fakeBoatSystem) boat(t *testing.T) *boat {
+	b := newTestBoat(t, s.cfg, s.motors)
+	b.movementSensor = concurrentSensor{s.sensor.movementSensor()}
+	return b
+}
+
+func TestFakeBoatSystemSetVelocity(t *testing.T) {
+	// the default linear gains are for a real boat and just bang between full forward and
+	// reverse on one this quick, so these are tuned for it
+	p, i := .002, .004
+	cfg := &Config{
+		Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 20,
+		LinearPID: &PIDConfig{P: &p, I: &i},
+	}
+	sim := newFakeBoatSystem(cfg, 300*time.Millisecond)
+	sim.start(5 * time.Millisecond)
+	defer sim.stop()
+
+	b := sim.boat(t)
+	defer b.Close(context.Background())
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{},
+		map[string]interface{}{"block": true, "poll_ms": 10, "timeout_sec": 10})
+	test.That(t, err, test.ShouldBeNil)
+
+	// and it stays there, going straight
+	time.Sleep(500 * time.Millisecond)
+	lv, av, err := b.readVelocities(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, lv.Y, test.ShouldAlmostEqual, 500, 50)
+	test.That(t, av, test.ShouldAlmostEqual, 0, 2)
+
+	powers := sim.motors.get()
+	test.That(t, powers[0], test.ShouldAlmostEqual, powers[1], .01)
+	test.That(t, powers[0], test.ShouldBeGreaterThan, 0)
+}
+
+func TestFakeBoatSystemSpin(t *testing.T) {
+	// a sensor that counts clockwise has to be flipped, or the angular pid pushes the wrong way
+	for _, clockwise := range []bool{false, true} {
+		clockwise := clockwise
+		t.Run(fmt.Sprintf("clockwise %v", clockwise), func(t *testing.T) {
+			cfg := &Config{
+				Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 20,
+				AngularVelocityClockwise: clockwise,
+			}
+			sim := newFakeBoatSystem(cfg, 200*time.Millisecond)
+			sim.clockwise = clockwise
+			sim.sensor.set(10, r3.Vector{}, spatialmath.AngularVelocity{})
+			sim.start(5 * time.Millisecond)
+			defer sim.stop()
+
+			b := sim.boat(t)
+			defer b.Close(context.Background())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+			test.That(t, b.Spin(ctx, 90, 45, nil), test.ShouldBeNil)
+
+			heading, err := b.CurrentHeading(context.Background())
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, math.Abs(angleDiffDeg(100, heading)), test.ShouldBeLessThan, 2*cfg.spinTolerance())
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package viamboatbase
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/golang/geo/r3"
+)
+
+// PowerSolver turns linear and angular power, as passed to SetPower, into a power for each
+// motor in config order
+type PowerSolver interface {
+	Solve(cfg *Config, linear, angular r3.Vector) ([]float64, error)
+}
+
+// Solve uses the analytic solution if it fits within the motor limits. if it doesn't, it tries
+// again holding the saturated motors at their limits, and only if that still misses the goal is
+// the optimizer run, keeping whichever answer is closer. this is what the boat uses unless told
+// otherwise.
+func (po *powerOptimizer) Solve(cfg *Config, linear, angular r3.Vector) ([]float64, error) {
+	goal := cfg.computeGoal(linear, angular)
+
+	powers, ok := cfg.computePowerAnalytic(goal)
+	if ok {
+		return powers, nil
+	}
+
+	miss := func(powers []float64) float64 {
+		out, err := cfg.ComputePowerOutput(powers)
+		if err != nil {
+			return math.MaxFloat64
+		}
+		return out.weightedDiff(goal, cfg.objectiveScale())
+	}
+
+	saturated, ok := cfg.computePowerSaturated(goal)
+	if ok && miss(saturated) <= cfg.optimizerStopVal() {
+		return saturated, nil
+	}
+
+	optimized, err := po.optimize(cfg, goal)
+	if err != nil {
+		if ok {
+			return saturated, nil
+		}
+		return nil, err
+	}
+	if ok && miss(saturated) < miss(optimized) {
+		return saturated, nil
+	}
+	return optimized, nil
+}
+
+// PseudoInverseSolver only ever uses the analytic solution, clamped to the motor limits, so it
+// gives the same answer no matter how busy the machine is. it's worse than the optimizer when the
+// limits are hit, so it's meant for tests.
+type PseudoInverseSolver struct{}
+
+func (PseudoInverseSolver) Solve(cfg *Config, linear, angular r3.Vector) ([]float64, error) {
+	if len(cfg.Motors) == 0 {
+		return nil, fmt.Errorf("%w: no motors", ErrInfeasibleCommand)
+	}
+
+	x, ok := solvePseudoInverse(cfg.weightsAsMatrix(), cfg.computeGoal(linear, angular))
+	if !ok {
+		return nil, ErrInfeasibleCommand
+	}
+
+	powers := make([]float64, len(cfg.Motors))
+	for idx, mc := range cfg.Motors {
+		powers[idx] = mc.clampPower(x.AtVec(idx))
+	}
+	return powers, nil
+}
+
+// UniformScaleSolver uses the analytic solution, and if any motor is past its limit scales every
+// motor down by the same amount until none are. the boat goes slower than asked, but in the
+// direction asked, where clamping each motor on its own changes the mix between them. motors
+// that are weaker in reverse are solved for like computePowerAnalytic does.
+type UniformScaleSolver struct{}
+
+func (UniformScaleSolver) Solve(cfg *Config, linear, angular r3.Vector) ([]float64, error) {
+	if len(cfg.Motors) == 0 {
+		return nil, fmt.Errorf("%w: no motors", ErrInfeasibleCommand)
+	}
+
+	goal := cfg.computeGoal(linear, angular)
+	x, ok := cfg.solveWithReverseThrust(goal)
+	if !ok {
+		// a motor that's weaker in reverse switches direction once that's taken into account, so
+		// there's no one answer for it. the symmetric one is close while it isn't pushing hard.
+		x, ok = solvePseudoInverse(cfg.weightsAsMatrix(), goal)
+	}
+	if !ok {
+		return nil, ErrInfeasibleCommand
+	}
+
+	// how far past its limit the worst motor is. a motor that can't go one way at all is left
+	// to the clamp below, since no scale fixes that.
+	scale := 1.0
+	for idx, mc := range cfg.Motors {
+		p, limit := x.AtVec(idx), mc.maxPower()
+		if p < 0 {
+			limit = mc.minPower()
+		}
+		if limit != 0 {
+			scale = math.Max(scale, p/limit)
+		}
+	}
+
+	powers := make([]float64, len(cfg.Motors))
+	for idx, mc := range cfg.Motors {
+		powers[idx] = mc.clampPower(x.AtVec(idx) / scale)
+	}
+	return powers, nil
+}
+
+const (
+	powerSaturationOptimize = "optimize"
+	powerSaturationScale    = "scale"
+)
+
+// configuredSolver is the solver power_saturation picks, nil meaning the optimizer
+func (cfg *Config) configuredSolver() PowerSolver {
+	if cfg.PowerSaturation == powerSaturationScale {
+		return UniformScaleSolver{}
+	}
+	return nil
+}
+
+// powerSolver is the solver set on the boat, or the optimizer if none is
+func (b *boat) powerSolver() PowerSolver {
+	if b.solver != nil {
+		return b.solver
+	}
+	return &b.optimizer
+}
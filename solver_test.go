@@ -0,0 +1,128 @@
+package viamboatbase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+)
+
+func TestPseudoInverseSolver(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+
+	solve := func(linear, angular r3.Vector) []float64 {
+		powers, err := cfg.computePower(linear, angular, PseudoInverseSolver{})
+		test.That(t, err, test.ShouldBeNil)
+		return powers
+	}
+
+	check := func(powers []float64, port, starboard float64) {
+		test.That(t, powers[0], test.ShouldAlmostEqual, port, 1e-9)
+		test.That(t, powers[1], test.ShouldAlmostEqual, starboard, 1e-9)
+	}
+
+	check(solve(r3.Vector{Y: .5}, r3.Vector{}), .5, .5)
+	check(solve(r3.Vector{Y: -.25}, r3.Vector{}), -.25, -.25)
+	check(solve(r3.Vector{}, r3.Vector{Z: .5}), .5, -.5)
+	check(solve(r3.Vector{}, r3.Vector{Z: -.5}), -.5, .5)
+	check(solve(r3.Vector{Y: .5}, r3.Vector{Z: .5}), 1, 0)
+
+	// past the limits it's just clamped
+	check(solve(r3.Vector{Y: 1}, r3.Vector{Z: .5}), 1, .5)
+
+	// and it's the same every time
+	first := solve(r3.Vector{Y: .3}, r3.Vector{Z: .2})
+	for i := 0; i < 10; i++ {
+		test.That(t, solve(r3.Vector{Y: .3}, r3.Vector{Z: .2}), test.ShouldResemble, first)
+	}
+
+	_, err := (&Config{}).computePower(r3.Vector{Y: 1}, r3.Vector{}, PseudoInverseSolver{})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+// countingSolver records how many times it's used
+type countingSolver struct {
+	PseudoInverseSolver
+	calls int
+}
+
+func (s *countingSolver) Solve(cfg *Config, linear, angular r3.Vector) ([]float64, error) {
+	s.calls++
+	return s.PseudoInverseSolver.Solve(cfg, linear, angular)
+}
+
+func TestBoatUsesInjectedSolver(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+
+	s := &countingSolver{}
+	b.solver = s
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{Z: .25}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, s.calls, test.ShouldEqual, 1)
+
+	powers := fm.get()
+	test.That(t, powers[0], test.ShouldAlmostEqual, .75, 1e-9)
+	test.That(t, powers[1], test.ShouldAlmostEqual, .25, 1e-9)
+
+	// without one, the optimizer is the default
+	test.That(t, (&boat{}).powerSolver(), test.ShouldHaveSameTypeAs, &powerOptimizer{})
+}
+
+func TestUniformScaleSolver(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	linear, angular := r3.Vector{Y: 1}, r3.Vector{Z: .5}
+	max := cfg.maxWeights()
+
+	// how far off the commanded direction the output is, in radians, in SetPower's units
+	directionError := func(solver PowerSolver) float64 {
+		powers, err := cfg.computePower(linear, angular, solver)
+		test.That(t, err, test.ShouldBeNil)
+		for idx, mc := range cfg.Motors {
+			test.That(t, powers[idx], test.ShouldBeBetweenOrEqual, mc.minPower(), mc.maxPower())
+		}
+		out := powerOutput(t, cfg, powers)
+		want := r3.Vector{Y: linear.Y, Z: angular.Z}
+		return want.Angle(r3.Vector{Y: out.linearY / max.linearY, Z: out.angular / max.angular}).Radians()
+	}
+
+	clampError := directionError(PseudoInverseSolver{})
+	scaleError := directionError(UniformScaleSolver{})
+	test.That(t, clampError, test.ShouldBeGreaterThan, .1)
+	test.That(t, scaleError, test.ShouldAlmostEqual, 0, 1e-9)
+
+	// the largest motor is at full power, the rest keep their ratio to it
+	powers, err := cfg.computePower(linear, angular, UniformScaleSolver{})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, powers[0], test.ShouldAlmostEqual, 1, 1e-9)
+	test.That(t, powers[1], test.ShouldAlmostEqual, 1./3, 1e-9)
+
+	// within the limits it's the same as the analytic solution
+	powers, err = cfg.computePower(r3.Vector{Y: .5}, r3.Vector{Z: .25}, UniformScaleSolver{})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, powers[0], test.ShouldAlmostEqual, .75, 1e-9)
+	test.That(t, powers[1], test.ShouldAlmostEqual, .25, 1e-9)
+
+	// a motor that's weak in reverse has to be pushed harder backward, or turning in place
+	// also pushes the boat forward. with and without scaling down.
+	half := .5
+	weak := &Config{Motors: append([]MotorConfig{}, testTwoMotorConfig...), LengthMM: 3048, WidthMM: 1100}
+	weak.Motors[0].ReverseThrustScale = &half
+	for _, turn := range []float64{-.3, -1} {
+		powers, err = weak.computePower(r3.Vector{}, r3.Vector{Z: turn}, UniformScaleSolver{})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, powers[0], test.ShouldBeLessThan, 0)
+		out := powerOutput(t, weak, powers)
+		test.That(t, out.linearY, test.ShouldAlmostEqual, 0, 1e-9)
+		test.That(t, out.angular, test.ShouldBeLessThan, 0)
+	}
+
+	// and power_saturation picks it
+	test.That(t, (&Config{PowerSaturation: "scale"}).configuredSolver(), test.ShouldResemble, UniformScaleSolver{})
+	test.That(t, (&Config{}).configuredSolver(), test.ShouldBeNil)
+	_, err = (&Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, PowerSaturation: "squash"}).Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -0,0 +1,57 @@
+package viamboatbase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/geo/r3"
+)
+
+const (
+	startupModeNone         = "none"
+	startupModeHoldHeading  = "hold_heading"
+	startupModeHoldPosition = "hold_position"
+)
+
+// validateStartupMode checks startup_mode is known and has a sensor to work with
+func (cfg *Config) validateStartupMode() error {
+	switch cfg.StartupMode {
+	case "", startupModeNone:
+		return nil
+	case startupModeHoldHeading:
+		if cfg.MovementSensor == "" && cfg.HeadingSensor == "" {
+			return fmt.Errorf("startup_mode %q needs a movement_sensor or heading_sensor", cfg.StartupMode)
+		}
+		return nil
+	case startupModeHoldPosition:
+		if cfg.MovementSensor == "" {
+			return fmt.Errorf("startup_mode %q needs a movement_sensor", cfg.StartupMode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown startup_mode %q", cfg.StartupMode)
+	}
+}
+
+// applyStartupMode puts the boat in startup_mode, the last thing done when it's created
+func (b *boat) applyStartupMode(ctx context.Context) error {
+	switch b.cfg.StartupMode {
+	case startupModeHoldHeading:
+		var heading float64
+		if b.cfg.StartupHeadingDeg != nil {
+			heading = *b.cfg.StartupHeadingDeg
+		} else {
+			h, err := b.CurrentHeading(ctx)
+			if err != nil {
+				return err
+			}
+			heading = h
+		}
+		b.logger.Infof("holding heading %v at startup", heading)
+		return b.SetVelocity(ctx, r3.Vector{}, r3.Vector{}, map[string]interface{}{"hold_heading": heading})
+	case startupModeHoldPosition:
+		return b.holdPosition(ctx)
+	default:
+		return nil
+	}
+}
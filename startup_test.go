@@ -0,0 +1,121 @@
+package viamboatbase
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edaniels/golog"
+	geo "github.com/kellydunn/golang-geo"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/components/base"
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/components/movementsensor"
+	"go.viam.com/rdk/resource"
+)
+
+func createStartupBoat(t *testing.T, cfg *Config, fs *fakeSensor) *boat {
+	t.Helper()
+	fm := newFakeMotors(2)
+	deps := resource.Dependencies{
+		motor.Named("port"):         fm.motors[0],
+		motor.Named("starboard"):    fm.motors[1],
+		movementsensor.Named("gps"): fs.movementSensor(),
+	}
+	conf := resource.Config{Name: "boat", API: base.API, Model: Model, ConvertedAttributes: cfg}
+
+	b, err := createBoat(deps, conf, golog.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	t.Cleanup(func() { b.Close(context.Background()) })
+	return b.(*boat)
+}
+
+func TestStartupMode(t *testing.T) {
+	startupConfig := func(mode string) *Config {
+		return &Config{
+			Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, MovementSensor: "gps",
+			ControlLoopMs: 60000, StartupMode: mode,
+		}
+	}
+
+	b := createStartupBoat(t, startupConfig(""), &fakeSensor{heading: 30})
+	test.That(t, b.snapshotState().controlState, test.ShouldEqual, controlNone)
+
+	// holds the heading it started at
+	b = createStartupBoat(t, startupConfig("hold_heading"), &fakeSensor{heading: 30})
+	s := b.snapshotState()
+	test.That(t, s.controlState, test.ShouldEqual, controlHeading)
+	test.That(t, s.compassGoal, test.ShouldEqual, 30)
+	test.That(t, s.threadStarted, test.ShouldBeTrue)
+
+	// or the one it's told to
+	cfg := startupConfig("hold_heading")
+	heading := 270.0
+	cfg.StartupHeadingDeg = &heading
+	b = createStartupBoat(t, cfg, &fakeSensor{heading: 30})
+	test.That(t, b.snapshotState().compassGoal, test.ShouldEqual, 270)
+
+	start := geo.NewPoint(40.7, -74)
+	b = createStartupBoat(t, startupConfig("hold_position"), &fakeSensor{position: start})
+	s = b.snapshotState()
+	test.That(t, s.controlState, test.ShouldEqual, controlPosition)
+	test.That(t, s.holdPoint, test.ShouldResemble, start)
+}
+
+func TestStartupModeValidate(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, StartupMode: "drift"}
+	_, err := cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// nothing to hold with
+	cfg.StartupMode = "hold_heading"
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg.HeadingSensor = "compass"
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+
+	cfg.StartupMode = "hold_position"
+	_, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestStartupModeFailureLeavesMotors(t *testing.T) {
+	// the sensor can't give a position, so hold_position fails
+	cfg := &Config{
+		Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, MovementSensor: "gps",
+		StartupMode: "hold_position", StopRampMs: 100, MotorKeepAliveMs: 10,
+	}
+	fm := newFakeMotors(2)
+	var mu sync.Mutex
+	stops := 0
+	for _, m := range fm.motors {
+		m.StopFunc = func(ctx context.Context, extra map[string]interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+			stops++
+			return nil
+		}
+	}
+	deps := resource.Dependencies{
+		motor.Named("port"):         fm.motors[0],
+		motor.Named("starboard"):    fm.motors[1],
+		movementsensor.Named("gps"): (&fakeSensor{}).movementSensor(),
+	}
+	conf := resource.Config{Name: "boat", API: base.API, Model: Model, ConvertedAttributes: cfg}
+
+	_, err := createBoat(deps, conf, golog.NewTestLogger(t))
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// no keep alive, stop, or ramp from a boat that never got made
+	time.Sleep(50 * time.Millisecond)
+	fm.mu.Lock()
+	test.That(t, fm.history, test.ShouldResemble, [][]float64{nil, nil})
+	fm.mu.Unlock()
+	mu.Lock()
+	test.That(t, stops, test.ShouldEqual, 0)
+	mu.Unlock()
+}
@@ -0,0 +1,87 @@
+package viamboatbase
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/components/motor"
+)
+
+// how long status waits on each motor before leaving it out
+const motorTelemetryTimeout = time.Second
+
+// motorPosition is where a motor's encoder was at a status call, to work out rpm at the next one
+type motorPosition struct {
+	revolutions float64
+	at          time.Time
+}
+
+// motorTelemetry is what each motor says it's doing, to compare with the power_ it was sent, keyed
+// by the motor's name like the rest of status: reported_power_ and powered_ from IsPowered, and
+// for motors with an encoder position_ in revolutions and rpm_ since the last status. a motor
+// that doesn't answer gets motor_error_ instead.
+func (b *boat) motorTelemetry(ctx context.Context) map[string]interface{} {
+	ctx, cancel := context.WithTimeout(ctx, motorTelemetryTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	res := map[string]interface{}{}
+	for _, mc := range b.cfg.Motors {
+		name, m := mc.Name, b.motors[mc.Name]
+		if m == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := b.readMotorTelemetry(ctx, name, m)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for k, v := range r {
+				res[k+"_"+name] = v
+			}
+			if err != nil {
+				res["motor_error_"+name] = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	return res
+}
+
+func (b *boat) readMotorTelemetry(ctx context.Context, name string, m motor.Motor) (map[string]interface{}, error) {
+	powered, power, err := m.IsPowered(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]interface{}{"powered": powered, "reported_power": power}
+
+	props, err := m.Properties(ctx, nil)
+	if err != nil {
+		return res, err
+	}
+	if !props[motor.PositionReporting] {
+		return res, nil
+	}
+
+	revolutions, err := m.Position(ctx, nil)
+	if err != nil {
+		return res, err
+	}
+	now := time.Now()
+	res["position"] = revolutions
+
+	b.stateMutex.Lock()
+	defer b.stateMutex.Unlock()
+	if last, ok := b.motorPositions[name]; ok && now.After(last.at) {
+		res["rpm"] = (revolutions - last.revolutions) / now.Sub(last.at).Minutes()
+	}
+	if b.motorPositions == nil {
+		b.motorPositions = map[string]motorPosition{}
+	}
+	b.motorPositions[name] = motorPosition{revolutions, now}
+	return res, nil
+}
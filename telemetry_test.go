@@ -0,0 +1,73 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/components/motor"
+)
+
+func TestStatusMotorTelemetry(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100}
+	fm := newFakeMotors(2)
+	b := newTestBoat(t, cfg, fm)
+	b.solver = PseudoInverseSolver{}
+
+	// the starboard motor has an encoder
+	var mu sync.Mutex
+	revolutions := 10.0
+	fm.motors[1].PropertiesFunc = func(ctx context.Context, extra map[string]interface{}) (map[motor.Feature]bool, error) {
+		return map[motor.Feature]bool{motor.PositionReporting: true}, nil
+	}
+	fm.motors[1].PositionFunc = func(ctx context.Context, extra map[string]interface{}) (float64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return revolutions, nil
+	}
+
+	err := b.SetPower(context.Background(), r3.Vector{Y: .5}, r3.Vector{}, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	status := func() map[string]interface{} {
+		t.Helper()
+		res, err := b.DoCommand(context.Background(), map[string]interface{}{"status": true})
+		test.That(t, err, test.ShouldBeNil)
+		return res
+	}
+
+	res := status()
+	test.That(t, res["power_port"], test.ShouldAlmostEqual, .5, 1e-9)
+	test.That(t, res["powered_port"], test.ShouldBeTrue)
+	test.That(t, res["reported_power_port"], test.ShouldAlmostEqual, .5, 1e-9)
+	test.That(t, res, test.ShouldNotContainKey, "position_port")
+	test.That(t, res["powered_starboard"], test.ShouldBeTrue)
+	test.That(t, res["position_starboard"], test.ShouldEqual, 10)
+
+	// there's nothing to measure rpm against until the second time
+	test.That(t, res, test.ShouldNotContainKey, "rpm_starboard")
+
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	revolutions = 11
+	mu.Unlock()
+
+	res = status()
+	test.That(t, res["position_starboard"], test.ShouldEqual, 11)
+	// one revolution in a bit over 100ms
+	test.That(t, res["rpm_starboard"], test.ShouldBeBetween, 400, 600)
+
+	// a motor that doesn't answer says why
+	fm.motors[0].IsPoweredFunc = func(ctx context.Context, extra map[string]interface{}) (bool, float64, error) {
+		return false, 0, errors.New("no response from controller")
+	}
+	res = status()
+	test.That(t, res["motor_error_port"], test.ShouldContainSubstring, "no response")
+	test.That(t, res, test.ShouldNotContainKey, "powered_port")
+	test.That(t, res["power_port"], test.ShouldAlmostEqual, .5, 1e-9)
+}
@@ -0,0 +1,82 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/golang/geo/r3"
+
+	rdkutils "go.viam.com/rdk/utils"
+)
+
+// how close the measured velocity has to get to the goal for a blocking SetVelocity to return,
+// unless extra says otherwise
+const (
+	defaultBlockLinearToleranceMMPerSec   = 50
+	defaultBlockAngularToleranceDegPerSec = 2
+)
+
+// waitForVelocity is the rest of SetVelocity with extra["block"] = true. it waits until the
+// measured velocity is within tolerance_mm_per_sec and tolerance_degs_per_sec of the goal, or
+// within the spin tolerance of the heading for hold_heading. timeout_sec gives up after that long,
+// leaving the goal in place, and poll_ms is how often to check.
+func (b *boat) waitForVelocity(ctx, opCtx context.Context, linear, angular r3.Vector, extra map[string]interface{}) error {
+	linearTolerance := float64(defaultBlockLinearToleranceMMPerSec)
+	if t, ok := floatFromExtra(extra, "tolerance_mm_per_sec"); ok {
+		linearTolerance = t
+	}
+
+	angularTolerance := float64(defaultBlockAngularToleranceDegPerSec)
+	if t, ok := floatFromExtra(extra, "tolerance_degs_per_sec"); ok {
+		angularTolerance = t
+	}
+
+	heading, holdHeading := floatFromExtra(extra, "hold_heading")
+	headingTolerance := b.cfg.spinTolerance()
+
+	timeoutSec, _ := floatFromExtra(extra, "timeout_sec")
+
+	pollTime := b.cfg.spinPollTime()
+	if ms, ok := floatFromExtra(extra, "poll_ms"); ok && ms > 0 {
+		pollTime = time.Duration(ms * float64(time.Millisecond))
+	}
+
+	waitCtx := opCtx
+	if timeoutSec > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(opCtx, time.Duration(timeoutSec*float64(time.Second)))
+		defer cancel()
+	}
+
+	err := b.opMgr.WaitForSuccess(waitCtx, pollTime, func(ctx context.Context) (bool, error) {
+		lv, av, err := b.readVelocities(ctx)
+		if err != nil {
+			return false, err
+		}
+		if lv.Sub(linear).Norm() > linearTolerance {
+			return false, nil
+		}
+
+		if !holdHeading {
+			return math.Abs(av-angular.Z) <= angularTolerance, nil
+		}
+
+		compass, err := b.CurrentHeading(ctx)
+		if err != nil {
+			return false, err
+		}
+		return rdkutils.AngleDiffDeg(heading, compass) < headingTolerance, nil
+	})
+
+	if superseded(ctx, opCtx) {
+		return opCtx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("%w, didn't get within %v mm/s of %v in %v seconds",
+			ErrVelocityTimeout, linearTolerance, linear, timeoutSec)
+	}
+	return err
+}
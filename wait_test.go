@@ -0,0 +1,64 @@
+package viamboatbase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/spatialmath"
+)
+
+func TestSetVelocityBlock(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	fs := &fakeSensor{}
+	b.movementSensor = fs.movementSensor()
+	defer b.Close(context.Background())
+
+	// the boat gets up to speed a while after the goal is set
+	converged := make(chan time.Time, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		fs.set(0, r3.Vector{Y: 480}, spatialmath.AngularVelocity{Z: 1})
+		converged <- time.Now()
+	}()
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{},
+		map[string]interface{}{"block": true, "poll_ms": 5})
+	test.That(t, err, test.ShouldBeNil)
+	returned := time.Now()
+
+	at := <-converged
+	test.That(t, returned.After(at), test.ShouldBeTrue)
+	test.That(t, returned.Sub(at), test.ShouldBeLessThan, time.Second)
+
+	s := b.snapshotState()
+	test.That(t, s.controlState, test.ShouldEqual, controlVelocity)
+	test.That(t, s.velocityLinearGoal, test.ShouldResemble, r3.Vector{Y: 500})
+}
+
+func TestSetVelocityBlockTimeout(t *testing.T) {
+	cfg := &Config{Motors: testTwoMotorConfig, LengthMM: 3048, WidthMM: 1100, ControlLoopMs: 60000}
+	b := newTestBoat(t, cfg, newFakeMotors(2))
+	b.movementSensor = (&fakeSensor{}).movementSensor()
+	defer b.Close(context.Background())
+
+	err := b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{},
+		map[string]interface{}{"block": true, "poll_ms": 5, "timeout_sec": .05})
+	test.That(t, errors.Is(err, ErrVelocityTimeout), test.ShouldBeTrue)
+	test.That(t, err.Error(), test.ShouldStartWith, "waiting for velocity timed out")
+
+	// the goal is left running
+	s := b.snapshotState()
+	test.That(t, s.controlState, test.ShouldEqual, controlVelocity)
+	test.That(t, s.velocityLinearGoal, test.ShouldResemble, r3.Vector{Y: 500})
+
+	// and there's nothing to wait on without a sensor
+	b.movementSensor = nil
+	err = b.SetVelocity(context.Background(), r3.Vector{Y: 500}, r3.Vector{}, map[string]interface{}{"block": true})
+	test.That(t, errors.Is(err, ErrNoMovementSensor), test.ShouldBeTrue)
+}